@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/clls-dev/clls/pkg/lspsrv"
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const defaultLogFile = "/tmp/vscode-clls/dap.log"
+
+// newLogger logs to the file at the level, like the language server flags of the same names
+func newLogger(level, file string) (*zap.Logger, error) {
+	cfg := zap.NewDevelopmentConfig()
+	if err := cfg.Level.UnmarshalText([]byte(level)); err != nil {
+		return nil, errors.Wrap(err, "parse log level")
+	}
+	if file != "stderr" {
+		if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+			return nil, errors.Wrap(err, "create log dir")
+		}
+	}
+	cfg.OutputPaths = []string{file}
+	l, err := cfg.Build()
+	return l, errors.Wrap(err, "build logger")
+}
+
+// clls-dap serves the Debug Adapter Protocol on stdio, it runs compiled chialisp step by step
+func main() {
+	flagSet := flag.NewFlagSet("clls-dap", flag.ExitOnError)
+	levelFlag := flagSet.String("log-level", "debug", "log level: debug, info, warn or error")
+	fileFlag := flagSet.String("log-file", defaultLogFile, "log file path or stderr")
+	root := &ffcli.Command{
+		ShortUsage: "clls-dap [--log-level <level>] [--log-file <path>]",
+		ShortHelp:  "chialisp debug adapter, serves DAP on stdio",
+		FlagSet:    flagSet,
+		Exec: func(context.Context, []string) error {
+			l, err := newLogger(*levelFlag, *fileFlag)
+			if err != nil {
+				return errors.Wrap(err, "init logger")
+			}
+			defer func() { _ = l.Sync() }()
+			if err := serve(l, os.Stdin, os.Stdout); err != nil {
+				l.Error("main", zap.Error(err))
+				return err
+			}
+			return nil
+		},
+	}
+
+	if err := root.ParseAndRun(context.Background(), os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func serve(l *zap.Logger, in io.Reader, out io.Writer) error {
+	srv := newServer(l.Named("dap"), out)
+	for !srv.exit {
+		b, err := lspsrv.ReadMessage(l, in)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return errors.Wrap(err, "read message")
+		}
+		var req request
+		if err := json.Unmarshal(b, &req); err != nil {
+			return errors.Wrap(err, "unmarshal request")
+		}
+		l.Debug("recv", zap.String("command", req.Command))
+		if err := srv.handle(&req); err != nil {
+			return errors.Wrapf(err, "handle '%s'", req.Command)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLogger(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "logs", "dap.log")
+	l, err := newLogger("info", file)
+	require.NoError(t, err)
+	l.Debug("hidden")
+	l.Info("shown")
+	require.NoError(t, l.Sync())
+	b, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	require.Contains(t, string(b), "shown")
+	require.NotContains(t, string(b), "hidden")
+
+	_, err = newLogger("loud", file)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "parse log level")
+}
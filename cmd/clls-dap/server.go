@@ -0,0 +1,518 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/clls-dev/clls/pkg/clls"
+	"github.com/clls-dev/clls/pkg/clvm"
+	"github.com/clls-dev/clls/pkg/lspsrv"
+	"github.com/pkg/errors"
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+	"go.uber.org/zap"
+)
+
+// the program runs in a single thread
+const threadID = 1
+
+type server struct {
+	l   *zap.Logger
+	out io.Writer
+
+	linesStartAt1   bool
+	columnsStartAt1 bool
+
+	debugger    *clls.Debugger
+	breakpoints map[lsp.DocumentURI][]int // set before the launch
+	launch      *launchArguments
+	configured  bool
+	exit        bool
+
+	// guards writes, the running state, the last stop and the variables it references
+	mu        sync.Mutex
+	seq       int
+	running   bool
+	stop      *clls.DebugStop
+	variables []func() []variable
+}
+
+func newServer(l *zap.Logger, out io.Writer) *server {
+	if l == nil {
+		l = zap.NewNop()
+	}
+	return &server{
+		l:               l,
+		out:             out,
+		linesStartAt1:   true,
+		columnsStartAt1: true,
+		breakpoints:     map[lsp.DocumentURI][]int{},
+	}
+}
+
+func (s *server) send(msg interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	switch m := msg.(type) {
+	case *response:
+		m.Seq, m.Type = s.seq, "response"
+	case *event:
+		m.Seq, m.Type = s.seq, "event"
+	}
+	return lspsrv.WriteMessage(s.l, s.out, msg)
+}
+
+func (s *server) sendEvent(name string, body interface{}) error {
+	return s.send(&event{Event: name, Body: body})
+}
+
+func (s *server) handle(req *request) error {
+	// a running program reports its termination once aborted
+	terminated := req.Command == "terminate" && !s.isRunning()
+	body, err := s.dispatch(req)
+	res := &response{RequestSeq: req.Seq, Command: req.Command, Success: err == nil, Body: body}
+	if err != nil {
+		s.l.Error("request failed", zap.String("command", req.Command), zap.Error(err))
+		res.Message = err.Error()
+	}
+	if err := s.send(res); err != nil {
+		return errors.Wrap(err, "send response")
+	}
+
+	if err != nil {
+		return nil
+	}
+	switch req.Command {
+	case "initialize":
+		// the client sends the breakpoints and the launch once initialized
+		return s.sendEvent("initialized", nil)
+	case "launch":
+		return s.start()
+	case "configurationDone":
+		s.configured = true
+		return s.start()
+	case "terminate":
+		if terminated {
+			return s.sendEvent("terminated", nil)
+		}
+	case "disconnect":
+		s.exit = true
+	}
+	return nil
+}
+
+func (s *server) isRunning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+func (s *server) dispatch(req *request) (interface{}, error) {
+	unmarshal := func(v interface{}) error {
+		if len(req.Arguments) == 0 {
+			return nil
+		}
+		return errors.Wrap(json.Unmarshal(req.Arguments, v), "unmarshal arguments")
+	}
+
+	switch req.Command {
+	case "initialize":
+		var args initializeArguments
+		if err := unmarshal(&args); err != nil {
+			return nil, err
+		}
+		if args.LinesStartAt1 != nil {
+			s.linesStartAt1 = *args.LinesStartAt1
+		}
+		if args.ColumnsStartAt1 != nil {
+			s.columnsStartAt1 = *args.ColumnsStartAt1
+		}
+		return &capabilities{
+			SupportsConfigurationDoneRequest: true,
+			SupportsEvaluateForHovers:        true,
+			SupportsTerminateRequest:         true,
+		}, nil
+	case "launch":
+		var args launchArguments
+		if err := unmarshal(&args); err != nil {
+			return nil, err
+		}
+		return nil, s.load(&args)
+	case "setBreakpoints":
+		var args setBreakpointsArguments
+		if err := unmarshal(&args); err != nil {
+			return nil, err
+		}
+		return s.setBreakpoints(&args)
+	case "configurationDone", "pause":
+		if req.Command == "pause" && s.debugger != nil {
+			s.debugger.Pause()
+		}
+		return nil, nil
+	case "threads":
+		return map[string]interface{}{"threads": []thread{{ID: threadID, Name: "main"}}}, nil
+	case "stackTrace":
+		var args stackTraceArguments
+		if err := unmarshal(&args); err != nil {
+			return nil, err
+		}
+		return s.stackTrace(&args), nil
+	case "scopes":
+		var args scopesArguments
+		if err := unmarshal(&args); err != nil {
+			return nil, err
+		}
+		return s.scopes(args.FrameID)
+	case "variables":
+		var args variablesArguments
+		if err := unmarshal(&args); err != nil {
+			return nil, err
+		}
+		return s.variablesOf(args.VariablesReference)
+	case "evaluate":
+		var args evaluateArguments
+		if err := unmarshal(&args); err != nil {
+			return nil, err
+		}
+		return s.evaluate(&args)
+	case "continue", "next", "stepIn", "stepOut":
+		if s.debugger == nil {
+			return nil, errors.New("no program launched")
+		}
+		step := map[string]clls.DebugStep{
+			"continue": clls.DebugContinue,
+			"next":     clls.DebugStepOver,
+			"stepIn":   clls.DebugStepIn,
+			"stepOut":  clls.DebugStepOut,
+		}[req.Command]
+		if err := s.run(step); err != nil {
+			return nil, err
+		}
+		if req.Command == "continue" {
+			return map[string]interface{}{"allThreadsContinued": true}, nil
+		}
+		return nil, nil
+	case "disconnect", "terminate":
+		if s.debugger != nil {
+			s.debugger.Close()
+		}
+		return nil, nil
+	}
+	return nil, errors.Errorf("unsupported command '%s'", req.Command)
+}
+
+func readFileFromDisk(u lsp.DocumentURI) (string, error) {
+	b, err := ioutil.ReadFile(u.Filename())
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// projectConfigName is the project config file of the language server, the include dirs it lists are relative to it
+const projectConfigName = "clls.json"
+
+// includeDirs returns the include dirs of the launch, relative to the program directory, then those of the
+// nearest project config in the program directory or above
+func includeDirs(program string, launchDirs []string) ([]string, error) {
+	dir := filepath.Dir(program)
+	dirs := absDirs(dir, launchDirs)
+	for {
+		p := filepath.Join(dir, projectConfigName)
+		b, err := ioutil.ReadFile(p)
+		if err == nil {
+			cfg := struct {
+				IncludeDirs []string `json:"includeDirs"`
+			}{}
+			if err := json.Unmarshal(b, &cfg); err != nil {
+				return nil, errors.Wrapf(err, "parse %s", p)
+			}
+			return append(dirs, absDirs(dir, cfg.IncludeDirs)...), nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, errors.Wrapf(err, "read %s", p)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dirs, nil
+		}
+		dir = parent
+	}
+}
+
+// absDirs makes the relative directories relative to base
+func absDirs(base string, dirs []string) []string {
+	r := make([]string, len(dirs))
+	for i, d := range dirs {
+		if filepath.IsAbs(d) {
+			r[i] = d
+		} else {
+			r[i] = filepath.Join(base, d)
+		}
+	}
+	return r
+}
+
+// load compiles the launched program, it starts running once the client is done configuring breakpoints
+func (s *server) load(args *launchArguments) error {
+	p, err := filepath.Abs(args.Program)
+	if err != nil {
+		return errors.Wrap(err, "get absolute path")
+	}
+	dirs, err := includeDirs(p, args.IncludeDirs)
+	if err != nil {
+		return err
+	}
+	loader := &clls.Loader{Logger: s.l, ReadFile: readFileFromDisk, IncludeDirs: dirs}
+	mod, err := loader.Load(uri.File(p))
+	if err != nil {
+		return errors.Wrapf(err, "load %s", args.Program)
+	}
+	prog, err := mod.Compile()
+	if err != nil {
+		return errors.Wrapf(err, "compile %s", args.Program)
+	}
+	solution := clvm.Nil
+	if args.Solution != "" {
+		if solution, err = clvm.Assemble(args.Solution); err != nil {
+			return errors.Wrap(err, "assemble solution")
+		}
+	}
+	s.debugger = prog.Debug(solution, args.MaxCost)
+	for u, lines := range s.breakpoints {
+		s.debugger.SetBreakpoints(u, lines)
+	}
+	s.launch = args
+	return nil
+}
+
+func (s *server) start() error {
+	if !s.configured || s.launch == nil {
+		return nil
+	}
+	step := clls.DebugContinue
+	if s.launch.StopOnEntry {
+		step = clls.DebugStepIn
+	}
+	return s.run(step)
+}
+
+// run resumes the program in the background
+func (s *server) run(step clls.DebugStep) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return errors.New("the program is running")
+	}
+	s.running = true
+	go s.resume(step)
+	return nil
+}
+
+// resume runs the program until its next stop and reports it to the client
+func (s *server) resume(step clls.DebugStep) {
+	stop := s.debugger.Resume(step)
+
+	s.mu.Lock()
+	s.running = false
+	s.stop = stop
+	s.variables = nil
+	s.mu.Unlock()
+
+	err := func() error {
+		if !stop.Done {
+			body := &stoppedEventBody{Reason: stop.Reason, ThreadID: threadID, AllThreadsStopped: true}
+			if stop.Err != nil {
+				body.Description, body.Text = "evaluation failed", stop.Err.Error()
+			}
+			return s.sendEvent("stopped", body)
+		}
+
+		exitCode := 0
+		if stop.Err != nil {
+			exitCode = 1
+			if err := s.sendEvent("output", &outputEventBody{Category: "stderr", Output: fmt.Sprintf("error: %s\n", stop.Err)}); err != nil {
+				return err
+			}
+		} else if err := s.sendEvent("output", &outputEventBody{Category: "stdout", Output: fmt.Sprintf("%s\ncost: %d\n", stop.Result, stop.Cost)}); err != nil {
+			return err
+		}
+		if err := s.sendEvent("exited", &exitedEventBody{ExitCode: exitCode}); err != nil {
+			return err
+		}
+		return s.sendEvent("terminated", nil)
+	}()
+	if err != nil {
+		s.l.Error("report stop", zap.Error(err))
+	}
+}
+
+func (s *server) setBreakpoints(args *setBreakpointsArguments) (interface{}, error) {
+	p, err := filepath.Abs(args.Source.Path)
+	if err != nil {
+		return nil, errors.Wrap(err, "get absolute path")
+	}
+	u := uri.File(p)
+	lines := make([]int, len(args.Breakpoints))
+	for i, bp := range args.Breakpoints {
+		lines[i] = s.fromClientLine(bp.Line)
+	}
+
+	verified := make([]bool, len(lines))
+	if s.debugger != nil {
+		verified = s.debugger.SetBreakpoints(u, lines)
+	} else {
+		s.breakpoints[u] = lines
+	}
+	bps := make([]breakpoint, len(lines))
+	for i, bp := range args.Breakpoints {
+		bps[i] = breakpoint{Verified: verified[i], Line: bp.Line, Source: &args.Source}
+		if !verified[i] && s.debugger != nil {
+			bps[i].Message = "no code on this line"
+		}
+	}
+	return map[string]interface{}{"breakpoints": bps}, nil
+}
+
+func (s *server) fromClientLine(l int) int {
+	if s.linesStartAt1 {
+		return l - 1
+	}
+	return l
+}
+
+func (s *server) toClientLine(l int) int {
+	if s.linesStartAt1 {
+		return l + 1
+	}
+	return l
+}
+
+func (s *server) toClientColumn(c int) int {
+	if s.columnsStartAt1 {
+		return c + 1
+	}
+	return c
+}
+
+// frames returns the frames of the last stop, ids are their index plus one
+func (s *server) frames() []*clls.DebugFrame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop == nil || s.stop.Done {
+		return nil
+	}
+	return s.stop.Frames
+}
+
+func (s *server) frame(id int) (*clls.DebugFrame, error) {
+	frames := s.frames()
+	if id < 1 || id > len(frames) {
+		return nil, errors.Errorf("unknown frame %d", id)
+	}
+	return frames[id-1], nil
+}
+
+func (s *server) stackTrace(args *stackTraceArguments) interface{} {
+	frames := s.frames()
+	sfs := []stackFrame{}
+	for i, f := range frames {
+		if i < args.StartFrame || (args.Levels > 0 && len(sfs) >= args.Levels) {
+			continue
+		}
+		sf := stackFrame{ID: i + 1, Name: f.Name}
+		if t := f.Token; t != nil {
+			sf.Source = &source{Name: filepath.Base(t.DocumentURI.Filename()), Path: t.DocumentURI.Filename()}
+			sf.Line, sf.Column = s.toClientLine(t.Line), s.toClientColumn(t.StartChar)
+			sf.EndLine, sf.EndColumn = s.toClientLine(t.EndLine()), s.toClientColumn(t.EndChar())
+		}
+		sfs = append(sfs, sf)
+	}
+	return map[string]interface{}{"stackFrames": sfs, "totalFrames": len(frames)}
+}
+
+// reference registers variables listed by a later variables request, the registry is reset at each stop
+func (s *server) reference(vars func() []variable) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.variables = append(s.variables, vars)
+	return len(s.variables)
+}
+
+// valueVariable describes a value, pairs can be expanded into their list items
+func (s *server) valueVariable(name string, v *clvm.Value) variable {
+	vr := variable{Name: name, Value: v.String()}
+	if !v.IsPair() {
+		return vr
+	}
+	vr.VariablesReference = s.reference(func() []variable {
+		items := []variable(nil)
+		i := 0
+		for ; v.IsPair(); v = v.Rest {
+			items = append(items, s.valueVariable(fmt.Sprintf("[%d]", i), v.First))
+			i++
+		}
+		if !v.IsNil() {
+			items = append(items, s.valueVariable(".", v))
+		}
+		return items
+	})
+	return vr
+}
+
+func (s *server) scopes(frameID int) (interface{}, error) {
+	f, err := s.frame(frameID)
+	if err != nil {
+		return nil, err
+	}
+	params := func() []variable {
+		vars := []variable{}
+		for _, p := range f.Params {
+			v, err := f.Value(p.Name)
+			if err != nil {
+				vars = append(vars, variable{Name: p.Name, Value: err.Error()})
+				continue
+			}
+			vars = append(vars, s.valueVariable(p.Name, v))
+		}
+		return vars
+	}
+	env := func() []variable {
+		return []variable{s.valueVariable("env", f.Env)}
+	}
+	return map[string]interface{}{"scopes": []scope{
+		{Name: "Parameters", VariablesReference: s.reference(params)},
+		{Name: "Environment", VariablesReference: s.reference(env)},
+	}}, nil
+}
+
+func (s *server) variablesOf(ref int) (interface{}, error) {
+	s.mu.Lock()
+	if ref < 1 || ref > len(s.variables) {
+		s.mu.Unlock()
+		return nil, errors.Errorf("unknown variables reference %d", ref)
+	}
+	vars := s.variables[ref-1]
+	s.mu.Unlock()
+	return map[string]interface{}{"variables": vars()}, nil
+}
+
+// evaluate returns the value of a parameter of the frame
+func (s *server) evaluate(args *evaluateArguments) (interface{}, error) {
+	f, err := s.frame(args.FrameID)
+	if err != nil {
+		return nil, err
+	}
+	v, err := f.Value(args.Expression)
+	if err != nil {
+		return nil, err
+	}
+	vr := s.valueVariable(args.Expression, v)
+	return map[string]interface{}{"result": vr.Value, "variablesReference": vr.VariablesReference}, nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/clls-dev/clls/pkg/lspsrv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// message is any adapter message, the body is decoded by the tests
+type message struct {
+	Type       string          `json:"type"`
+	Command    string          `json:"command"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+type testClient struct {
+	t       *testing.T
+	w       io.WriteCloser
+	msgs    chan *message
+	done    chan error
+	pending []*message
+	seq     int
+}
+
+func startServer(t *testing.T) *testClient {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &testClient{t: t, w: inW, msgs: make(chan *message, 100), done: make(chan error, 1)}
+	go func() {
+		err := serve(zap.NewNop(), inR, outW)
+		outW.Close()
+		c.done <- err
+	}()
+	go func() {
+		defer close(c.msgs)
+		for {
+			b, err := lspsrv.ReadMessage(zap.NewNop(), outR)
+			if err != nil {
+				return
+			}
+			var msg message
+			if !assert.NoError(t, json.Unmarshal(b, &msg)) {
+				return
+			}
+			c.msgs <- &msg
+		}
+	}()
+	t.Cleanup(func() {
+		inW.Close()
+		outR.Close()
+	})
+	return c
+}
+
+func (c *testClient) request(command string, args interface{}) int {
+	c.seq++
+	require.NoError(c.t, lspsrv.WriteMessage(zap.NewNop(), c.w, map[string]interface{}{
+		"seq": c.seq, "type": "request", "command": command, "arguments": args,
+	}))
+	return c.seq
+}
+
+// waitFor returns the first message matching, the others are kept for the next calls since events can precede responses
+func (c *testClient) waitFor(match func(*message) bool) *message {
+	for i, msg := range c.pending {
+		if match(msg) {
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			return msg
+		}
+	}
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case msg, ok := <-c.msgs:
+			require.True(c.t, ok, "connection closed")
+			if match(msg) {
+				return msg
+			}
+			c.pending = append(c.pending, msg)
+		case <-timeout:
+			require.FailNow(c.t, "timeout")
+		}
+	}
+}
+
+// call sends a request and decodes the body of its successful response
+func (c *testClient) call(command string, args interface{}, body interface{}) {
+	seq := c.request(command, args)
+	res := c.waitFor(func(msg *message) bool { return msg.Type == "response" && msg.RequestSeq == seq })
+	require.True(c.t, res.Success, "%s: %s", command, res.Message)
+	require.Equal(c.t, command, res.Command)
+	if body != nil {
+		require.NoError(c.t, json.Unmarshal(res.Body, body))
+	}
+}
+
+func (c *testClient) event(name string, body interface{}) {
+	ev := c.waitFor(func(msg *message) bool { return msg.Type == "event" && msg.Event == name })
+	if body != nil {
+		require.NoError(c.t, json.Unmarshal(ev.Body, body))
+	}
+}
+
+// next returns the next message in the order it was sent
+func (c *testClient) next() *message {
+	return c.waitFor(func(*message) bool { return true })
+}
+
+func TestDebugSession(t *testing.T) {
+	// the program includes a library found through the include dirs of the project config
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "clls.json"), []byte(`{"includeDirs": ["lib"]}`), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "lib"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "lib", "double.clib"), []byte(`(
+  (defun double (x)
+    (* x 2))
+)`), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "src"), 0755))
+	program := filepath.Join(dir, "src", "main.clvm")
+	require.NoError(t, ioutil.WriteFile(program, []byte(`(mod (A)
+  (include double.clib)
+  (double A)
+)`), 0644))
+	lib := filepath.Join(dir, "lib", "double.clib")
+
+	c := startServer(t)
+	seq := c.request("initialize", map[string]interface{}{"adapterID": "chialisp"})
+	res := c.next()
+	require.Equal(t, "response", res.Type, "the response comes before the initialized event")
+	require.Equal(t, seq, res.RequestSeq)
+	caps := capabilities{}
+	require.NoError(t, json.Unmarshal(res.Body, &caps))
+	require.True(t, caps.SupportsConfigurationDoneRequest)
+	ev := c.next()
+	require.Equal(t, "event", ev.Type)
+	require.Equal(t, "initialized", ev.Event)
+
+	// the breakpoints come before the launch, they are checked once the program is loaded
+	bps := struct{ Breakpoints []breakpoint }{}
+	c.call("setBreakpoints", &setBreakpointsArguments{Source: source{Path: lib}, Breakpoints: []sourceBreakpoint{{Line: 3}}}, &bps)
+	require.Len(t, bps.Breakpoints, 1)
+	c.call("configurationDone", nil, nil)
+	c.call("launch", &launchArguments{Program: program, Solution: "(21)"}, nil)
+
+	stopped := stoppedEventBody{}
+	c.event("stopped", &stopped)
+	require.Equal(t, "breakpoint", stopped.Reason)
+	require.Equal(t, threadID, stopped.ThreadID)
+
+	trace := struct{ StackFrames []stackFrame }{}
+	c.call("stackTrace", &stackTraceArguments{}, &trace)
+	require.NotEmpty(t, trace.StackFrames)
+	require.Equal(t, 3, trace.StackFrames[0].Line)
+	require.Equal(t, lib, trace.StackFrames[0].Source.Path)
+
+	c.call("setBreakpoints", &setBreakpointsArguments{Source: source{Path: program}, Breakpoints: []sourceBreakpoint{{Line: 3}, {Line: 5}}}, &bps)
+	require.Len(t, bps.Breakpoints, 2)
+	require.True(t, bps.Breakpoints[0].Verified)
+	require.False(t, bps.Breakpoints[1].Verified)
+	require.Equal(t, "no code on this line", bps.Breakpoints[1].Message)
+
+	c.call("continue", &map[string]int{"threadId": threadID}, nil)
+	output := outputEventBody{}
+	c.event("output", &output)
+	require.Equal(t, "stdout", output.Category)
+	require.Regexp(t, `^42\ncost: \d+\n$`, output.Output)
+	exited := exitedEventBody{ExitCode: -1}
+	c.event("exited", &exited)
+	require.Equal(t, 0, exited.ExitCode)
+	c.event("terminated", nil)
+
+	c.call("disconnect", nil, nil)
+	select {
+	case err := <-c.done:
+		require.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		require.FailNow(t, "serve did not return after disconnect")
+	}
+}
+
+func TestTerminate(t *testing.T) {
+	c := startServer(t)
+	c.call("initialize", nil, nil)
+	c.event("initialized", nil)
+
+	// nothing runs, the termination is reported after the response
+	seq := c.request("terminate", nil)
+	res := c.next()
+	require.Equal(t, "response", res.Type)
+	require.Equal(t, seq, res.RequestSeq)
+	require.True(t, res.Success)
+	ev := c.next()
+	require.Equal(t, "event", ev.Type)
+	require.Equal(t, "terminated", ev.Event)
+}
+
+func TestIncludeDirs(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "clls.json"), []byte(`{"includeDirs": ["lib", "/abs"]}`), 0644))
+	program := filepath.Join(dir, "src", "puzzles", "main.clvm")
+	dirs, err := includeDirs(program, []string{"../include"})
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "src", "include"), filepath.Join(dir, "lib"), "/abs"}, dirs)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "clls.json"), []byte(`{`), 0644))
+	_, err = includeDirs(program, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "parse "+filepath.Join(dir, "clls.json"))
+}
+
+func TestFailedRequests(t *testing.T) {
+	c := startServer(t)
+	for command, msg := range map[string]string{
+		"restartFrame": "unsupported command 'restartFrame'",
+		"continue":     "no program launched",
+	} {
+		seq := c.request(command, nil)
+		res := c.waitFor(func(msg *message) bool { return msg.Type == "response" && msg.RequestSeq == seq })
+		require.False(t, res.Success, command)
+		require.Equal(t, msg, res.Message, command)
+	}
+}
@@ -16,9 +16,18 @@ type SemanticTokensOptions struct {
 	Full   interface{}              `json:"full,omitempty"`
 }
 
-func (s *server) Initialize(context.Context, *lsp.InitializeParams) (*lsp.InitializeResult, error) {
+func (s *server) Initialize(_ context.Context, params *lsp.InitializeParams) (*lsp.InitializeResult, error) {
+	s.roots = workspaceRoots(params)
+	s.clientCapabilities(params.Capabilities)
+	s.setClientTrace(params.Trace)
+	s.loadProjectConfig()
+	if params.InitializationOptions != nil {
+		if err := s.applyClientSettings(params.InitializationOptions); err != nil {
+			s.showError("apply initialization options", err)
+		}
+	}
 	caps := lsp.ServerCapabilities{
-		TextDocumentSync: lsp.TextDocumentSyncKindFull,
+		TextDocumentSync: lsp.TextDocumentSyncKindIncremental,
 		SemanticTokensProvider: SemanticTokensOptions{
 			Legend: clls.StandardSemanticTokensLegend,
 			Full:   true,
@@ -28,6 +37,20 @@ func (s *server) Initialize(context.Context, *lsp.InitializeParams) (*lsp.Initia
 		DocumentHighlightProvider:  true,
 		ReferencesProvider:         true,
 		DefinitionProvider:         true,
+		HoverProvider:              true,
+		CodeLensProvider:           &lsp.CodeLensOptions{},
+		DocumentSymbolProvider:     true,
+		WorkspaceSymbolProvider:    true,
+		FoldingRangeProvider:       true,
+		CallHierarchyProvider:      true,
+		DocumentLinkProvider:       &lsp.DocumentLinkOptions{},
+		SignatureHelpProvider: &lsp.SignatureHelpOptions{
+			TriggerCharacters: []string{"(", " "},
+		},
+		CompletionProvider: &lsp.CompletionOptions{
+			ResolveProvider:   true,
+			TriggerCharacters: []string{"("},
+		},
 	}
 	s.l.Debug("server initialized", zap.Any("capabilities", caps))
 	return &lsp.InitializeResult{
@@ -39,31 +62,79 @@ func (s *server) Initialize(context.Context, *lsp.InitializeParams) (*lsp.Initia
 
 }
 
-func (s *server) DidOpen(_ context.Context, params *lsp.DidOpenTextDocumentParams) error {
+func (s *server) DidOpen(ctx context.Context, params *lsp.DidOpenTextDocumentParams) error {
 	docData := newDocumentData(params.TextDocument.Text)
+	s.mu.Lock()
 	if pulled, ok := s.cache.pull(docData.contentHash); ok {
 		s.openedDocs[params.TextDocument.URI] = pulled
-		return nil
+	} else {
+		s.openedDocs[params.TextDocument.URI] = docData
 	}
-	s.openedDocs[params.TextDocument.URI] = newDocumentData(params.TextDocument.Text)
-	return nil
+	s.mu.Unlock()
+	if isWorkspaceFile(params.TextDocument.URI) {
+		s.indexFile(ctx, params.TextDocument.URI)
+	}
+	if err := s.publishDiagnostics(ctx, params.TextDocument.URI); err != nil {
+		return err
+	}
+	// the opened content replaces the file in the documents including it
+	return s.documentChanged(ctx, params.TextDocument.URI)
+}
+
+// didChangeParams are the params of textDocument/didChange keeping the content changes without range,
+// which replace the whole text
+type didChangeParams struct {
+	TextDocument   lsp.VersionedTextDocumentIdentifier `json:"textDocument"`
+	ContentChanges []clls.ContentChange                `json:"contentChanges"`
 }
 
-// This only supports full file changes
-func (s *server) DidChange(_ context.Context, params *lsp.DidChangeTextDocumentParams) error {
+// DidChange handles changes decoded by the protocol package, their ranges are always set,
+// the dispatcher decodes the params itself and calls didChange
+func (s *server) DidChange(ctx context.Context, params *lsp.DidChangeTextDocumentParams) error {
+	changes := make([]clls.ContentChange, len(params.ContentChanges))
+	for i := range params.ContentChanges {
+		c := params.ContentChanges[i]
+		changes[i] = clls.ContentChange{Range: &c.Range, Text: c.Text}
+	}
+	return s.didChange(ctx, &didChangeParams{TextDocument: params.TextDocument, ContentChanges: changes})
+}
+
+func (s *server) didChange(ctx context.Context, params *didChangeParams) error {
 	if len(params.ContentChanges) == 0 {
 		return nil
 	}
 
-	docData := newDocumentData(params.ContentChanges[0].Text)
-
-	if edd, ok := s.openedDocs[params.TextDocument.URI]; ok && edd.contentHash == docData.contentHash {
-		return nil // data didn't change
+	if changed, err := s.changeDocument(params); err != nil || !changed {
+		return err
 	}
+	if isWorkspaceFile(params.TextDocument.URI) {
+		s.indexFile(ctx, params.TextDocument.URI)
+	}
+	if err := s.publishDiagnostics(ctx, params.TextDocument.URI); err != nil {
+		return err
+	}
+	return s.documentChanged(ctx, params.TextDocument.URI)
+}
+
+// changeDocument applies the changes to the opened document and tells whether its content changed,
+// the data of a previous content is reused when cached
+func (s *server) changeDocument(params *didChangeParams) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	odd, ok := s.openedDocs[params.TextDocument.URI]
 	if !ok {
-		return errors.New("document not opened")
+		return false, errors.New("document not opened")
+	}
+
+	text, err := clls.ApplyContentChanges(odd.content, params.ContentChanges)
+	if err != nil {
+		return false, errors.Wrap(err, "apply content changes")
+	}
+	docData := newDocumentData(text)
+
+	if odd.contentHash == docData.contentHash {
+		return false, nil // data didn't change
 	}
 
 	delete(s.openedDocs, params.TextDocument.URI)
@@ -71,25 +142,35 @@ func (s *server) DidChange(_ context.Context, params *lsp.DidChangeTextDocumentP
 
 	if pulled, ok := s.cache.pull(docData.contentHash); ok {
 		s.openedDocs[params.TextDocument.URI] = pulled
-		return nil
+	} else {
+		s.openedDocs[params.TextDocument.URI] = docData
 	}
-
-	s.openedDocs[params.TextDocument.URI] = docData
-	return nil
+	return true, nil
 }
 
-func (s *server) DidClose(_ context.Context, params *lsp.DidCloseTextDocumentParams) error {
+func (s *server) DidClose(ctx context.Context, params *lsp.DidCloseTextDocumentParams) error {
+	s.mu.Lock()
 	dd, ok := s.openedDocs[params.TextDocument.URI]
+	if ok {
+		delete(s.openedDocs, params.TextDocument.URI)
+		s.cache.put(dd)
+	}
+	s.mu.Unlock()
 	if !ok {
 		return nil
 	}
-	delete(s.openedDocs, params.TextDocument.URI)
-	s.cache.put(dd)
-	return nil
+	if err := s.notify(lsp.MethodTextDocumentPublishDiagnostics, &lsp.PublishDiagnosticsParams{
+		URI:         params.TextDocument.URI,
+		Diagnostics: []lsp.Diagnostic{},
+	}); err != nil {
+		return err
+	}
+	// the file is read from disk again, its unsaved changes are gone
+	return s.documentChanged(ctx, params.TextDocument.URI)
 }
 
-func (s *server) Rename(_ context.Context, params *lsp.RenameParams) (*lsp.WorkspaceEdit, error) {
-	sym, err := s.symbolAt(params.TextDocument.URI, params.Position)
+func (s *server) Rename(ctx context.Context, params *lsp.RenameParams) (*lsp.WorkspaceEdit, error) {
+	sym, err := s.symbolAt(ctx, params.TextDocument.URI, params.Position)
 	if err != nil {
 		return nil, errors.Wrap(err, "find symbol")
 	}
@@ -132,16 +213,20 @@ func (s *server) Formatting(_ context.Context, params *lsp.DocumentFormattingPar
 	}}, nil
 }
 
-func (s *server) SemanticTokensFull(_ context.Context, params *lsp.SemanticTokensParams) (*lsp.SemanticTokens, error) {
-	if d, ok := s.openedDocs[params.TextDocument.URI]; ok && d.generatedTokens {
-		return &lsp.SemanticTokens{Data: d.semanticTokens}, nil
-	}
-
-	mod, err := s.loadCLVM(params.TextDocument.URI)
+func (s *server) SemanticTokensFull(ctx context.Context, params *lsp.SemanticTokensParams) (*lsp.SemanticTokens, error) {
+	mod, err := s.loadCLVM(ctx, params.TextDocument.URI)
 	if err != nil {
 		return nil, errors.Wrap(err, "parse module")
 	}
 
+	// the document may have changed since its module was loaded
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.openedDocs[params.TextDocument.URI]
+	if ok && d.module == mod && d.generatedTokens {
+		return &lsp.SemanticTokens{Data: d.semanticTokens}, nil
+	}
+
 	data, err := mod.SemanticTokens(s.l)
 	if err != nil {
 		return nil, errors.Wrap(err, "semantic tokens from module")
@@ -149,7 +234,7 @@ func (s *server) SemanticTokensFull(_ context.Context, params *lsp.SemanticToken
 
 	s.l.Debug("generated semantic tokens", zap.Int("count", len(data)/5))
 
-	if d, ok := s.openedDocs[params.TextDocument.URI]; ok {
+	if ok && d.module == mod {
 		d.semanticTokens = data
 		d.generatedTokens = true
 	}
@@ -158,16 +243,27 @@ func (s *server) SemanticTokensFull(_ context.Context, params *lsp.SemanticToken
 }
 
 func (s *server) Shutdown(context.Context) error {
+	s.stopIndexing()
 	s.down = true
 	return nil
 }
 
 func (s *server) Exit(context.Context) error {
+	s.stopIndexing()
 	s.exit = true
 	return nil
 }
 
-func (s *server) Initialized(context.Context, *lsp.InitializedParams) error {
+func (s *server) Initialized(ctx context.Context, _ *lsp.InitializedParams) error {
+	if err := s.registerFileWatchers(); err != nil {
+		s.l.Error("register file watchers", zap.Error(err))
+	}
+	if ok, err := s.pullConfiguration(); err != nil {
+		s.showError("apply settings", err)
+	} else if ok {
+		return s.reload(ctx)
+	}
+	s.startIndexing()
 	return nil
 }
 
@@ -175,8 +271,8 @@ func (s *server) DidSave(context.Context, *lsp.DidSaveTextDocumentParams) error
 	return nil // this is to gracefully ignore the event
 }
 
-func (s *server) DocumentHighlight(_ context.Context, params *lsp.DocumentHighlightParams) ([]lsp.DocumentHighlight, error) {
-	sym, err := s.symbolAt(params.TextDocument.URI, params.Position)
+func (s *server) DocumentHighlight(ctx context.Context, params *lsp.DocumentHighlightParams) ([]lsp.DocumentHighlight, error) {
+	sym, err := s.symbolAt(ctx, params.TextDocument.URI, params.Position)
 	if err != nil {
 		return nil, errors.Wrap(err, "find symbol")
 	}
@@ -198,7 +294,7 @@ func (s *server) DocumentHighlight(_ context.Context, params *lsp.DocumentHighli
 }
 
 func (s *server) References(ctx context.Context, params *lsp.ReferenceParams) ([]lsp.Location, error) {
-	sym, err := s.symbolAt(params.TextDocument.URI, params.Position)
+	sym, err := s.symbolAt(ctx, params.TextDocument.URI, params.Position)
 	if err != nil {
 		return nil, errors.Wrap(err, "find symbol")
 	}
@@ -216,7 +312,15 @@ func (s *server) References(ctx context.Context, params *lsp.ReferenceParams) ([
 }
 
 func (s *server) Definition(ctx context.Context, params *lsp.DefinitionParams) ([]lsp.Location, error) {
-	sym, err := s.symbolAt(params.TextDocument.URI, params.Position)
+	mod, err := s.loadCLVM(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse module")
+	}
+	if loc, ok := mod.IncludeLocation(params.Position); ok {
+		return []lsp.Location{loc}, nil
+	}
+
+	sym, err := s.symbolAt(ctx, params.TextDocument.URI, params.Position)
 	if err != nil {
 		return nil, errors.Wrap(err, "find symbol")
 	}
@@ -227,3 +331,103 @@ func (s *server) Definition(ctx context.Context, params *lsp.DefinitionParams) (
 
 	return []lsp.Location{sym.DefinitionLocation()}, nil
 }
+
+func (s *server) Hover(ctx context.Context, params *lsp.HoverParams) (*lsp.Hover, error) {
+	sym, err := s.symbolAt(ctx, params.TextDocument.URI, params.Position)
+	if err != nil {
+		return nil, errors.Wrap(err, "find symbol")
+	}
+
+	if sym == nil {
+		return nil, nil
+	}
+
+	mod, err := s.loadCLVM(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse module")
+	}
+
+	text := mod.Hover(sym)
+	if text == "" {
+		return nil, nil
+	}
+
+	return &lsp.Hover{Contents: lsp.MarkupContent{Kind: lsp.Markdown, Value: text}}, nil
+}
+
+func (s *server) Completion(ctx context.Context, params *lsp.CompletionParams) (*lsp.CompletionList, error) {
+	mod, err := s.loadCLVM(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse module")
+	}
+
+	items := mod.Completions(params.Position)
+	for i := range items {
+		items[i].Data = params.TextDocument.URI
+	}
+	return &lsp.CompletionList{Items: items}, nil
+}
+
+func (s *server) CompletionResolve(ctx context.Context, item *lsp.CompletionItem) (*lsp.CompletionItem, error) {
+	u, ok := item.Data.(string)
+	if !ok {
+		return item, nil
+	}
+
+	mod, err := s.loadCLVM(ctx, lsp.DocumentURI(u))
+	if err != nil {
+		return nil, errors.Wrap(err, "parse module")
+	}
+
+	mod.ResolveCompletion(item)
+	return item, nil
+}
+
+func (s *server) CodeLens(ctx context.Context, params *lsp.CodeLensParams) ([]lsp.CodeLens, error) {
+	mod, err := s.loadCLVM(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse module")
+	}
+
+	return mod.CodeLenses(), nil
+}
+
+func (s *server) DocumentSymbol(ctx context.Context, params *lsp.DocumentSymbolParams) ([]interface{}, error) {
+	mod, err := s.loadCLVM(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse module")
+	}
+
+	r := []interface{}{}
+	for _, sym := range mod.DocumentSymbols() {
+		r = append(r, sym)
+	}
+	return r, nil
+}
+
+func (s *server) FoldingRanges(ctx context.Context, params *lsp.FoldingRangeParams) ([]lsp.FoldingRange, error) {
+	mod, err := s.loadCLVM(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse module")
+	}
+
+	return mod.FoldingRanges(), nil
+}
+
+func (s *server) SignatureHelp(ctx context.Context, params *lsp.SignatureHelpParams) (*lsp.SignatureHelp, error) {
+	mod, err := s.loadCLVM(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse module")
+	}
+
+	return mod.SignatureHelp(params.Position), nil
+}
+
+func (s *server) DocumentLink(ctx context.Context, params *lsp.DocumentLinkParams) ([]lsp.DocumentLink, error) {
+	mod, err := s.loadCLVM(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse module")
+	}
+
+	return mod.DocumentLinks(), nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	lsp "go.lsp.dev/protocol"
+	"go.uber.org/zap"
+)
+
+func (s *server) PrepareCallHierarchy(ctx context.Context, params *lsp.CallHierarchyPrepareParams) ([]lsp.CallHierarchyItem, error) {
+	mod, err := s.loadCLVM(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse module")
+	}
+
+	return mod.PrepareCallHierarchy(params.Position), nil
+}
+
+// IncomingCalls looks for callers in the item file, the opened documents and the indexed workspace
+// since functions of included files are called from the files including them
+func (s *server) IncomingCalls(ctx context.Context, params *lsp.CallHierarchyIncomingCallsParams) ([]lsp.CallHierarchyIncomingCall, error) {
+	uris := []lsp.DocumentURI{params.Item.URI}
+	s.mu.Lock()
+	for u := range s.openedDocs {
+		uris = append(uris, u)
+	}
+	uris = append(uris, s.symbols.Files()...)
+	s.mu.Unlock()
+
+	r := []lsp.CallHierarchyIncomingCall{}
+	seenFiles := map[lsp.DocumentURI]struct{}{}
+	seenCalls := map[string]struct{}{}
+	for _, u := range uris {
+		if _, ok := seenFiles[u]; ok {
+			continue
+		}
+		seenFiles[u] = struct{}{}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		mod, err := s.loadCLVM(ctx, u)
+		if err != nil {
+			s.l.Debug("skip file for incoming calls", zap.Any("uri", u), zap.Error(err))
+			continue
+		}
+		for _, call := range mod.IncomingCalls(params.Item) {
+			// included files are loaded once per includer
+			key := fmt.Sprintf("%s:%d:%d", call.From.URI, call.From.SelectionRange.Start.Line, call.From.SelectionRange.Start.Character)
+			if _, ok := seenCalls[key]; ok {
+				continue
+			}
+			seenCalls[key] = struct{}{}
+			r = append(r, call)
+		}
+	}
+	return r, nil
+}
+
+func (s *server) OutgoingCalls(ctx context.Context, params *lsp.CallHierarchyOutgoingCallsParams) ([]lsp.CallHierarchyOutgoingCall, error) {
+	mod, err := s.loadCLVM(ctx, params.Item.URI)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse module")
+	}
+
+	return mod.OutgoingCalls(params.Item), nil
+}
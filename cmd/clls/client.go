@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	lsp "go.lsp.dev/protocol"
+	"go.uber.org/zap"
+)
+
+// clientCapabilities keeps what the server may ask from the client
+func (s *server) clientCapabilities(caps lsp.ClientCapabilities) {
+	if ws := caps.Workspace; ws != nil {
+		s.semanticTokensRefresh = ws.SemanticTokens != nil && ws.SemanticTokens.RefreshSupport
+		s.configuration = ws.Configuration
+		s.watchRegistration = ws.DidChangeWatchedFiles != nil && ws.DidChangeWatchedFiles.DynamicRegistration
+	}
+	if w := caps.Window; w != nil {
+		s.workDoneProgress = w.WorkDoneProgress
+	}
+}
+
+// showError logs the error and shows it to the user, who would not look at the server logs
+func (s *server) showError(msg string, err error) {
+	s.l.Error(msg, zap.Error(err))
+	if err := s.client.ShowMessage(lsp.MessageTypeError, fmt.Sprintf("clls: %s: %s", msg, err)); err != nil {
+		s.l.Error("show message", zap.Error(err))
+	}
+}
+
+// logMessage adds the message to the client log
+func (s *server) logMessage(typ lsp.MessageType, msg string) {
+	if err := s.client.LogMessage(typ, msg); err != nil {
+		s.l.Error("log message", zap.Error(err))
+	}
+}
+
+// clientCallTimeout bounds the wait for the answers of the client, which may never come
+const clientCallTimeout = 10 * time.Second
+
+// callClient sends a request to the client and waits for its answer until clientCallTimeout or the end of ctx
+func (s *server) callClient(ctx context.Context, method string, params interface{}, result interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, clientCallTimeout)
+	defer cancel()
+	return s.client.Call(ctx, method, params, result)
+}
+
+// progress reports the advance of a long work to the client, it does nothing when the client doesn't support it
+type progress struct {
+	s     *server
+	token *lsp.ProgressToken
+}
+
+// beginProgress reports the start of a long work when the client supports it
+func (s *server) beginProgress(ctx context.Context, title string) *progress {
+	p := &progress{s: s}
+	if !s.workDoneProgress {
+		return p
+	}
+	s.mu.Lock()
+	s.progressTokens++
+	token := lsp.NewProgressToken(fmt.Sprintf("clls-progress-%d", s.progressTokens))
+	s.mu.Unlock()
+
+	if err := s.callClient(ctx, lsp.MethodWorkDoneProgressCreate, &lsp.WorkDoneProgressCreateParams{Token: *token}, nil); err != nil {
+		s.l.Debug("create progress", zap.Error(err))
+		return p
+	}
+	p.token = token
+	if err := s.client.Progress(*token, &lsp.WorkDoneProgressBegin{Kind: lsp.WorkDoneProgressKindBegin, Title: title}); err != nil {
+		s.l.Error("begin progress", zap.Error(err))
+	}
+	return p
+}
+
+func (p *progress) report(message string, percentage uint32) {
+	if p.token == nil {
+		return
+	}
+	if err := p.s.client.Progress(*p.token, &lsp.WorkDoneProgressReport{Kind: lsp.WorkDoneProgressKindReport, Message: message, Percentage: percentage}); err != nil {
+		p.s.l.Error("report progress", zap.Error(err))
+	}
+}
+
+func (p *progress) end(message string) {
+	if p.token == nil {
+		return
+	}
+	if err := p.s.client.Progress(*p.token, &lsp.WorkDoneProgressEnd{Kind: lsp.WorkDoneProgressKindEnd, Message: message}); err != nil {
+		p.s.l.Error("end progress", zap.Error(err))
+	}
+}
+
+// registerFileWatchers asks the client to notify the changes of the chialisp files and project configs
+func (s *server) registerFileWatchers() error {
+	if !s.watchRegistration {
+		return nil
+	}
+	exts := []string(nil)
+	for ext := range workspaceExtensions {
+		exts = append(exts, strings.TrimPrefix(ext, "."))
+	}
+	sort.Strings(exts)
+	watchers := []lsp.FileSystemWatcher{
+		{GlobPattern: "**/*.{" + strings.Join(exts, ",") + "}"},
+		{GlobPattern: "**/" + projectConfigName},
+	}
+	return s.callClient(context.Background(), lsp.MethodClientRegisterCapability, &lsp.RegistrationParams{
+		Registrations: []lsp.Registration{{
+			ID:              "clls-watched-files",
+			Method:          lsp.MethodWorkspaceDidChangeWatchedFiles,
+			RegisterOptions: &lsp.DidChangeWatchedFilesRegistrationOptions{Watchers: watchers},
+		}},
+	}, nil)
+}
+
+// pullConfiguration applies the client settings of the clls section and tells whether the client had any
+func (s *server) pullConfiguration() (bool, error) {
+	if !s.configuration {
+		return false, nil
+	}
+	r := []interface{}(nil)
+	if err := s.callClient(context.Background(), lsp.MethodWorkspaceConfiguration, &lsp.ConfigurationParams{
+		Items: []lsp.ConfigurationItem{{Section: "clls"}},
+	}, &r); err != nil {
+		return false, errors.Wrap(err, "request configuration")
+	}
+	if len(r) == 0 || r[0] == nil {
+		return false, nil
+	}
+	return true, s.applyClientSettings(r[0])
+}
+
+func (s *server) setClientTrace(v lsp.TraceValue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clientTrace = parseTrace(string(v))
+}
+
+func (s *server) SetTrace(_ context.Context, params *lsp.SetTraceParams) error {
+	s.setClientTrace(params.Value)
+	return nil
+}
+
+// traceModes returns the trace mode of the logs and the one asked by the client
+func (s *server) traceModes() (lsp.TraceValue, lsp.TraceValue) {
+	logTrace := lsp.TraceOff
+	if s.logs != nil {
+		logTrace = s.logs.trace()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return logTrace, s.clientTrace
+}
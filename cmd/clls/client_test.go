@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/clls-dev/clls/pkg/lspsrv"
+	"go.uber.org/zap"
+
+	"github.com/stretchr/testify/require"
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+)
+
+// the server requests sent while handling a notification get their responses from the reading loop
+func TestServerRequests(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "main.clvm"), []byte("(mod (A) (defun helper (x) x) (helper A))"), 0644))
+
+	c := startPipeServer(t)
+	c.initialize(&lsp.InitializeParams{
+		RootURI: uri.File(dir),
+		Capabilities: lsp.ClientCapabilities{
+			Workspace: &lsp.WorkspaceClientCapabilities{
+				Configuration:         true,
+				DidChangeWatchedFiles: &lsp.WorkspaceClientCapabilitiesDidChangeWatchedFiles{DynamicRegistration: true},
+			},
+			Window: &lsp.WindowClientCapabilities{WorkDoneProgress: true},
+		},
+	})
+
+	c.reply(lsp.MethodClientRegisterCapability, json.RawMessage("null"))
+	c.reply(lsp.MethodWorkspaceConfiguration, []interface{}{nil})
+	c.reply(lsp.MethodWorkDoneProgressCreate, json.RawMessage("null"))
+	require.Equal(t, []string{"begin Indexing chialisp files", "report 1/1 files 100", "end 1 files"}, c.progress())
+
+	// the workspace was indexed once the client answered
+	res := c.response(c.call(lsp.MethodWorkspaceSymbol, &lsp.WorkspaceSymbolParams{Query: "helper"}))
+	require.Nil(t, res.Error)
+	symbols := []lsp.SymbolInformation(nil)
+	require.NoError(t, json.Unmarshal(res.Result, &symbols))
+	require.Len(t, symbols, 1)
+	require.Equal(t, "helper", symbols[0].Name)
+	c.exit()
+}
+
+// progress returns the progress notifications until the end of the work, as their kind followed by their fields
+func (c *testClient) progress() []string {
+	events := []string(nil)
+	for {
+		msg := c.waitFor(isMethod(lsp.MethodProgress))
+		params := struct {
+			Value struct {
+				Kind       lsp.WorkDoneProgressKind
+				Title      string
+				Message    string
+				Percentage uint32
+			}
+		}{}
+		require.NoError(c.t, json.Unmarshal(msg.Params, &params))
+		v := params.Value
+		event := strings.Join(strings.Fields(fmt.Sprintf("%s %s %s", v.Kind, v.Title, v.Message)), " ")
+		if v.Percentage != 0 {
+			event += fmt.Sprintf(" %d", v.Percentage)
+		}
+		events = append(events, event)
+		if v.Kind == lsp.WorkDoneProgressKindEnd {
+			return events
+		}
+	}
+}
+
+// the workspace is indexed in the background, the requests are answered meanwhile
+func TestBackgroundIndexing(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.clvm", "b.clib"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte("(mod (A) (defun helper (x) x) (helper A))"), 0644))
+	}
+	c := startPipeServer(t)
+	c.initialize(&lsp.InitializeParams{
+		RootURI:      uri.File(dir),
+		Capabilities: lsp.ClientCapabilities{Window: &lsp.WindowClientCapabilities{WorkDoneProgress: true}},
+	})
+	create := c.waitFor(isMethod(lsp.MethodWorkDoneProgressCreate))
+
+	// the indexing waits for the client
+	u := testDocURI(t, "main.clvm")
+	c.notify(lsp.MethodTextDocumentDidOpen, &lsp.DidOpenTextDocumentParams{TextDocument: lsp.TextDocumentItem{
+		URI: u, LanguageID: "chialisp", Version: 1, Text: "(mod (A) (defun foo (X) X) (foo A))",
+	}})
+	require.Contains(t, hoverText(t, c.response(c.hover(u, 0, 29))), "foo")
+
+	require.NoError(t, lspsrv.Reply(zap.NewNop(), c.w, &lspsrv.ResponseMessage{ID: create.ID, Result: json.RawMessage("null")}))
+	require.Equal(t, []string{"begin Indexing chialisp files", "report 1/2 files 50", "report 2/2 files 100", "end 2 files"}, c.progress())
+	res := c.response(c.call(lsp.MethodWorkspaceSymbol, &lsp.WorkspaceSymbolParams{Query: "helper"}))
+	symbols := []lsp.SymbolInformation(nil)
+	require.NoError(t, json.Unmarshal(res.Result, &symbols))
+	require.Len(t, symbols, 2)
+	c.exit()
+}
+
+// the shutdown stops the indexing, which doesn't wait for the client anymore
+func TestIndexingStopsOnShutdown(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	srv := newServer(zap.NewNop(), lspsrv.NewSyncWriter(w))
+	srv.roots = []string{t.TempDir()}
+	srv.workDoneProgress = true
+	srv.startIndexing()
+
+	b, err := lspsrv.ReadMessage(zap.NewNop(), r)
+	require.NoError(t, err)
+	create := message{}
+	require.NoError(t, json.Unmarshal(b, &create))
+	require.Equal(t, lsp.MethodWorkDoneProgressCreate, create.Method)
+	go func() { _, _ = io.Copy(ioutil.Discard, r) }()
+
+	require.NoError(t, srv.Shutdown(context.Background()))
+	require.False(t, srv.client.HandleResponse(&lspsrv.RawRequestMessage{ID: create.ID}), "the call was cancelled")
+}
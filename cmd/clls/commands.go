@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/clls-dev/clls/pkg/clls"
+	"github.com/clls-dev/clls/pkg/clvm"
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"github.com/pkg/errors"
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+)
+
+func readFileFromDisk(u lsp.DocumentURI) (string, error) {
+	b, err := ioutil.ReadFile(u.Filename())
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func fileURI(p string) (lsp.DocumentURI, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", errors.Wrap(err, "get absolute path")
+	}
+	return uri.File(abs), nil
+}
+
+var severityNames = map[lsp.DiagnosticSeverity]string{
+	lsp.DiagnosticSeverityError:       "error",
+	lsp.DiagnosticSeverityWarning:     "warning",
+	lsp.DiagnosticSeverityInformation: "info",
+	lsp.DiagnosticSeverityHint:        "hint",
+}
+
+func checkCommand() *ffcli.Command {
+	flagSet := flag.NewFlagSet("clls check", flag.ExitOnError)
+	addIncludeDirsFlag(flagSet)
+	return &ffcli.Command{
+		Name:       "check",
+		ShortUsage: "clls check [-I <dir>]... <file> [<file>...]",
+		ShortHelp:  "report syntax errors, undefined names and arguments count mismatches",
+		FlagSet:    flagSet,
+		Exec: func(_ context.Context, args []string) error {
+			if len(args) == 0 {
+				return errors.New("missing file path argument")
+			}
+			errorsCount := 0
+			for _, p := range args {
+				u, err := fileURI(p)
+				if err != nil {
+					return err
+				}
+				diags := []lsp.Diagnostic(nil)
+				mod, err := newLoader().Load(u)
+				if err != nil {
+					diags = append(diags, clls.ErrorDiagnostic(err))
+				} else {
+					diags = mod.Diagnostics()
+				}
+				for _, d := range diags {
+					if d.Severity == lsp.DiagnosticSeverityError {
+						errorsCount++
+					}
+					fmt.Printf("%s:%d:%d: %s: %s\n", p, d.Range.Start.Line+1, d.Range.Start.Character+1, severityNames[d.Severity], d.Message)
+				}
+			}
+			if errorsCount > 0 {
+				return fmt.Errorf("found %d error(s)", errorsCount)
+			}
+			return nil
+		},
+	}
+}
+
+// loadModule loads the module of a file given on the command line
+func loadModule(p string) (*clls.Module, error) {
+	u, err := fileURI(p)
+	if err != nil {
+		return nil, err
+	}
+	mod, err := newLoader().Load(u)
+	if err != nil {
+		return nil, errors.Wrapf(err, "load %s", p)
+	}
+	return mod, nil
+}
+
+func compileCommand() *ffcli.Command {
+	flagSet := flag.NewFlagSet("clls compile", flag.ExitOnError)
+	addIncludeDirsFlag(flagSet)
+	return &ffcli.Command{
+		Name:       "compile",
+		ShortUsage: "clls compile [-I <dir>]... <file>",
+		ShortHelp:  "compile a chialisp mod to CLVM",
+		FlagSet:    flagSet,
+		Exec: func(_ context.Context, args []string) error {
+			if len(args) != 1 {
+				return errors.New("expected exactly one file path argument")
+			}
+			mod, err := loadModule(args[0])
+			if err != nil {
+				return err
+			}
+			prog, err := mod.Compile()
+			if err != nil {
+				return errors.Wrapf(err, "compile %s", args[0])
+			}
+			fmt.Println(prog.Code)
+			return nil
+		},
+	}
+}
+
+func hashCommand() *ffcli.Command {
+	flagSet := flag.NewFlagSet("clls hash", flag.ExitOnError)
+	addIncludeDirsFlag(flagSet)
+	expr := flagSet.Bool("expr", false, "hash a CLVM s-expression read from the arguments or stdin, such as a part of a compiled program, instead of files")
+	return &ffcli.Command{
+		Name:       "hash",
+		ShortUsage: "clls hash [-I <dir>]... <file> [<file>...] | clls hash -expr [<s-expression>]",
+		ShortHelp:  "print the sha256tree hash of compiled chialisp mods or of a CLVM value",
+		FlagSet:    flagSet,
+		Exec: func(_ context.Context, args []string) error {
+			if *expr {
+				text, err := readInput(args)
+				if err != nil {
+					return err
+				}
+				v, err := clvm.Assemble(string(text))
+				if err != nil {
+					return errors.Wrap(err, "assemble")
+				}
+				fmt.Printf("0x%x\n", v.TreeHash())
+				return nil
+			}
+			if len(args) == 0 {
+				return errors.New("missing file path argument")
+			}
+			for _, p := range args {
+				mod, err := loadModule(p)
+				if err != nil {
+					return err
+				}
+				prog, err := mod.Compile()
+				if err != nil {
+					return errors.Wrapf(err, "compile %s", p)
+				}
+				h := prog.Code.TreeHash()
+				if len(args) == 1 {
+					fmt.Printf("0x%x\n", h)
+				} else {
+					fmt.Printf("%s: 0x%x\n", p, h)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// stringsFlag collects the values of a flag given several times
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *stringsFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
+// parseInterspersed parses the flags given after the first positional arguments, the flag package stops at the
+// first one, and returns the positional arguments
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string(nil)
+	for len(args) > 0 {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) > 0 {
+			positional = append(positional, args[0])
+			args = args[1:]
+		}
+	}
+	return positional, nil
+}
+
+func curryCommand() *ffcli.Command {
+	flagSet := flag.NewFlagSet("clls curry", flag.ExitOnError)
+	addIncludeDirsFlag(flagSet)
+	args := stringsFlag(nil)
+	flagSet.Var(&args, "arg", "value of the next curried parameter, optionally prefixed by its name as in NAME=value")
+	asHex := flagSet.Bool("hex", false, "print the serialized curried program instead of its s-expression")
+	return &ffcli.Command{
+		Name:       "curry",
+		ShortUsage: "clls curry [-I <dir>]... [-arg <value>]... [-hex] <file>",
+		ShortHelp:  "curry values into the uppercase parameters of a mod and print the result and its tree hash",
+		FlagSet:    flagSet,
+		Exec: func(_ context.Context, fargs []string) error {
+			fargs, err := parseInterspersed(flagSet, fargs)
+			if err != nil {
+				return err
+			}
+			if len(fargs) != 1 {
+				return errors.New("expected exactly one file path argument")
+			}
+			mod, err := loadModule(fargs[0])
+			if err != nil {
+				return err
+			}
+			values, err := mod.CurryArgs(args)
+			if err != nil {
+				return errors.Wrap(err, "check arguments")
+			}
+			prog, err := mod.Compile()
+			if err != nil {
+				return errors.Wrapf(err, "compile %s", fargs[0])
+			}
+			curried := clvm.Curry(prog.Code, values...)
+			if *asHex {
+				h, err := curried.Hex()
+				if err != nil {
+					return errors.Wrap(err, "serialize")
+				}
+				fmt.Println(h)
+			} else {
+				fmt.Println(curried)
+			}
+			fmt.Printf("0x%x\n", curried.TreeHash())
+			return nil
+		},
+	}
+}
+
+func uncurryCommand() *ffcli.Command {
+	flagSet := flag.NewFlagSet("clls uncurry", flag.ExitOnError)
+	addIncludeDirsFlag(flagSet)
+	modPath := flagSet.String("mod", "", "chialisp file of the expected mod, used to check the program and name the arguments")
+	return &ffcli.Command{
+		Name:       "uncurry",
+		ShortUsage: "clls uncurry [-I <dir>]... [-mod <file>] <hex>",
+		ShortHelp:  "print the mod and the arguments of a serialized curried program",
+		FlagSet:    flagSet,
+		Exec: func(_ context.Context, args []string) error {
+			text, err := readInput(args)
+			if err != nil {
+				return err
+			}
+			program, err := clvm.FromHex(string(text))
+			if err != nil {
+				return errors.Wrap(err, "deserialize")
+			}
+			code, values, ok := clvm.Uncurry(program)
+			if !ok {
+				return errors.New("not a curried program")
+			}
+
+			names := make([]string, len(values))
+			for i := range names {
+				names[i] = fmt.Sprintf("arg%d", i+1)
+			}
+			if *modPath != "" {
+				mod, err := loadModule(*modPath)
+				if err != nil {
+					return err
+				}
+				prog, err := mod.Compile()
+				if err != nil {
+					return errors.Wrapf(err, "compile %s", *modPath)
+				}
+				if prog.Code.TreeHash() != code.TreeHash() {
+					return errors.Errorf("the curried mod is not %s", *modPath)
+				}
+				params := mod.CurriedParams()
+				if len(params) != len(values) {
+					return errors.Errorf("expected %d curried argument(s) %v but got %d", len(params), params, len(values))
+				}
+				copy(names, params)
+			}
+
+			fmt.Println("mod:", code)
+			fmt.Printf("mod hash: 0x%x\n", code.TreeHash())
+			for i, v := range values {
+				fmt.Printf("%s: %s\n", names[i], v)
+			}
+			return nil
+		},
+	}
+}
+
+// readInput returns the arguments joined by spaces or stdin when there is none
+func readInput(args []string) ([]byte, error) {
+	if len(args) > 0 {
+		return []byte(strings.Join(args, " ")), nil
+	}
+	b, err := ioutil.ReadAll(os.Stdin)
+	return b, errors.Wrap(err, "read stdin")
+}
+
+func assembleCommand() *ffcli.Command {
+	flagSet := flag.NewFlagSet("clls assemble", flag.ExitOnError)
+	binary := flagSet.Bool("binary", false, "write raw bytes instead of hex")
+	compress := flagSet.Bool("compress", false, "replace repeated subtrees by backreferences")
+	return &ffcli.Command{
+		Name:       "assemble",
+		ShortUsage: "clls assemble [-binary] [-compress] [<s-expression>]",
+		ShortHelp:  "serialize a CLVM s-expression read from the arguments or stdin",
+		FlagSet:    flagSet,
+		Exec: func(_ context.Context, args []string) error {
+			text, err := readInput(args)
+			if err != nil {
+				return err
+			}
+			v, err := clvm.Assemble(string(text))
+			if err != nil {
+				return errors.Wrap(err, "assemble")
+			}
+			serialize := clvm.Serialize
+			if *compress {
+				serialize = clvm.SerializeCompressed
+			}
+			b, err := serialize(v)
+			if err != nil {
+				return errors.Wrap(err, "serialize")
+			}
+			if *binary {
+				_, err := os.Stdout.Write(b)
+				return errors.Wrap(err, "write stdout")
+			}
+			fmt.Println(hex.EncodeToString(b))
+			return nil
+		},
+	}
+}
+
+func disassembleCommand() *ffcli.Command {
+	flagSet := flag.NewFlagSet("clls disassemble", flag.ExitOnError)
+	binary := flagSet.Bool("binary", false, "read raw bytes from stdin instead of hex")
+	return &ffcli.Command{
+		Name:       "disassemble",
+		ShortUsage: "clls disassemble [-binary] [<hex>]",
+		ShortHelp:  "print the s-expression of a serialized CLVM value read from the arguments or stdin",
+		FlagSet:    flagSet,
+		Exec: func(_ context.Context, args []string) error {
+			var v *clvm.Value
+			if *binary {
+				if len(args) > 0 {
+					return errors.New("binary input is read from stdin")
+				}
+				b, err := readInput(nil)
+				if err != nil {
+					return err
+				}
+				if v, err = clvm.Deserialize(b); err != nil {
+					return errors.Wrap(err, "deserialize")
+				}
+			} else {
+				text, err := readInput(args)
+				if err != nil {
+					return err
+				}
+				if v, err = clvm.FromHex(string(text)); err != nil {
+					return errors.Wrap(err, "deserialize")
+				}
+			}
+			fmt.Println(v)
+			return nil
+		},
+	}
+}
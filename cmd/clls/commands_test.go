@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// captureStdout returns what f prints
+func captureStdout(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	f()
+	require.NoError(t, w.Close())
+	b, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestCurryCommand(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "main.clvm")
+	require.NoError(t, ioutil.WriteFile(file, []byte("(mod (MOD_HASH AMOUNT solution) (list MOD_HASH AMOUNT solution))"), 0644))
+
+	// the flags can come before or after the file path
+	outputs := []string(nil)
+	for _, args := range [][]string{
+		{"-arg", "0xcafef00d", "-arg", "AMOUNT=100", file},
+		{file, "-arg", "0xcafef00d", "-arg", "AMOUNT=100"},
+		{"-arg", "0xcafef00d", file, "--arg", "AMOUNT=100"},
+	} {
+		outputs = append(outputs, captureStdout(t, func() {
+			require.NoError(t, curryCommand().ParseAndRun(context.Background(), args), args)
+		}))
+	}
+	require.Regexp(t, `^\(a \(q .+\) \(c \(q \. 0xcafef00d\) \(c \(q \. 100\) 1\)\)\)\n0x[0-9a-f]{64}\n$`, outputs[0])
+	require.Equal(t, outputs[0], outputs[1])
+	require.Equal(t, outputs[0], outputs[2])
+
+	require.EqualError(t, curryCommand().ParseAndRun(context.Background(), []string{file, "-arg", "1", "other.clvm"}),
+		"expected exactly one file path argument")
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/clls-dev/clls/pkg/clls"
+	"github.com/pkg/errors"
+	lsp "go.lsp.dev/protocol"
+	"go.uber.org/zap"
+)
+
+// projectConfigName is the file at the root of a workspace holding the project settings
+const projectConfigName = "clls.json"
+
+// settings come from the client initializationOptions and workspace/didChangeConfiguration,
+// where they may be nested in a "clls" section, and from the project config file which can't
+// change the logging
+type settings struct {
+	IncludeDirs []string `json:"includeDirs"`
+	logConfig
+}
+
+func parseSettings(v interface{}) (settings, error) {
+	s := settings{}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return s, errors.Wrap(err, "marshal settings")
+	}
+	sections := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &sections); err == nil {
+		if section, ok := sections["clls"]; ok {
+			b = section
+		}
+	}
+	return s, errors.Wrap(json.Unmarshal(b, &s), "unmarshal settings")
+}
+
+// absDirs makes the relative directories relative to base
+func absDirs(base string, dirs []string) []string {
+	r := make([]string, len(dirs))
+	for i, d := range dirs {
+		if filepath.IsAbs(d) || base == "" {
+			r[i] = d
+		} else {
+			r[i] = filepath.Join(base, d)
+		}
+	}
+	return r
+}
+
+// cliIncludeDirs are the -I flags, shared by the server and the subcommands
+var cliIncludeDirs stringsFlag
+
+func addIncludeDirsFlag(fs *flag.FlagSet) {
+	fs.Var(&cliIncludeDirs, "I", "directory searched for included files, can be repeated")
+}
+
+func includeDirsFromFlags() []string {
+	wd, _ := os.Getwd()
+	return absDirs(wd, cliIncludeDirs)
+}
+
+// newLoader returns a loader reading files from disk and searching the -I directories
+func newLoader() *clls.Loader {
+	return &clls.Loader{Logger: zap.NewNop(), ReadFile: readFileFromDisk, IncludeDirs: includeDirsFromFlags()}
+}
+
+// includeDirs returns the directories searched for included files: the client settings first,
+// then the project config files and the command line flags, it is called with s.mu held
+func (s *server) includeDirs() []string {
+	dirs := append([]string(nil), s.clientIncludeDirs...)
+	dirs = append(dirs, s.projectIncludeDirs...)
+	return append(dirs, s.cliIncludeDirs...)
+}
+
+func (s *server) baseDir() string {
+	if len(s.roots) > 0 {
+		return s.roots[0]
+	}
+	return ""
+}
+
+func (s *server) applyClientSettings(v interface{}) error {
+	cfg, err := parseSettings(v)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.clientIncludeDirs = absDirs(s.baseDir(), cfg.IncludeDirs)
+	s.mu.Unlock()
+	if s.logs != nil {
+		if err := s.logs.apply(cfg.logConfig); err != nil {
+			return errors.Wrap(err, "apply log settings")
+		}
+	}
+	return nil
+}
+
+// loadProjectConfig reads the config file of each workspace root, missing files are ignored
+func (s *server) loadProjectConfig() {
+	dirs := []string(nil)
+	for _, root := range s.roots {
+		p := filepath.Join(root, projectConfigName)
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				s.showError("read "+p, err)
+			}
+			continue
+		}
+		cfg := settings{}
+		if err := json.Unmarshal(b, &cfg); err != nil {
+			s.showError("parse "+p, err)
+			continue
+		}
+		dirs = append(dirs, absDirs(root, cfg.IncludeDirs)...)
+	}
+	s.mu.Lock()
+	s.projectIncludeDirs = dirs
+	s.mu.Unlock()
+}
+
+// reload drops everything computed from the files and reloads the opened documents and the index,
+// which is needed when the include dirs change
+func (s *server) reload(ctx context.Context) error {
+	s.stopIndexing() // the files it loads may be resolved differently
+	s.mu.Lock()
+	s.loader = nil
+	s.cache = newDocumentCache(s.cache.size)
+	docs := []lsp.DocumentURI(nil)
+	for u, d := range s.openedDocs {
+		s.openedDocs[u] = newDocumentData(d.content)
+		docs = append(docs, u)
+	}
+	s.symbols = clls.NewSymbolIndex()
+	s.l.Debug("reload", zap.Strings("includeDirs", s.includeDirs()))
+	s.mu.Unlock()
+
+	s.startIndexing()
+	for _, u := range docs {
+		if isWorkspaceFile(u) {
+			s.indexFile(ctx, u)
+		}
+		if err := s.publishDiagnostics(ctx, u); err != nil {
+			return errors.Wrap(err, "publish diagnostics")
+		}
+	}
+	return nil
+}
+
+// DidChangeConfiguration pulls the settings when the client supports it since they may not be pushed
+func (s *server) DidChangeConfiguration(ctx context.Context, params *lsp.DidChangeConfigurationParams) error {
+	if ok, err := s.pullConfiguration(); err != nil {
+		return errors.Wrap(err, "pull settings")
+	} else if ok {
+		return s.reload(ctx)
+	}
+	if params.Settings == nil {
+		return nil
+	}
+	if err := s.applyClientSettings(params.Settings); err != nil {
+		return errors.Wrap(err, "apply settings")
+	}
+	return s.reload(ctx)
+}
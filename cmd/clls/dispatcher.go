@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/clls-dev/clls/pkg/lspsrv"
+	"github.com/pkg/errors"
+	lsp "go.lsp.dev/protocol"
+	"go.uber.org/zap"
+)
+
+// lifecycleMethods are handled once everything received before them is done, nothing runs alongside them
+var lifecycleMethods = map[string]struct{}{
+	"initialize": {},
+	"shutdown":   {},
+	"exit":       {},
+}
+
+// dispatcher handles the notifications one at a time in the order they are received, so the changes
+// of a document apply in order, and the requests concurrently, each starting once the notifications
+// received before it are handled so that it sees their changes
+type dispatcher struct {
+	srv *server
+	out io.Writer
+	l   *zap.Logger
+
+	queueMu  sync.Mutex
+	queue    []func() // unbounded so that the reading loop never blocks on a slow handler
+	closed   bool
+	signal   chan struct{}
+	requests sync.WaitGroup
+
+	mu      sync.Mutex
+	pending map[interface{}]context.CancelFunc // in-flight requests by id
+}
+
+func newDispatcher(l *zap.Logger, srv *server, out io.Writer) *dispatcher {
+	d := &dispatcher{
+		srv:     srv,
+		out:     out,
+		l:       l,
+		signal:  make(chan struct{}, 1),
+		pending: map[interface{}]context.CancelFunc{},
+	}
+	go d.run()
+	return d
+}
+
+// push queues a job without blocking
+func (d *dispatcher) push(job func()) {
+	d.queueMu.Lock()
+	d.queue = append(d.queue, job)
+	d.queueMu.Unlock()
+	d.wake()
+}
+
+func (d *dispatcher) wake() {
+	select {
+	case d.signal <- struct{}{}:
+	default:
+	}
+}
+
+// run runs the queued jobs in order until the dispatcher is closed
+func (d *dispatcher) run() {
+	for {
+		d.queueMu.Lock()
+		if len(d.queue) == 0 {
+			closed := d.closed
+			d.queueMu.Unlock()
+			if closed {
+				return
+			}
+			<-d.signal
+			continue
+		}
+		job := d.queue[0]
+		d.queue[0] = nil
+		d.queue = d.queue[1:]
+		d.queueMu.Unlock()
+		job()
+	}
+}
+
+// wait returns once the queued notifications and the running requests are done
+func (d *dispatcher) wait() {
+	done := make(chan struct{})
+	d.push(func() { close(done) })
+	<-done
+	d.requests.Wait()
+}
+
+func (d *dispatcher) close() {
+	d.wait()
+	d.queueMu.Lock()
+	d.closed = true
+	d.queueMu.Unlock()
+	d.wake()
+}
+
+// dispatch handles a message from the client, it is called by the reading loop only
+func (d *dispatcher) dispatch(req *lspsrv.RawRequestMessage) error {
+	// Cancel an in-flight request, the request replies itself
+	if req.Method == "$/cancelRequest" {
+		params := lsp.CancelParams{}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			d.l.Error("unmarshal cancel params", zap.Error(err))
+			return nil
+		}
+		d.cancel(params.ID)
+		return nil
+	}
+
+	// Ignore requests in shutdown mode
+	if d.srv.down && req.Method != "exit" {
+		if req.ID == nil {
+			return nil
+		}
+		if err := lspsrv.ReplyWithErrorCode(d.l, d.out, req.ID, errors.New("shutdown mode"), lspsrv.InvalidRequest); err != nil {
+			return errors.Wrap(err, "reply to request in shutdown mode")
+		}
+		return nil
+	}
+
+	// Unmarshal params
+	params, err := unmarshalParams(req.Method, req.Params)
+	if err != nil {
+		if req.Method == "initialize" {
+			params = &lsp.InitializeParams{}
+			d.l.Error("unmarshal initialize params", zap.Error(err))
+		} else {
+			if err := lspsrv.ReplyWithError(d.l, d.out, req.ID, errors.Wrap(err, fmt.Sprintf("unmarshal '%s'", req.Method))); err != nil {
+				return errors.Wrap(err, "reply with unmarshal error")
+			}
+			return nil
+		}
+	}
+
+	if _, ok := lifecycleMethods[req.Method]; ok {
+		// Handlers waiting for the client would keep waiting since responses are not read meanwhile
+		if req.Method != "initialize" {
+			d.srv.client.Close()
+		}
+		d.wait()
+		return d.handle(context.Background(), req, params)
+	}
+
+	if req.ID == nil {
+		d.push(func() {
+			if err := d.handle(context.Background(), req, params); err != nil {
+				d.l.Error("handle notification", zap.String("method", req.Method), zap.Error(err))
+			}
+		})
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.mu.Lock()
+	d.pending[req.ID] = cancel
+	d.mu.Unlock()
+	d.requests.Add(1)
+	d.push(func() {
+		go func() {
+			defer d.requests.Done()
+			defer func() {
+				d.mu.Lock()
+				delete(d.pending, req.ID)
+				d.mu.Unlock()
+				cancel()
+			}()
+			if err := d.handle(ctx, req, params); err != nil {
+				d.l.Error("handle request", zap.String("method", req.Method), zap.Error(err))
+			}
+		}()
+	})
+	return nil
+}
+
+func (d *dispatcher) cancel(id interface{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if cancel, ok := d.pending[id]; ok {
+		d.l.Debug("cancel request", zap.Any("id", id))
+		cancel()
+	}
+}
+
+// handle runs the handler and replies, the error is about writing the reply
+func (d *dispatcher) handle(ctx context.Context, req *lspsrv.RawRequestMessage, params interface{}) error {
+	start := time.Now()
+	var reply interface{}
+	err := ctx.Err()
+	if err == nil {
+		reply, err = d.srv.Request(ctx, req.Method, params)
+	}
+	d.trace(req, reply, err, time.Since(start))
+
+	// The result of a cancelled request is not used by the client
+	if ctx.Err() != nil && req.ID != nil {
+		if err := lspsrv.ReplyWithErrorCode(d.l, d.out, req.ID, errors.New("request cancelled"), lspsrv.RequestCancelled); err != nil {
+			return errors.Wrap(err, "reply to cancelled request")
+		}
+		return nil
+	}
+
+	if err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("handle '%s'", req.Method))
+		if req.ID == nil {
+			// Notifications have no reply, the user would not see the error otherwise
+			d.l.Error("notification failed", zap.Error(err))
+			if err := d.srv.client.LogMessage(lsp.MessageTypeError, err.Error()); err != nil {
+				return errors.Wrap(err, "log handle error")
+			}
+			return nil
+		}
+		if err := lspsrv.ReplyWithError(d.l, d.out, req.ID, err); err != nil {
+			return errors.Wrap(err, "reply with handle error")
+		}
+		return nil
+	}
+
+	// Requests without result such as shutdown are answered with null
+	if req.ID != nil {
+		if reply == nil {
+			reply = json.RawMessage("null")
+		}
+		if err := lspsrv.Reply(d.l, d.out, &lspsrv.ResponseMessage{
+			ID:     req.ID,
+			Result: reply,
+		}); err != nil {
+			return errors.Wrap(err, "reply")
+		}
+	}
+	return nil
+}
+
+// trace records the handled message and its handling time in the logs and sends it to the client,
+// as their trace modes ask
+func (d *dispatcher) trace(req *lspsrv.RawRequestMessage, reply interface{}, err error, took time.Duration) {
+	logTrace, clientTrace := d.srv.traceModes()
+	if logTrace == lsp.TraceOff && clientTrace == lsp.TraceOff {
+		return
+	}
+
+	if logTrace != lsp.TraceOff {
+		fields := []zap.Field{zap.String("method", req.Method), zap.Any("id", req.ID), zap.Duration("took", took)}
+		if err != nil {
+			fields = append(fields, zap.Error(err))
+		}
+		if logTrace == lsp.TraceVerbose {
+			fields = append(fields, zap.String("params", string(req.Params)), zap.Any("result", reply))
+		}
+		d.l.Named("trace").Info("handled", fields...)
+	}
+
+	if clientTrace != lsp.TraceOff {
+		msg := fmt.Sprintf("Handled notification '%s' in %s", req.Method, took)
+		if req.ID != nil {
+			msg = fmt.Sprintf("Handled request '%s - (%v)' in %s", req.Method, req.ID, took)
+		}
+		if err != nil {
+			msg += ": " + err.Error()
+		}
+		params := &lsp.LogTraceParams{Message: msg}
+		if clientTrace == lsp.TraceVerbose {
+			result, _ := json.Marshal(reply)
+			// the protocol package mistypes the verbose text
+			params.Verbose = lsp.TraceValue(fmt.Sprintf("Params: %s\n\nResult: %s", req.Params, result))
+		}
+		if err := d.srv.client.Notify(lsp.MethodLogTrace, params); err != nil {
+			d.l.Error("send trace", zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/clls-dev/clls/pkg/lspsrv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+	"go.uber.org/zap"
+)
+
+// outMessage is a message written by the server, a notification or a response
+type outMessage struct {
+	ID     interface{}           `json:"id"`
+	Method string                `json:"method"`
+	Params json.RawMessage       `json:"params"`
+	Result json.RawMessage       `json:"result"`
+	Error  *lspsrv.ResponseError `json:"error"`
+}
+
+// newTestDispatcher returns a dispatcher and the messages it writes
+func newTestDispatcher(t *testing.T) (*dispatcher, <-chan *outMessage) {
+	r, w := io.Pipe()
+	out := lspsrv.NewSyncWriter(w)
+	d := newDispatcher(zap.NewNop(), newServer(zap.NewNop(), out), out)
+	msgs := make(chan *outMessage, 1000)
+	go func() {
+		defer close(msgs)
+		for {
+			b, err := lspsrv.ReadMessage(zap.NewNop(), r)
+			if err != nil {
+				return
+			}
+			msg := &outMessage{}
+			if !assert.NoError(t, json.Unmarshal(b, msg)) {
+				return
+			}
+			msgs <- msg
+		}
+	}()
+	t.Cleanup(func() {
+		d.close()
+		w.Close()
+	})
+	return d, msgs
+}
+
+func dispatchMessage(t *testing.T, d *dispatcher, id interface{}, method string, params interface{}) {
+	raw, err := json.Marshal(params)
+	require.NoError(t, err)
+	require.NoError(t, d.dispatch(&lspsrv.RawRequestMessage{Version: "2.0", ID: id, Method: method, Params: raw}))
+}
+
+func nextMessage(t *testing.T, msgs <-chan *outMessage) *outMessage {
+	select {
+	case msg, ok := <-msgs:
+		require.True(t, ok, "output closed")
+		return msg
+	case <-time.After(10 * time.Second):
+		require.FailNow(t, "timeout")
+		return nil
+	}
+}
+
+func TestDispatcherNotificationOrder(t *testing.T) {
+	d, msgs := newTestDispatcher(t)
+	u := uri.File(filepath.Join(t.TempDir(), "main.clvm"))
+	text := "(mod (A) A)"
+	dispatchMessage(t, d, nil, lsp.MethodTextDocumentDidOpen, &lsp.DidOpenTextDocumentParams{TextDocument: lsp.TextDocumentItem{
+		URI: u, LanguageID: "chialisp", Version: 1, Text: text,
+	}})
+	for i := 0; i < 50; i++ {
+		next := fmt.Sprintf("(mod (A) X%d)", i)
+		dispatchMessage(t, d, nil, lsp.MethodTextDocumentDidChange, &lsp.DidChangeTextDocumentParams{
+			TextDocument: lsp.VersionedTextDocumentIdentifier{TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: u}, Version: int32(i + 2)},
+			ContentChanges: []lsp.TextDocumentContentChangeEvent{{
+				Range: lsp.Range{End: lsp.Position{Character: uint32(len(text))}},
+				Text:  next,
+			}},
+		})
+		text = next
+	}
+	// the request sees the changes received before it
+	dispatchMessage(t, d, float64(1), lsp.MethodTextDocumentFormatting, &lsp.DocumentFormattingParams{TextDocument: lsp.TextDocumentIdentifier{URI: u}})
+
+	require.Equal(t, lsp.MethodTextDocumentPublishDiagnostics, nextMessage(t, msgs).Method)
+	for i := 0; i < 50; i++ {
+		msg := nextMessage(t, msgs)
+		require.Equal(t, lsp.MethodTextDocumentPublishDiagnostics, msg.Method)
+		params := lsp.PublishDiagnosticsParams{}
+		require.NoError(t, json.Unmarshal(msg.Params, &params))
+		require.Len(t, params.Diagnostics, 1)
+		require.Equal(t, fmt.Sprintf("undefined name 'X%d'", i), params.Diagnostics[0].Message)
+	}
+	msg := nextMessage(t, msgs)
+	require.Equal(t, float64(1), msg.ID)
+	require.Nil(t, msg.Error)
+	require.Contains(t, string(msg.Result), "X49")
+}
+
+func TestDispatcherCancel(t *testing.T) {
+	d, msgs := newTestDispatcher(t)
+	// hold the queue so the request is still waiting when cancelled
+	release := make(chan struct{})
+	d.push(func() { <-release })
+
+	dispatchMessage(t, d, float64(1), lsp.MethodWorkspaceSymbol, &lsp.WorkspaceSymbolParams{Query: "a"})
+	dispatchMessage(t, d, nil, "$/cancelRequest", &lsp.CancelParams{ID: float64(1)})
+	dispatchMessage(t, d, nil, "$/cancelRequest", &lsp.CancelParams{ID: float64(2)}) // unknown ids are ignored
+	close(release)
+
+	msg := nextMessage(t, msgs)
+	require.Equal(t, float64(1), msg.ID)
+	require.NotNil(t, msg.Error)
+	require.Equal(t, lspsrv.RequestCancelled, msg.Error.Code)
+
+	// the next requests run normally
+	dispatchMessage(t, d, float64(3), lsp.MethodWorkspaceSymbol, &lsp.WorkspaceSymbolParams{Query: "a"})
+	msg = nextMessage(t, msgs)
+	require.Equal(t, float64(3), msg.ID)
+	require.Nil(t, msg.Error)
+}
+
+func TestDispatcherQueueDoesntBlock(t *testing.T) {
+	d, msgs := newTestDispatcher(t)
+	release := make(chan struct{})
+	d.push(func() { <-release })
+
+	// the reading loop keeps going while the queue is held
+	dispatched := make(chan struct{})
+	go func() {
+		defer close(dispatched)
+		for i := 0; i < 1000; i++ {
+			dispatchMessage(t, d, nil, lsp.MethodWorkspaceDidChangeWatchedFiles, &lsp.DidChangeWatchedFilesParams{})
+		}
+		dispatchMessage(t, d, float64(1), lsp.MethodWorkspaceSymbol, &lsp.WorkspaceSymbolParams{Query: "a"})
+	}()
+	select {
+	case <-dispatched:
+	case <-time.After(10 * time.Second):
+		require.FailNow(t, "dispatch blocked")
+	}
+	close(release)
+
+	msg := nextMessage(t, msgs)
+	require.Equal(t, float64(1), msg.ID)
+	require.Nil(t, msg.Error)
+}
+
+func TestDispatcherShutdown(t *testing.T) {
+	d, msgs := newTestDispatcher(t)
+	dispatchMessage(t, d, float64(1), lsp.MethodShutdown, nil)
+	msg := nextMessage(t, msgs)
+	require.Equal(t, float64(1), msg.ID)
+	require.Nil(t, msg.Error)
+	require.Equal(t, "null", string(msg.Result))
+
+	dispatchMessage(t, d, float64(2), lsp.MethodWorkspaceSymbol, &lsp.WorkspaceSymbolParams{Query: "a"})
+	msg = nextMessage(t, msgs)
+	require.Equal(t, float64(2), msg.ID)
+	require.Equal(t, lspsrv.InvalidRequest, msg.Error.Code)
+}
+
+func TestDispatcherConcurrentReplies(t *testing.T) {
+	c := startPipeServer(t)
+	c.initialize(&lsp.InitializeParams{})
+
+	docs := []lsp.DocumentURI(nil)
+	for i := 0; i < 4; i++ {
+		u := testDocURI(t, fmt.Sprintf("main%d.clvm", i))
+		docs = append(docs, u)
+		c.notify(lsp.MethodTextDocumentDidOpen, &lsp.DidOpenTextDocumentParams{TextDocument: lsp.TextDocumentItem{
+			URI: u, LanguageID: "chialisp", Version: 1, Text: "(mod (A) (defun foo (X) X) (foo A))",
+		}})
+	}
+
+	// replies and diagnostics are written concurrently, each frame must decode on its own
+	ids := map[string]struct{}{}
+	for i := 0; i < 50; i++ {
+		u := docs[i%len(docs)]
+		ids[fmt.Sprint(c.hover(u, 0, 29))] = struct{}{}
+		ids[fmt.Sprint(c.call(lsp.MethodTextDocumentDocumentSymbol, &lsp.DocumentSymbolParams{TextDocument: lsp.TextDocumentIdentifier{URI: u}}))] = struct{}{}
+		c.notify(lsp.MethodTextDocumentDidChange, map[string]interface{}{
+			"textDocument":   lsp.VersionedTextDocumentIdentifier{TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: u}, Version: int32(i + 2)},
+			"contentChanges": []interface{}{map[string]string{"text": fmt.Sprintf("(mod (A) (defun foo (X) (+ X %d)) (foo A))", i)}},
+		})
+	}
+	c.waitFor(func(msg *message) bool {
+		if msg.Method == "" {
+			assert.Nil(t, msg.Error)
+			delete(ids, fmt.Sprint(msg.ID))
+		}
+		return len(ids) == 0
+	})
+
+	c.exit()
+}
+
+func TestDispatcherShutdownWaits(t *testing.T) {
+	c := startPipeServer(t)
+	c.initialize(&lsp.InitializeParams{Capabilities: lsp.ClientCapabilities{Workspace: &lsp.WorkspaceClientCapabilities{Configuration: true}}})
+	c.reply(lsp.MethodWorkspaceConfiguration, []interface{}{nil})
+
+	u := testDocURI(t, "main.clvm")
+	c.notify(lsp.MethodTextDocumentDidOpen, &lsp.DidOpenTextDocumentParams{TextDocument: lsp.TextDocumentItem{
+		URI: u, LanguageID: "chialisp", Version: 1, Text: "(mod (A) (defun foo (X) X) (foo A))",
+	}})
+
+	// the request is still waiting when the shutdown comes, which stops waiting for the client
+	c.notify(lsp.MethodWorkspaceDidChangeConfiguration, &lsp.DidChangeConfigurationParams{})
+	c.waitFor(isMethod(lsp.MethodWorkspaceConfiguration))
+	hover := c.hover(u, 0, 29)
+	shutdown := c.call(lsp.MethodShutdown, nil)
+
+	res := c.waitFor(func(msg *message) bool {
+		return isResponse(hover)(msg) || isResponse(shutdown)(msg)
+	})
+	require.Equal(t, fmt.Sprint(hover), fmt.Sprint(res.ID), "the request is answered first")
+	require.Contains(t, hoverText(t, res), "foo")
+	require.Nil(t, c.response(shutdown).Error)
+
+	c.notify(lsp.MethodExit, nil)
+	require.NoError(t, <-c.done)
+	c.done <- nil
+}
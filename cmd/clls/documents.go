@@ -11,8 +11,7 @@ type documentData struct {
 	content     string
 	contentHash string
 
-	parsedModule bool
-	module       *clls.Module
+	module *clls.Module // the data below is computed from it
 
 	generatedTokens bool
 	semanticTokens  []uint32
@@ -32,10 +31,18 @@ func hashString(s string) string {
 func newDocumentData(text string) *documentData {
 	return &documentData{
 		content:     text,
-		contentHash: hashString(text), // FIXME, if an include changes, the cache will be bad
+		contentHash: hashString(text),
 	}
 }
 
+func (dd *documentData) setModule(mod *clls.Module) {
+	dd.module = mod
+	dd.generatedTokens = false
+	dd.semanticTokens = nil
+	dd.generatedSymbols = false
+	dd.symbols = nil
+}
+
 type documentCacheEntry struct {
 	data  *documentData
 	index int
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// listenAddress returns the network and address of tcp://host:port and unix:///path urls
+func listenAddress(s string) (string, string, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", "", errors.Wrap(err, "parse listen address")
+	}
+	switch u.Scheme {
+	case "tcp":
+		if u.Host == "" {
+			return "", "", errors.Errorf("missing host and port in '%s'", s)
+		}
+		return "tcp", u.Host, nil
+	case "unix":
+		if p := u.Host + u.Path; p != "" {
+			return "unix", p, nil
+		}
+		return "", "", errors.Errorf("missing socket path in '%s'", s)
+	}
+	return "", "", errors.Errorf("unsupported scheme in '%s', expected tcp:// or unix://", s)
+}
+
+// listen serves each connection with its own server until interrupted, so several editors
+// can share a long-running process and a debugger can attach to it
+func listen(addr string) error {
+	network, address, err := listenAddress(addr)
+	if err != nil {
+		return err
+	}
+
+	lg, err := newLogging(logFlags)
+	if err != nil {
+		return errors.Wrap(err, "init logger")
+	}
+	defer lg.close()
+	l := lg.logger()
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return errors.Wrap(err, "listen")
+	}
+	l.Info("listening", zap.String("network", network), zap.String("address", ln.Addr().String()))
+	fmt.Fprintf(os.Stderr, "listening on %s://%s\n", network, ln.Addr())
+
+	// Closing the listener removes the unix socket
+	stopped := make(chan struct{})
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		close(stopped)
+		ln.Close()
+	}()
+
+	return serveListener(lg, ln, stopped)
+}
+
+// serveListener serves the accepted connections until the listener is closed, they share the
+// logging and are told apart by their conn field
+func serveListener(lg *logging, ln net.Listener, stopped <-chan struct{}) error {
+	l := lg.logger()
+	for i := 1; ; i++ {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-stopped:
+				l.Debug("done")
+				return nil
+			default:
+				return errors.Wrap(err, "accept")
+			}
+		}
+
+		fields := []zap.Field{zap.Int("conn", i), zap.String("remote", conn.RemoteAddr().String())}
+		l.Info("accepted connection", fields...)
+		go func() {
+			defer conn.Close()
+			if err := serveConn(lg, conn, conn, fields...); err != nil {
+				l.Error("serve connection", append(fields, zap.Error(err))...)
+			}
+			l.Info("closed connection", fields...)
+		}()
+	}
+}
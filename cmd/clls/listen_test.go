@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/clls-dev/clls/pkg/lspsrv"
+	"go.uber.org/zap"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lsp "go.lsp.dev/protocol"
+)
+
+func TestListenAddress(t *testing.T) {
+	for _, tc := range []struct {
+		addr    string
+		network string
+		address string
+		err     string
+	}{
+		{addr: "tcp://127.0.0.1:7000", network: "tcp", address: "127.0.0.1:7000"},
+		{addr: "tcp://localhost:0", network: "tcp", address: "localhost:0"},
+		{addr: "unix:///tmp/clls.sock", network: "unix", address: "/tmp/clls.sock"},
+		{addr: "tcp://", err: "missing host and port in 'tcp://'"},
+		{addr: "unix://", err: "missing socket path in 'unix://'"},
+		{addr: "http://127.0.0.1:7000", err: "unsupported scheme in 'http://127.0.0.1:7000', expected tcp:// or unix://"},
+		{addr: "127.0.0.1:7000", err: "parse listen address"},
+	} {
+		t.Run(tc.addr, func(t *testing.T) {
+			network, address, err := listenAddress(tc.addr)
+			if tc.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.network, network)
+			require.Equal(t, tc.address, address)
+		})
+	}
+}
+
+// a client connecting to the socket is served until it exits
+func TestServeConnSocket(t *testing.T) {
+	for _, addr := range []string{"tcp://127.0.0.1:0", "unix://" + filepath.Join(t.TempDir(), "clls.sock")} {
+		t.Run(addr, func(t *testing.T) {
+			network, address, err := listenAddress(addr)
+			require.NoError(t, err)
+			ln, err := net.Listen(network, address)
+			require.NoError(t, err)
+			defer ln.Close()
+
+			accepted := make(chan net.Conn, 1)
+			go func() {
+				conn, err := ln.Accept()
+				if assert.NoError(t, err) {
+					accepted <- conn
+				}
+				close(accepted)
+			}()
+			client, err := net.Dial(network, ln.Addr().String())
+			require.NoError(t, err)
+			conn, ok := <-accepted
+			require.True(t, ok)
+
+			c := startServer(t, conn, conn, client, client)
+			c.initialize(&lsp.InitializeParams{})
+			c.exit()
+		})
+	}
+}
+
+// the connections log to the same logging, each with its conn field
+func TestServeListenerSharedLogging(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "server.log")
+	lg, err := newLogging(logConfig{Level: "debug", File: logFile, Format: "json"})
+	require.NoError(t, err)
+	defer lg.close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	stopped := make(chan struct{})
+	served := make(chan error, 1)
+	go func() { served <- serveListener(lg, ln, stopped) }()
+
+	for i := 0; i < 2; i++ {
+		client, err := net.Dial("tcp", ln.Addr().String())
+		require.NoError(t, err)
+		require.NoError(t, lspsrv.Notify(zap.NewNop(), client, "exit", nil))
+		_, err = ioutil.ReadAll(client) // the server closes the connection once exited
+		require.NoError(t, err)
+		client.Close()
+	}
+	close(stopped)
+	ln.Close()
+	require.NoError(t, <-served)
+
+	type entry struct {
+		Msg    string  `json:"msg"`
+		Method string  `json:"method"`
+		Conn   float64 `json:"conn"`
+	}
+	require.Eventually(t, func() bool {
+		b, err := ioutil.ReadFile(logFile)
+		require.NoError(t, err)
+		entries := map[entry]bool{}
+		for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+			e := entry{}
+			require.NoError(t, json.Unmarshal([]byte(line), &e), line)
+			entries[e] = true
+		}
+		for _, conn := range []float64{1, 2} {
+			for _, e := range []entry{{Msg: "accepted connection", Conn: conn}, {Msg: "recv", Method: "exit", Conn: conn}, {Msg: "closed connection", Conn: conn}} {
+				if !entries[e] {
+					return false
+				}
+			}
+		}
+		return true
+	}, 10*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+	lsp "go.lsp.dev/protocol"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// logConfig is set by the command line flags, the client settings override the fields they set
+type logConfig struct {
+	Level  string `json:"logLevel"`  // debug, info, warn or error
+	File   string `json:"logFile"`   // path or stderr
+	Format string `json:"logFormat"` // console or json
+	// Trace logs the JSON-RPC messages with their handling time: off, messages or verbose to add their content
+	Trace string `json:"logTrace"`
+}
+
+// logFlags are the logging flags of the language server
+var logFlags = logConfig{}
+
+func addLogFlags(fs *flag.FlagSet) {
+	fs.StringVar(&logFlags.Level, "log-level", "info", "log level: debug, info, warn or error")
+	fs.StringVar(&logFlags.File, "log-file", "stderr", "log file path, such as /tmp/vscode-clls/server.log, or stderr")
+	fs.StringVar(&logFlags.Format, "log-format", "console", "log format: console or json")
+	fs.StringVar(&logFlags.Trace, "log-trace", "off", "log the JSON-RPC messages with timings: off, messages or verbose")
+}
+
+// merge returns the config with the fields set in o replaced
+func (c logConfig) merge(o logConfig) logConfig {
+	if o.Level != "" {
+		c.Level = o.Level
+	}
+	if o.File != "" {
+		c.File = o.File
+	}
+	if o.Format != "" {
+		c.Format = o.Format
+	}
+	if o.Trace != "" {
+		c.Trace = o.Trace
+	}
+	return c
+}
+
+func (c logConfig) core() (zapcore.Core, func() error, error) {
+	level := zapcore.DebugLevel
+	if err := level.Set(c.Level); err != nil {
+		return nil, nil, errors.Wrap(err, "parse log level")
+	}
+
+	encCfg := zap.NewDevelopmentEncoderConfig()
+	var enc zapcore.Encoder
+	switch c.Format {
+	case "console":
+		enc = zapcore.NewConsoleEncoder(encCfg)
+	case "json":
+		encCfg = zap.NewProductionEncoderConfig()
+		encCfg.EncodeTime = zapcore.ISO8601TimeEncoder
+		enc = zapcore.NewJSONEncoder(encCfg)
+	default:
+		return nil, nil, errors.Errorf("unknown log format '%s'", c.Format)
+	}
+
+	if c.File == "stderr" {
+		return zapcore.NewCore(enc, zapcore.Lock(os.Stderr), level), func() error { return nil }, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(c.File), os.ModePerm); err != nil {
+		return nil, nil, errors.Wrap(err, "create log dir")
+	}
+	f, err := os.OpenFile(c.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "open log file")
+	}
+	return zapcore.NewCore(enc, zapcore.Lock(f), level), f.Close, nil
+}
+
+// parseTrace returns the trace mode, clients send "messages" for the protocol TraceMessage
+func parseTrace(v string) lsp.TraceValue {
+	switch v {
+	case "", "off":
+		return lsp.TraceOff
+	case "verbose":
+		return lsp.TraceVerbose
+	}
+	return lsp.TraceMessage
+}
+
+// logging is the logger of a connection, its loggers write where the last applied config says
+// so that the client settings apply to the loggers created before them. Writes hold the read lock
+// so that the file of a core is closed once nothing writes to it anymore
+type logging struct {
+	flags logConfig
+
+	mu        sync.RWMutex
+	cfg       logConfig
+	core      zapcore.Core
+	closeFile func() error
+}
+
+func newLogging(flags logConfig) (*logging, error) {
+	lg := &logging{flags: flags}
+	if err := lg.apply(logConfig{}); err != nil {
+		return nil, err
+	}
+	return lg, nil
+}
+
+// apply merges the settings over the flags and switches the loggers to the resulting config
+func (lg *logging) apply(settings logConfig) error {
+	cfg := lg.flags.merge(settings)
+	core, closeFile, err := cfg.core()
+	if err != nil {
+		return err
+	}
+
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+	if err := lg.closeCore(); err != nil {
+		return err
+	}
+	lg.cfg = cfg
+	lg.core = core
+	lg.closeFile = closeFile
+	return nil
+}
+
+func (lg *logging) closeCore() error {
+	if lg.core == nil {
+		return nil
+	}
+	_ = lg.core.Sync()
+	return errors.Wrap(lg.closeFile(), "close log file")
+}
+
+// close closes the log file, the loggers must not be used anymore
+func (lg *logging) close() error {
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+	return lg.closeCore()
+}
+
+func (lg *logging) current() (logConfig, zapcore.Core) {
+	lg.mu.RLock()
+	defer lg.mu.RUnlock()
+	return lg.cfg, lg.core
+}
+
+// trace returns the trace mode of the logs
+func (lg *logging) trace() lsp.TraceValue {
+	cfg, _ := lg.current()
+	return parseTrace(cfg.Trace)
+}
+
+func (lg *logging) logger() *zap.Logger {
+	return zap.New(&switchCore{lg: lg}, zap.AddCaller())
+}
+
+// switchCore writes to the current core of the logging
+type switchCore struct {
+	lg     *logging
+	fields []zapcore.Field
+}
+
+func (c *switchCore) Enabled(level zapcore.Level) bool {
+	_, core := c.lg.current()
+	return core.Enabled(level)
+}
+
+func (c *switchCore) With(fields []zapcore.Field) zapcore.Core {
+	return &switchCore{lg: c.lg, fields: append(append([]zapcore.Field(nil), c.fields...), fields...)}
+}
+
+func (c *switchCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(e.Level) {
+		return ce.AddCore(e, c)
+	}
+	return ce
+}
+
+func (c *switchCore) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	c.lg.mu.RLock()
+	defer c.lg.mu.RUnlock()
+	return c.lg.core.With(c.fields).Write(e, fields)
+}
+
+func (c *switchCore) Sync() error {
+	c.lg.mu.RLock()
+	defer c.lg.mu.RUnlock()
+	return c.lg.core.Sync()
+}
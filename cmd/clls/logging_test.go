@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	lsp "go.lsp.dev/protocol"
+)
+
+func TestParseTrace(t *testing.T) {
+	for v, expected := range map[string]lsp.TraceValue{
+		"":         lsp.TraceOff,
+		"off":      lsp.TraceOff,
+		"messages": lsp.TraceMessage,
+		"message":  lsp.TraceMessage,
+		"verbose":  lsp.TraceVerbose,
+	} {
+		require.Equal(t, expected, parseTrace(v), v)
+	}
+}
+
+// the server logs to stderr by default, a log file is opt-in
+func TestLogFlagsDefaults(t *testing.T) {
+	saved := logFlags
+	defer func() { logFlags = saved }()
+
+	fs := flag.NewFlagSet("clls", flag.ContinueOnError)
+	addLogFlags(fs)
+	require.NoError(t, fs.Parse(nil))
+	require.Equal(t, logConfig{Level: "info", File: "stderr", Format: "console", Trace: "off"}, logFlags)
+
+	require.NoError(t, fs.Parse([]string{"--log-file", "/tmp/vscode-clls/server.log", "--log-level", "debug"}))
+	require.Equal(t, logConfig{Level: "debug", File: "/tmp/vscode-clls/server.log", Format: "console", Trace: "off"}, logFlags)
+}
+
+func TestLogConfigMerge(t *testing.T) {
+	flags := logConfig{Level: "debug", File: "/tmp/clls.log", Format: "console", Trace: "off"}
+	require.Equal(t, flags, flags.merge(logConfig{}))
+	require.Equal(t,
+		logConfig{Level: "warn", File: "/tmp/clls.log", Format: "json", Trace: "verbose"},
+		flags.merge(logConfig{Level: "warn", Format: "json", Trace: "verbose"}),
+	)
+
+	settings := logConfig{}
+	require.NoError(t, json.Unmarshal([]byte(`{"logLevel":"error","logFile":"stderr","logFormat":"json","logTrace":"messages"}`), &settings))
+	require.Equal(t, logConfig{Level: "error", File: "stderr", Format: "json", Trace: "messages"}, flags.merge(settings))
+}
+
+func TestLoggingApply(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.log")
+	second := filepath.Join(dir, "second.log")
+	lg, err := newLogging(logConfig{Level: "info", File: first, Format: "console"})
+	require.NoError(t, err)
+	l := lg.logger().Named("test")
+
+	// the loggers keep writing while the file changes
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				l.Info(fmt.Sprintf("message %d-%d", i, j))
+			}
+		}(i)
+	}
+	require.NoError(t, lg.apply(logConfig{File: second, Format: "json"}))
+	wg.Wait()
+	l.Info("last")
+	require.NoError(t, lg.close())
+
+	a, err := ioutil.ReadFile(first)
+	require.NoError(t, err)
+	b, err := ioutil.ReadFile(second)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(a)+string(b)), "\n")
+	require.Len(t, lines, 401, "no message is lost")
+	require.Contains(t, lines[len(lines)-1], `"msg":"last"`)
+}
+
+func TestLogTrace(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "trace.log")
+	c := startPipeServer(t)
+	c.initialize(&lsp.InitializeParams{
+		Trace:                 "messages",
+		InitializationOptions: map[string]interface{}{"logFile": logFile, "logLevel": "info", "logTrace": "verbose"},
+	})
+
+	u := testDocURI(t, "main.clvm")
+	c.notify(lsp.MethodTextDocumentDidOpen, &lsp.DidOpenTextDocumentParams{TextDocument: lsp.TextDocumentItem{
+		URI: u, LanguageID: "chialisp", Version: 1, Text: "(mod (A) (defun foo (X) X) (foo A))",
+	}})
+	id := c.hover(u, 0, 29)
+
+	// the trace is sent before the response
+	trace := c.waitFor(func(msg *message) bool {
+		return msg.Method == lsp.MethodLogTrace && strings.Contains(string(msg.Params), "textDocument/hover")
+	})
+	params := lsp.LogTraceParams{}
+	require.NoError(t, json.Unmarshal(trace.Params, &params))
+	require.Regexp(t, fmt.Sprintf(`^Handled request 'textDocument/hover - \(%d\)' in \S+$`, id), params.Message)
+	require.Empty(t, params.Verbose, "the client asked for the messages only")
+	c.response(id)
+
+	c.notify(lsp.MethodSetTrace, &lsp.SetTraceParams{Value: lsp.TraceVerbose})
+	id = c.hover(u, 0, 29)
+	trace = c.waitFor(func(msg *message) bool {
+		return msg.Method == lsp.MethodLogTrace && strings.Contains(string(msg.Params), "textDocument/hover")
+	})
+	params = lsp.LogTraceParams{}
+	require.NoError(t, json.Unmarshal(trace.Params, &params))
+	require.Contains(t, string(params.Verbose), `Params: {"textDocument":{"uri":"`+string(u)+`"}`)
+	require.Contains(t, string(params.Verbose), "Result: {\"contents\":")
+	c.response(id)
+
+	c.exit()
+
+	// the settings trace the messages in the logs
+	b, err := ioutil.ReadFile(logFile)
+	require.NoError(t, err)
+	require.Regexp(t, `trace\t\S+\thandled\t\{"method": "textDocument/hover", "id": 2, "took": "\S+", "params": "\{\\"textDocument\\"`, string(b))
+}
@@ -2,108 +2,106 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"io"
 	"os"
 
 	"github.com/clls-dev/clls/pkg/lspsrv"
+	"github.com/peterbourgon/ff/v3/ffcli"
 	"github.com/pkg/errors"
-	lsp "go.lsp.dev/protocol"
 	"go.uber.org/zap"
 )
 
-func newLogger() *zap.Logger {
-	cfg := zap.NewDevelopmentConfig()
-	var err error
-	var l *zap.Logger
-	if err = os.MkdirAll("/tmp/vscode-clls", os.ModePerm); err == nil {
-		cfg.OutputPaths = []string{"/tmp/vscode-clls/server.log"}
-		l, err = cfg.Build()
+func main() {
+	flagSet := flag.NewFlagSet("clls", flag.ExitOnError)
+	addIncludeDirsFlag(flagSet)
+	addLogFlags(flagSet)
+	listenFlag := flagSet.String("listen", "", "serve LSP to the clients connecting to tcp://host:port or unix:///path instead of stdio")
+	root := &ffcli.Command{
+		ShortUsage: "clls [-I <dir>]... [--listen <address>] [--log-level <level>] [--log-file <path>] [--log-format <format>] [--log-trace <mode>] [<subcommand>]",
+		ShortHelp:  "chialisp language server, serves LSP on stdio when no subcommand is given",
+		FlagSet:    flagSet,
+		Subcommands: []*ffcli.Command{
+			checkCommand(),
+			compileCommand(),
+			hashCommand(),
+			curryCommand(),
+			uncurryCommand(),
+			assembleCommand(),
+			disassembleCommand(),
+		},
+		Exec: func(context.Context, []string) error {
+			if *listenFlag != "" {
+				return listen(*listenFlag)
+			}
+			return serve()
+		},
 	}
-	if err != nil {
-		fmt.Println("failed to init logger:", err)
-		l = zap.NewNop()
+
+	if err := root.ParseAndRun(context.Background(), os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
 	}
-	return l
 }
 
-func main() {
-	l := newLogger()
+func serve() error {
+	lg, err := newLogging(logFlags)
+	if err != nil {
+		return errors.Wrap(err, "init logger")
+	}
+	defer lg.close()
+	l := lg.logger()
 	l.Info("Logger initialized")
 
-	out := os.Stdout
-
-	err := func() error {
-		srv := newServer(l.Named("ls"))
-		transport := lspsrv.NewFileTransport(l.Named("trs"), os.Stdin, out)
-		l = l.Named("loop")
-		for !srv.exit {
-			// Read message
-			req, err := transport.Recv()
-			if err != nil {
-				if err == io.EOF {
-					break
-				}
-				return errors.Wrap(err, "recv")
-			}
-
-			l.Debug("recv", zap.String("method", req.Method))
+	if err := serveConn(lg, os.Stdin, os.Stdout); err != nil {
+		l.Error("main", zap.Error(err))
+		panic(err)
+	}
 
-			// Ignore requests in shutdown mode
-			if srv.down && req.Method != "exit" {
-				if req.ID == nil {
-					continue
-				}
-				if err := lspsrv.ReplyWithErrorCode(l, out, req.ID, errors.New("shutdown mode"), lspsrv.InvalidRequest); err != nil {
-					return errors.Wrap(err, "reply to request in shutdown mode")
-				}
-				continue
-			}
+	l.Debug("done")
+	return nil
+}
 
-			// Unmarshal params
-			params, err := lspsrv.Unmarshal(req.Method, req.Params)
-			if err != nil {
-				if req.Method == "initialize" {
-					params = &lsp.InitializeParams{}
-					l.Error("unmarshal initialize params", zap.Error(err))
-				} else {
-					if err := lspsrv.ReplyWithError(l, out, req.ID, errors.Wrap(err, fmt.Sprintf("unmarshal '%s'", req.Method))); err != nil {
-						return errors.Wrap(err, "reply with unmarshal error")
-					}
-					continue
-				}
+// serveConn serves a client until it exits or closes its input, the client settings can change the logging
+func serveConn(lg *logging, in io.Reader, w io.Writer, fields ...zap.Field) error {
+	l := lg.logger().With(fields...)
+	out := lspsrv.NewSyncWriter(w)
+	srv := newServer(l.Named("ls"), out)
+	srv.cliIncludeDirs = includeDirsFromFlags()
+	srv.logs = lg
+	transport := lspsrv.NewTransport(l.Named("trs"), in, out)
+	l = l.Named("loop")
+	d := newDispatcher(l, srv, out)
+	defer func() {
+		srv.client.Close() // no more responses
+		d.close()
+		srv.stopIndexing()
+	}()
+	for !srv.exit {
+		// Read message
+		req, err := transport.Recv()
+		if err != nil {
+			if err == io.EOF {
+				break
 			}
+			return errors.Wrap(err, "recv")
+		}
 
-			// Handle
-			ctx, cancel := context.WithCancel(context.TODO())
-			reply, err := srv.Request(ctx, req.Method, params)
-			if err != nil {
-				cancel()
-				if err := lspsrv.ReplyWithError(l, out, req.ID, errors.Wrap(err, fmt.Sprintf("handle '%s'", req.Method))); err != nil {
-					return errors.Wrap(err, "reply with handle error")
-				}
-				continue
-			}
-			cancel()
+		l.Debug("recv", zap.String("method", req.Method))
 
-			// Maybe reply
-			if req.ID != nil && reply != nil {
-				if err := lspsrv.Reply(l, out, &lspsrv.ResponseMessage{
-					ID:     req.ID,
-					Result: reply,
-				}); err != nil {
-					return errors.Wrap(err, "reply")
-				}
+		// Responses to the server requests carry no method
+		if req.Method == "" {
+			if !srv.client.HandleResponse(req) {
+				l.Debug("unexpected response", zap.Any("id", req.ID))
 			}
+			continue
 		}
 
-		return nil
-	}()
-
-	if err != nil {
-		l.Error("main", zap.Error(err))
-		panic(err)
+		if err := d.dispatch(req); err != nil {
+			return err
+		}
 	}
 
-	l.Debug("done")
+	return nil
 }
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/clls-dev/clls/pkg/lspsrv"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+	"go.uber.org/zap"
+)
+
+// message is any message of the server, requests and notifications as well as responses
+type message struct {
+	ID     interface{}           `json:"id"`
+	Method string                `json:"method"`
+	Params json.RawMessage       `json:"params"`
+	Result json.RawMessage       `json:"result"`
+	Error  *lspsrv.ResponseError `json:"error"`
+}
+
+// testClient talks to a server run by serveConn, the messages of the server are decoded as they come
+type testClient struct {
+	t      *testing.T
+	w      io.WriteCloser
+	msgs   chan *message
+	done   chan error
+	lastID int
+}
+
+// startServer serves a client over the given connection ends, the server reads in and writes to out
+func startServer(t *testing.T, in io.Reader, out io.WriteCloser, w io.WriteCloser, r io.Reader) *testClient {
+	lg, err := newLogging(logConfig{Level: "error", File: filepath.Join(t.TempDir(), "server.log"), Format: "console"})
+	require.NoError(t, err)
+	c := &testClient{t: t, w: w, msgs: make(chan *message, 1024), done: make(chan error, 1)}
+	go func() {
+		err := serveConn(lg, in, out)
+		out.Close()
+		c.done <- err
+	}()
+	go func() {
+		defer close(c.msgs)
+		br := bufio.NewReader(r)
+		for {
+			b, err := lspsrv.ReadMessage(zap.NewNop(), br)
+			if err != nil {
+				if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrClosedPipe) && !errors.Is(err, net.ErrClosed) {
+					assert.NoError(t, err, "read message")
+				}
+				return
+			}
+			msg := &message{}
+			if !assert.NoError(t, json.Unmarshal(b, msg), "frame %q", b) {
+				return
+			}
+			c.msgs <- msg
+		}
+	}()
+	t.Cleanup(func() {
+		w.Close()
+		<-c.done
+		assert.NoError(t, lg.close())
+	})
+	return c
+}
+
+// startPipeServer serves a client over io pipes
+func startPipeServer(t *testing.T) *testClient {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	return startServer(t, inR, outW, inW, outR)
+}
+
+func (c *testClient) notify(method string, params interface{}) {
+	require.NoError(c.t, lspsrv.Notify(zap.NewNop(), c.w, method, params))
+}
+
+func (c *testClient) call(method string, params interface{}) int {
+	c.lastID++
+	require.NoError(c.t, lspsrv.Call(zap.NewNop(), c.w, c.lastID, method, params))
+	return c.lastID
+}
+
+// reply answers the next request of the server with the given method
+func (c *testClient) reply(method string, result interface{}) {
+	msg := c.waitFor(isMethod(method))
+	require.NoError(c.t, lspsrv.Reply(zap.NewNop(), c.w, &lspsrv.ResponseMessage{ID: msg.ID, Result: result}))
+}
+
+// waitFor returns the next message matching, the others are skipped
+func (c *testClient) waitFor(match func(*message) bool) *message {
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case msg, ok := <-c.msgs:
+			require.True(c.t, ok, "connection closed")
+			if match(msg) {
+				return msg
+			}
+		case <-timeout:
+			require.FailNow(c.t, "timeout")
+		}
+	}
+}
+
+func isResponse(id int) func(*message) bool {
+	return func(msg *message) bool {
+		return msg.Method == "" && fmt.Sprint(msg.ID) == fmt.Sprint(id)
+	}
+}
+
+func isMethod(method string) func(*message) bool {
+	return func(msg *message) bool {
+		return msg.Method == method
+	}
+}
+
+func (c *testClient) response(id int) *message {
+	return c.waitFor(isResponse(id))
+}
+
+func (c *testClient) initialize(params *lsp.InitializeParams) {
+	res := c.response(c.call(lsp.MethodInitialize, params))
+	require.Nil(c.t, res.Error)
+	c.notify(lsp.MethodInitialized, &lsp.InitializedParams{})
+}
+
+// exit shuts the server down and waits for serveConn to return
+func (c *testClient) exit() {
+	res := c.response(c.call(lsp.MethodShutdown, nil))
+	require.Nil(c.t, res.Error)
+	c.notify(lsp.MethodExit, nil)
+	select {
+	case err := <-c.done:
+		require.NoError(c.t, err)
+		c.done <- err
+	case <-time.After(10 * time.Second):
+		require.FailNow(c.t, "timeout")
+	}
+}
+
+func (c *testClient) hover(u lsp.DocumentURI, line, char uint32) int {
+	return c.call(lsp.MethodTextDocumentHover, &lsp.HoverParams{TextDocumentPositionParams: lsp.TextDocumentPositionParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: u},
+		Position:     lsp.Position{Line: line, Character: char},
+	}})
+}
+
+func hoverText(t *testing.T, res *message) string {
+	require.Nil(t, res.Error)
+	h := lsp.Hover{}
+	require.NoError(t, json.Unmarshal(res.Result, &h))
+	return h.Contents.Value
+}
+
+func testDocURI(t *testing.T, name string) lsp.DocumentURI {
+	return uri.File(filepath.Join(t.TempDir(), name))
+}
+
+func TestServeConn(t *testing.T) {
+	c := startPipeServer(t)
+	res := c.response(c.call(lsp.MethodInitialize, &lsp.InitializeParams{}))
+	require.Nil(t, res.Error)
+	require.Contains(t, string(res.Result), `"name":"clls"`)
+	c.notify(lsp.MethodInitialized, &lsp.InitializedParams{})
+
+	u := testDocURI(t, "main.clvm")
+	c.notify(lsp.MethodTextDocumentDidOpen, &lsp.DidOpenTextDocumentParams{TextDocument: lsp.TextDocumentItem{
+		URI: u, LanguageID: "chialisp", Version: 1, Text: "(mod (A) (defun foo (X) X) (foo A))",
+	}})
+	require.Contains(t, hoverText(t, c.response(c.hover(u, 0, 29))), "(defun foo (X))")
+
+	// responses of the client to unknown requests are ignored
+	require.NoError(t, lspsrv.Reply(zap.NewNop(), c.w, &lspsrv.ResponseMessage{ID: "unknown", Result: 1}))
+	c.exit()
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"io"
 	"io/ioutil"
+	"sync"
 
 	"github.com/clls-dev/clls/pkg/clls"
 	"github.com/clls-dev/clls/pkg/lspsrv"
@@ -17,40 +20,76 @@ type server struct {
 	down bool
 	exit bool
 
+	// mu guards the documents, the loader, the symbol index and the include dirs since requests are
+	// handled concurrently with each other and with the notifications, it is not held while loading
+	// since the loader has its own lock
+	mu sync.Mutex
+
 	openedDocs map[lsp.DocumentURI]*documentData
 	cache      *documentCache
 
-	l *zap.Logger
+	roots   []string
+	symbols *clls.SymbolIndex
+	// cancelIndexing stops the workspace indexing running in the background and waits for its end
+	cancelIndexing func()
+
+	clientIncludeDirs  []string
+	projectIncludeDirs []string
+	cliIncludeDirs     []string
+	loader             *clls.Loader // created on first load, dropped when the include dirs change
+
+	// client capabilities
+	semanticTokensRefresh bool
+	workDoneProgress      bool
+	configuration         bool
+	watchRegistration     bool
+
+	client         *lspsrv.Client
+	progressTokens int
+	clientTrace    lsp.TraceValue // set by the client, traces are sent to it with $/logTrace
+	logs           *logging
+	l              *zap.Logger
 }
 
 var _ lsp.Server = (*server)(nil)
 
-func newServer(l *zap.Logger) *server {
+func newServer(l *zap.Logger, out io.Writer) *server {
 	if l == nil {
 		l = zap.NewNop()
 	}
 	return &server{
-		l:          l,
-		openedDocs: map[lsp.DocumentURI]*documentData{},
-		cache:      newDocumentCache(200),
+		l:           l,
+		client:      lspsrv.NewClient(l.Named("client"), out),
+		openedDocs:  map[lsp.DocumentURI]*documentData{},
+		cache:       newDocumentCache(200),
+		symbols:     clls.NewSymbolIndex(),
+		clientTrace: lsp.TraceOff,
 	}
 }
 
-func (s *server) loadCLVM(u lsp.DocumentURI) (*clls.Module, error) {
-	if d, ok := s.openedDocs[u]; ok && d.parsedModule {
-		return d.module, nil
+// getLoader returns the loader of the server, creating it if it was dropped
+func (s *server) getLoader() *clls.Loader {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.loader == nil {
+		s.loader = &clls.Loader{Logger: s.l, ReadFile: s.readFile, IncludeDirs: s.includeDirs()}
 	}
+	return s.loader
+}
 
-	mod, err := clls.LoadCLVM(s.l, u, s.readFile)
+// loadCLVM returns the module of the document, the loader reparses it when the document or one of its
+// includes changed, in which case the data computed from the previous module is dropped
+func (s *server) loadCLVM(ctx context.Context, u lsp.DocumentURI) (*clls.Module, error) {
+	mod, err := s.getLoader().LoadContext(ctx, u)
 	if err != nil {
 		return nil, err
 	}
 
-	s.l.Debug("parse module", zap.Any("uri", u))
-
-	if d, ok := s.openedDocs[u]; ok {
-		d.module = mod
-		d.parsedModule = true
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d, ok := s.openedDocs[u]; ok && d.module != mod {
+		s.l.Debug("parsed module", zap.Any("uri", u))
+		d.setModule(mod)
 	}
 	return mod, nil
 }
@@ -62,8 +101,12 @@ func shortString(s string, n int) string {
 	return s[:n]
 }
 
+// readFile returns the content of the opened document or of the file
 func (s *server) readFile(uriStr lsp.DocumentURI) (string, error) {
-	if d, ok := s.openedDocs[uriStr]; ok {
+	s.mu.Lock()
+	d, ok := s.openedDocs[uriStr]
+	s.mu.Unlock()
+	if ok {
 		s.l.Debug("reading file from docs", zap.Any("uri", uriStr), zap.Int("size", len(d.content)), zap.String("hash", shortString(d.contentHash, 7)))
 		return d.content, nil
 	}
@@ -82,29 +125,44 @@ func (s *server) readFile(uriStr lsp.DocumentURI) (string, error) {
 }
 
 func (s *server) Request(ctx context.Context, method string, params interface{}) (interface{}, error) {
+	if p, ok := params.(*didChangeParams); ok {
+		return nil, s.didChange(ctx, p)
+	}
 	return lspsrv.Request(ctx, s, method, params)
 }
 
-func (s *server) symbolAt(uri lsp.DocumentURI, p lsp.Position) (*clls.Symbol, error) {
+// unmarshalParams decodes the params of a message, like lspsrv.Unmarshal but keeping the missing ranges of
+// the document changes
+func unmarshalParams(method string, raw []byte) (interface{}, error) {
+	if method == lsp.MethodTextDocumentDidChange {
+		params := &didChangeParams{}
+		return params, json.Unmarshal(raw, params)
+	}
+	return lspsrv.Unmarshal(method, raw)
+}
+
+func (s *server) symbolAt(ctx context.Context, uri lsp.DocumentURI, p lsp.Position) (*clls.Symbol, error) {
 	line := int(p.Line)
 	char := int(p.Character)
 
+	mod, err := s.loadCLVM(ctx, uri)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse module")
+	}
+
+	// the document may have changed since its module was loaded
+	s.mu.Lock()
 	var syms []*clls.Symbol
-	if d, ok := s.openedDocs[uri]; ok && d.generatedSymbols {
+	if d, ok := s.openedDocs[uri]; ok && d.module == mod && d.generatedSymbols {
 		syms = d.symbols
 	} else {
-		mod, err := s.loadCLVM(uri)
-		if err != nil {
-			return nil, errors.Wrap(err, "parse module")
-		}
-
 		syms = mod.Symbols(s.l)
+		if ok && d.module == mod {
+			d.symbols = syms
+			d.generatedSymbols = true
+		}
 	}
-
-	if d, ok := s.openedDocs[uri]; ok {
-		d.symbols = syms
-		d.generatedSymbols = true
-	}
+	s.mu.Unlock()
 
 	for _, sym := range syms {
 		for _, st := range sym.Tokens() {
@@ -121,3 +179,65 @@ func (s *server) symbolAt(uri lsp.DocumentURI, p lsp.Position) (*clls.Symbol, er
 
 	return nil, nil
 }
+
+func (s *server) notify(method string, params interface{}) error {
+	return s.client.Notify(method, params)
+}
+
+func (s *server) publishDiagnostics(ctx context.Context, u lsp.DocumentURI) error {
+	diags := []lsp.Diagnostic{}
+	if mod, err := s.loadCLVM(ctx, u); err != nil {
+		diags = append(diags, clls.ErrorDiagnostic(err))
+	} else {
+		diags = mod.Diagnostics()
+	}
+
+	s.l.Debug("publish diagnostics", zap.Any("uri", u), zap.Int("count", len(diags)))
+
+	return s.notify(lsp.MethodTextDocumentPublishDiagnostics, &lsp.PublishDiagnosticsParams{
+		URI:         u,
+		Diagnostics: diags,
+	})
+}
+
+// refreshSemanticTokens asks the client to request the semantic tokens of the shown documents again,
+// without waiting for its answer
+func (s *server) refreshSemanticTokens() error {
+	if !s.semanticTokensRefresh {
+		return nil
+	}
+	go func() {
+		if err := s.callClient(context.Background(), lsp.MethodSemanticTokensRefresh, nil, nil); err != nil {
+			s.l.Debug("refresh semantic tokens", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+// documentChanged recomputes the opened documents including the changed file, directly or not,
+// loadCLVM gets them reparsed since the content of one of their includes changed
+func (s *server) documentChanged(ctx context.Context, u lsp.DocumentURI) error {
+	loaded := s.getLoader().Dependents(u)
+	dependents := []lsp.DocumentURI(nil)
+	s.mu.Lock()
+	for _, d := range loaded {
+		if _, ok := s.openedDocs[d]; ok {
+			dependents = append(dependents, d)
+		}
+	}
+	s.mu.Unlock()
+	return s.recheck(ctx, dependents)
+}
+
+// recheck publishes the diagnostics of the documents and refreshes the semantic tokens if there are any
+func (s *server) recheck(ctx context.Context, docs []lsp.DocumentURI) error {
+	for _, u := range docs {
+		if err := s.publishDiagnostics(ctx, u); err != nil {
+			return errors.Wrap(err, "publish diagnostics")
+		}
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+	return s.refreshSemanticTokens()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/clls-dev/clls/pkg/lspsrv"
+	"github.com/stretchr/testify/require"
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+	"go.uber.org/zap"
+)
+
+// published returns the diagnostic messages written by the server since the last call, by document
+func published(t *testing.T, out *bytes.Buffer) map[lsp.DocumentURI][]string {
+	diags := map[lsp.DocumentURI][]string{}
+	for {
+		b, err := lspsrv.ReadMessage(zap.NewNop(), out)
+		if err == io.EOF {
+			return diags
+		}
+		require.NoError(t, err)
+		msg := struct {
+			Method string
+			Params lsp.PublishDiagnosticsParams
+		}{}
+		require.NoError(t, json.Unmarshal(b, &msg))
+		if msg.Method != lsp.MethodTextDocumentPublishDiagnostics {
+			continue
+		}
+		messages := []string{}
+		for _, d := range msg.Params.Diagnostics {
+			messages = append(messages, d.Message)
+		}
+		diags[msg.Params.URI] = messages
+	}
+}
+
+func TestDependentsRecheck(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "lib.clib"), []byte("((defun double (x) (* x 2)))"), 0644))
+	mainURI := uri.File(filepath.Join(dir, "main.clvm"))
+	libURI := uri.File(filepath.Join(dir, "lib.clib"))
+	ctx := context.Background()
+	out := &bytes.Buffer{}
+	srv := newServer(zap.NewNop(), out)
+
+	// the documents are single lines, each change replaces the whole line
+	texts := map[lsp.DocumentURI]string{
+		mainURI: "(mod (A) (include lib.clib) (double A))",
+		libURI:  "((defun triple (x) (* x 3)))",
+	}
+	change := func(u lsp.DocumentURI, version int32, text string) {
+		require.NoError(t, srv.DidChange(ctx, &lsp.DidChangeTextDocumentParams{
+			TextDocument: lsp.VersionedTextDocumentIdentifier{TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: u}, Version: version},
+			ContentChanges: []lsp.TextDocumentContentChangeEvent{{
+				Range: lsp.Range{End: lsp.Position{Character: uint32(len(texts[u]))}},
+				Text:  text,
+			}},
+		}))
+		texts[u] = text
+	}
+
+	require.NoError(t, srv.DidOpen(ctx, &lsp.DidOpenTextDocumentParams{TextDocument: lsp.TextDocumentItem{
+		URI: mainURI, LanguageID: "chialisp", Version: 1, Text: texts[mainURI],
+	}}))
+	require.Equal(t, map[lsp.DocumentURI][]string{mainURI: {}}, published(t, out))
+
+	// opening the include replaces the file on disk in the documents including it
+	require.NoError(t, srv.DidOpen(ctx, &lsp.DidOpenTextDocumentParams{TextDocument: lsp.TextDocumentItem{
+		URI: libURI, LanguageID: "chialisp", Version: 1, Text: texts[libURI],
+	}}))
+	require.Equal(t, map[lsp.DocumentURI][]string{mainURI: {"unknown operator 'double'"}, libURI: {}}, published(t, out))
+
+	// the documents including a changed file are checked again
+	change(libURI, 2, "((defun double (x) (+ x x)))")
+	require.Equal(t, map[lsp.DocumentURI][]string{mainURI: {}, libURI: {}}, published(t, out))
+
+	change(mainURI, 2, "(mod (A) (include lib.clib) (double (double A)))")
+	require.Equal(t, map[lsp.DocumentURI][]string{mainURI: {}}, published(t, out), "nothing includes main")
+
+	change(libURI, 3, "((defun half (x) (/ x 2)))")
+	require.Equal(t, map[lsp.DocumentURI][]string{mainURI: {"unknown operator 'double'", "unknown operator 'double'"}, libURI: {}}, published(t, out))
+
+	// closing the include without saving goes back to the file on disk
+	require.NoError(t, srv.DidClose(ctx, &lsp.DidCloseTextDocumentParams{TextDocument: lsp.TextDocumentIdentifier{URI: libURI}}))
+	require.Equal(t, map[lsp.DocumentURI][]string{mainURI: {}, libURI: {}}, published(t, out))
+}
+
+func TestIncrementalChanges(t *testing.T) {
+	u := uri.File(filepath.Join(t.TempDir(), "main.clvm"))
+	ctx := context.Background()
+	out := &bytes.Buffer{}
+	srv := newServer(zap.NewNop(), out)
+
+	require.NoError(t, srv.DidOpen(ctx, &lsp.DidOpenTextDocumentParams{TextDocument: lsp.TextDocumentItem{
+		URI: u, LanguageID: "chialisp", Version: 1, Text: "(mod (A)\n  (c \"𝄞\" A)\n)",
+	}}))
+	require.Equal(t, map[lsp.DocumentURI][]string{u: {}}, published(t, out))
+
+	// the characters are counted in UTF-16 code units, 𝄞 takes two
+	require.NoError(t, srv.DidChange(ctx, &lsp.DidChangeTextDocumentParams{
+		TextDocument: lsp.VersionedTextDocumentIdentifier{TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: u}, Version: 2},
+		ContentChanges: []lsp.TextDocumentContentChangeEvent{
+			{Range: lsp.Range{Start: lsp.Position{Line: 1, Character: 10}, End: lsp.Position{Line: 1, Character: 11}}, Text: "B"},
+			{Range: lsp.Range{Start: lsp.Position{Line: 1, Character: 3}, End: lsp.Position{Line: 1, Character: 4}}, Text: "undefined"},
+		},
+	}))
+	require.Equal(t, map[lsp.DocumentURI][]string{u: {"unknown operator 'undefined'", "undefined name 'B'"}}, published(t, out))
+	require.Equal(t, "(mod (A)\n  (undefined \"𝄞\" B)\n)", srv.openedDocs[u].content)
+}
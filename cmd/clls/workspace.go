@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+	"go.uber.org/zap"
+)
+
+var workspaceExtensions = map[string]struct{}{".clvm": {}, ".clsp": {}, ".clib": {}}
+
+func isWorkspaceFile(u lsp.DocumentURI) bool {
+	_, ok := workspaceExtensions[filepath.Ext(string(u))]
+	return ok
+}
+
+// workspaceRoots returns the directories of the workspace folders, falling back to the root uri or path
+func workspaceRoots(params *lsp.InitializeParams) []string {
+	roots := []string(nil)
+	for _, f := range params.WorkspaceFolders {
+		roots = append(roots, uri.New(f.URI).Filename())
+	}
+	switch {
+	case len(roots) > 0:
+	case params.RootURI != "":
+		roots = append(roots, params.RootURI.Filename())
+	case params.RootPath != "":
+		roots = append(roots, params.RootPath)
+	}
+	return roots
+}
+
+// startIndexing indexes the workspace in the background once the current indexing is stopped
+func (s *server) startIndexing() {
+	s.stopIndexing()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.indexWorkspace(ctx)
+	}()
+	s.mu.Lock()
+	s.cancelIndexing = func() {
+		cancel()
+		<-done
+	}
+	s.mu.Unlock()
+}
+
+// stopIndexing cancels the indexing of the workspace and waits for its end
+func (s *server) stopIndexing() {
+	s.mu.Lock()
+	cancel := s.cancelIndexing
+	s.cancelIndexing = nil
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// indexWorkspace adds the symbols of every chialisp file under the workspace roots to the index, hidden directories are skipped,
+// a file is searched as soon as it is indexed and the indexing stops once the context is done
+func (s *server) indexWorkspace(ctx context.Context) {
+	p := s.beginProgress(ctx, "Indexing chialisp files")
+	files := s.workspaceFiles(ctx)
+	for i, u := range files {
+		if ctx.Err() != nil {
+			p.end("cancelled")
+			return
+		}
+		s.indexFile(ctx, u)
+		p.report(fmt.Sprintf("%d/%d files", i+1, len(files)), uint32(100*(i+1)/len(files)))
+	}
+	s.l.Debug("indexed workspace", zap.Strings("roots", s.roots))
+	p.end(fmt.Sprintf("%d files", len(files)))
+}
+
+// workspaceFiles returns the chialisp files under the workspace roots
+func (s *server) workspaceFiles(ctx context.Context) []lsp.DocumentURI {
+	files := []lsp.DocumentURI(nil)
+	for _, root := range s.roots {
+		err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err != nil {
+				return nil
+			}
+			if info.IsDir() {
+				if p != root && strings.HasPrefix(info.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if u := uri.File(p); isWorkspaceFile(u) {
+				files = append(files, u)
+			}
+			return nil
+		})
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			s.l.Error("index workspace", zap.String("root", root), zap.Error(err))
+			s.logMessage(lsp.MessageTypeError, fmt.Sprintf("index %s: %s", root, err))
+		}
+	}
+	return files
+}
+
+func (s *server) indexFile(ctx context.Context, u lsp.DocumentURI) {
+	mod, err := s.loadCLVM(ctx, u)
+	if ctx.Err() != nil {
+		return // the index keeps the previous symbols of the file
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.l.Debug("skip file in index", zap.Any("uri", u), zap.Error(err))
+		s.symbols.Remove(u)
+		return
+	}
+	s.symbols.Update(u, mod)
+}
+
+func (s *server) DidChangeWatchedFiles(ctx context.Context, params *lsp.DidChangeWatchedFilesParams) error {
+	for _, c := range params.Changes {
+		if filepath.Base(c.URI.Filename()) == projectConfigName {
+			s.loadProjectConfig()
+			return s.reload(ctx)
+		}
+	}
+	changed := map[lsp.DocumentURI]struct{}{}
+	resolution := false // includes may resolve to other files
+	reindex := []lsp.DocumentURI(nil)
+	loader := s.getLoader()
+	for _, c := range params.Changes {
+		if !isWorkspaceFile(c.URI) {
+			continue
+		}
+		s.mu.Lock()
+		_, opened := s.openedDocs[c.URI]
+		if !opened && c.Type == lsp.FileChangeTypeDeleted {
+			s.symbols.Remove(c.URI)
+		}
+		s.mu.Unlock()
+		if opened {
+			continue // the editor content is used and indexed as it changes
+		}
+		if c.Type != lsp.FileChangeTypeDeleted {
+			reindex = append(reindex, c.URI)
+		}
+		if c.Type != lsp.FileChangeTypeChanged {
+			resolution = true
+		}
+		for _, d := range loader.Dependents(c.URI) {
+			changed[d] = struct{}{}
+		}
+	}
+
+	for _, u := range reindex {
+		s.indexFile(ctx, u)
+	}
+
+	docs := []lsp.DocumentURI(nil)
+	s.mu.Lock()
+	for u := range s.openedDocs {
+		if _, ok := changed[u]; ok || resolution {
+			docs = append(docs, u)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(docs, func(i, j int) bool { return docs[i] < docs[j] })
+	return s.recheck(ctx, docs)
+}
+
+const maxWorkspaceSymbols = 256
+
+func (s *server) Symbols(_ context.Context, params *lsp.WorkspaceSymbolParams) ([]lsp.SymbolInformation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.symbols.Search(params.Query, maxWorkspaceSymbols), nil
+}
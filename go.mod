@@ -3,6 +3,7 @@ module github.com/clls-dev/clls
 go 1.16
 
 require (
+	github.com/kilic/bls12-381 v0.1.0
 	github.com/peterbourgon/ff/v3 v3.0.0
 	github.com/pkg/errors v0.9.1
 	github.com/radovskyb/watcher v1.0.7
@@ -1,7 +1,10 @@
 package clls
 
 import (
+	"strings"
+
 	"github.com/pkg/errors"
+	lsp "go.lsp.dev/protocol"
 )
 
 type ASTNode struct {
@@ -10,8 +13,10 @@ type ASTNode struct {
 	CloseToken *Token
 }
 
-func parseAST(tokch chan *Token) (*ASTNode, error) {
+// parseAST builds the syntax tree, it tolerates unbalanced parentheses and reports them as problems
+func parseAST(tokch chan *Token) (*ASTNode, []*Problem, error) {
 	parents := []*ASTNode{{}} // start with empty root
+	problems := []*Problem(nil)
 	for {
 		t, ok := <-tokch
 		if !ok {
@@ -28,14 +33,57 @@ func parseAST(tokch chan *Token) (*ASTNode, error) {
 			current.Children = append(current.Children, child)
 		case parensCloseToken:
 			if len(parents) == 1 {
+				problems = append(problems, newProblem(t.Range(), lsp.DiagnosticSeverityError, "unexpected closing parenthesis"))
 				continue
 			}
-			parents = parents[:len(parents)-1]
 			parents[len(parents)-1].CloseToken = t
+			parents = parents[:len(parents)-1]
 		}
 	}
 	if len(parents) < 1 {
-		return nil, errors.New("unexpected internal state")
+		return nil, nil, errors.New("unexpected internal state")
+	}
+	for _, n := range parents[1:] {
+		problems = append(problems, newProblem(n.OpenToken.Range(), lsp.DiagnosticSeverityError, "unclosed parenthesis"))
+	}
+	return parents[0], problems, nil
+}
+
+// nodeString renders a syntax tree node back to source on a single line
+func nodeString(n interface{}) string {
+	switch n := n.(type) {
+	case *Token:
+		if n == nil {
+			return "()"
+		}
+		if n.Text == "" {
+			return n.Value
+		}
+		return n.Text
+	case *ASTNode:
+		if n == nil {
+			return "()"
+		}
+		strs := make([]string, len(n.Children))
+		for i, c := range n.Children {
+			strs[i] = nodeString(c)
+		}
+		return "(" + strings.Join(strs, " ") + ")"
+	}
+	return ""
+}
+
+// containsPosition reports whether the given position falls between the node's parentheses
+func (n *ASTNode) containsPosition(p lsp.Position) bool {
+	if n == nil || n.OpenToken == nil {
+		return false
+	}
+	line, char := int(p.Line), int(p.Character)
+	if line < n.OpenToken.Line || (line == n.OpenToken.Line && char <= n.OpenToken.StartChar) {
+		return false
+	}
+	if n.CloseToken == nil {
+		return true // unclosed node spans until the end of the document
 	}
-	return parents[0], nil
+	return line < n.CloseToken.Line || (line == n.CloseToken.Line && char <= n.CloseToken.StartChar)
 }
@@ -0,0 +1,36 @@
+package clls
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.lsp.dev/uri"
+)
+
+func parseString(t *testing.T, text string) (*ASTNode, []*Problem) {
+	tch, errptr := tokenize(text, uri.New("file://main.clvm"))
+	root, problems, err := parseAST(tch)
+	require.NoError(t, err)
+	require.NoError(t, *errptr)
+	return root, problems
+}
+
+// a closing parenthesis closes the innermost open node, not its parent
+func TestParseASTCloseTokens(t *testing.T) {
+	root, problems := parseString(t, "(a (b) c)")
+	require.Empty(t, problems)
+	outer := root.Children[0].(*ASTNode)
+	inner := outer.Children[1].(*ASTNode)
+	require.Equal(t, 0, outer.OpenToken.StartChar)
+	require.Equal(t, 8, outer.CloseToken.StartChar)
+	require.Equal(t, 3, inner.OpenToken.StartChar)
+	require.Equal(t, 5, inner.CloseToken.StartChar)
+
+	root, problems = parseString(t, "(a (b c)")
+	require.Len(t, problems, 1)
+	require.Equal(t, "unclosed parenthesis", problems[0].Message)
+	outer = root.Children[0].(*ASTNode)
+	inner = outer.Children[1].(*ASTNode)
+	require.Nil(t, outer.CloseToken)
+	require.Equal(t, 7, inner.CloseToken.StartChar)
+}
@@ -1,12 +1,69 @@
 package clls
 
+import (
+	"fmt"
+	"unicode"
+
+	"github.com/clls-dev/clls/pkg/clvm"
+)
+
+// builtin describes a CLVM operator or a macro provided by the compiler
+type builtin struct {
+	Params   string
+	MinArgs  int
+	MaxArgs  int // -1 means variadic
+	Doc      string
+	Operator *clvm.Operator
+}
+
+var compilerMacros = []struct {
+	name string
+	builtin
+}{
+	{"if", builtin{Params: "(cond then else)", MinArgs: 3, MaxArgs: 3, Doc: "Evaluates `cond` and returns the evaluation of `then` if it is non-nil, `else` otherwise. Unlike `i`, only the selected branch is evaluated."}},
+	{"list", builtin{Params: "(items ...)", MinArgs: 0, MaxArgs: -1, Doc: "Builds a nil-terminated list from its arguments."}},
+	{"qq", builtin{Params: "(expr)", MinArgs: 1, MaxArgs: 1, Doc: "Quasi-quotes `expr`: it is returned as is, except for `unquote` forms which are evaluated."}},
+	{"unquote", builtin{Params: "(expr)", MinArgs: 1, MaxArgs: 1, Doc: "Inside a `qq` form, evaluates `expr` and inserts its value."}},
+	{"quote", builtin{Params: "(value)", MinArgs: 1, MaxArgs: 1, Doc: "Returns `value` without evaluating it."}},
+	{"assert", builtin{Params: "(conditions ... result)", MinArgs: 1, MaxArgs: -1, Doc: "Raises unless every condition is non-nil, then returns `result`."}},
+	{"and", builtin{Params: "(values ...)", MinArgs: 0, MaxArgs: -1, Doc: "Returns 1 if every value is non-nil, nil otherwise. Stops evaluating at the first nil value."}},
+	{"or", builtin{Params: "(values ...)", MinArgs: 0, MaxArgs: -1, Doc: "Returns 1 if any value is non-nil, nil otherwise. Stops evaluating at the first non-nil value."}},
+	{"function", builtin{Params: "(body)", MinArgs: 1, MaxArgs: 1, Doc: "Compiles `body` as a standalone program with access to the module functions, to be run with `a`."}},
+}
+
+var builtins = func() map[string]*builtin {
+	m := map[string]*builtin{}
+	for _, op := range clvm.Operators {
+		m[op.Name] = &builtin{
+			Params:   op.Params,
+			MinArgs:  op.MinArgs,
+			MaxArgs:  op.MaxArgs,
+			Doc:      fmt.Sprintf("%s\n\nOpcode `0x%02x`, cost: %s.", op.Doc, op.Opcode, op.Cost),
+			Operator: op,
+		}
+	}
+	for _, cm := range compilerMacros {
+		b := cm.builtin
+		m[cm.name] = &b
+	}
+	return m
+}()
+
+// isOperatorName reports whether the builtin is written with symbols rather than letters, like + or >s
+func isOperatorName(name string) bool {
+	if _, ok := builtins[name]; !ok || name == "" {
+		return false
+	}
+	return !unicode.IsLetter([]rune(name)[0])
+}
+
 var builtinFuncs = func() []*Function {
-	names := []string{
-		"if",
-		"point_add", "c", "list",
-		"l", "sha256", "f", "r", "pubkey_for_exp", "a", "x",
-		"divmod", "substr", "concat", "logand", "qq", "unquote", "q",
-		"quote", "i",
+	names := []string(nil)
+	for _, cm := range compilerMacros {
+		names = append(names, cm.name)
+	}
+	for _, op := range clvm.Operators {
+		names = append(names, op.Name)
 	}
 	funcs := make([]*Function, len(names))
 	for i, n := range names {
@@ -0,0 +1,51 @@
+package clls
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/clls-dev/clls/pkg/clvm"
+	"github.com/stretchr/testify/require"
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+	"go.uber.org/zap"
+)
+
+// hover, completion and semantic tokens know every operator of the registry
+func TestBuiltinsFromOperators(t *testing.T) {
+	mod, err := LoadCLVMFromStrings(zap.NewNop(), uri.New("file://main.clvm"), map[lsp.DocumentURI]string{
+		uri.New("file://main.clvm"): "(mod (A)\n  (c (strlen A) (+ A (g1_negate A)))\n)",
+	})
+	require.NoError(t, err)
+
+	items := completionsByLabel(mod.Completions(lsp.Position{Line: 1, Character: 3}))
+	for name, op := range clvm.OperatorsByName {
+		f, ok := BuiltinFuncsByName[name]
+		require.True(t, ok, name)
+		hover := mod.Hover(&Symbol{Token: f.Name})
+		require.Contains(t, hover, op.Doc, name)
+		require.Contains(t, hover, fmt.Sprintf("Opcode `0x%02x`, cost: %s.", op.Opcode, op.Cost), name)
+		require.Contains(t, items, name)
+	}
+
+	data, err := mod.SemanticTokens(zap.NewNop())
+	require.NoError(t, err)
+	// tokens are encoded as (delta line, delta start, length, type, modifiers) relative to the previous one
+	types := map[string][2]uint32{}
+	line, char := uint32(0), uint32(0)
+	text := []string{"(mod (A)", "  (c (strlen A) (+ A (g1_negate A)))"}
+	for i := 0; i+4 < len(data); i += 5 {
+		if data[i] != 0 {
+			char = 0
+		}
+		line, char = line+data[i], char+data[i+1]
+		types[text[line][char:char+data[i+2]]] = [2]uint32{data[i+3], data[i+4]}
+	}
+	builtinType, builtinMods, err := tokenInfo(zap.NewNop(), lsp.SemanticTokenFunction, []lsp.SemanticTokenModifiers{lsp.SemanticTokenModifierDefaultLibrary}, &StandardSemanticTokensLegend)
+	require.NoError(t, err)
+	operatorType, _, err := tokenInfo(zap.NewNop(), lsp.SemanticTokenOperator, nil, &StandardSemanticTokensLegend)
+	require.NoError(t, err)
+	require.Equal(t, [2]uint32{builtinType, builtinMods}, types["strlen"])
+	require.Equal(t, [2]uint32{builtinType, builtinMods}, types["g1_negate"])
+	require.Equal(t, operatorType, types["+"][0])
+}
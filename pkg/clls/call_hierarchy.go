@@ -0,0 +1,216 @@
+package clls
+
+import (
+	"sort"
+
+	lsp "go.lsp.dev/protocol"
+)
+
+// tokenKey identifies a token across loads of the same file, included modules are parsed once per includer
+type tokenKey struct {
+	uri        lsp.DocumentURI
+	line, char int
+}
+
+func keyOf(t *Token) tokenKey {
+	return tokenKey{t.DocumentURI, t.Line, t.StartChar}
+}
+
+func itemKey(item lsp.CallHierarchyItem) tokenKey {
+	return tokenKey{item.URI, int(item.SelectionRange.Start.Line), int(item.SelectionRange.Start.Character)}
+}
+
+func tokenContains(t *Token, p lsp.Position) bool {
+	return t != nil && t.Line == int(p.Line) && t.StartChar <= int(p.Character) && int(p.Character) <= t.EndChar()
+}
+
+// caller is a mod main body or a function, the code that calls lives in it
+type caller struct {
+	module   *Module
+	function *Function // nil for the mod main body
+}
+
+func (c caller) body() *CodeBody {
+	if c.function != nil {
+		return c.function.Body
+	}
+	return c.module.Main
+}
+
+func (c caller) item() (lsp.CallHierarchyItem, bool) {
+	if c.function == nil {
+		m := c.module
+		if !m.IsMod || m.ModToken == nil {
+			return lsp.CallHierarchyItem{}, false
+		}
+		return lsp.CallHierarchyItem{
+			Name:           "mod",
+			Kind:           lsp.SymbolKindModule,
+			Detail:         "mod " + nodeString(m.Args),
+			URI:            m.ModToken.DocumentURI,
+			Range:          nodeRange(m.Raw),
+			SelectionRange: m.ModToken.Range(),
+		}, true
+	}
+	ds, ok := functionSymbol(c.function)
+	if !ok {
+		return lsp.CallHierarchyItem{}, false
+	}
+	return lsp.CallHierarchyItem{
+		Name:           ds.Name,
+		Kind:           ds.Kind,
+		Detail:         ds.Detail,
+		URI:            c.function.Name.DocumentURI,
+		Range:          ds.Range,
+		SelectionRange: ds.SelectionRange,
+	}, true
+}
+
+// callers returns the mod main body and the functions of the module and its includes
+func (m *Module) callers() []caller {
+	r := []caller(nil)
+	for _, mod := range append([]*Module{m}, m.includedModules()...) {
+		if mod.IsMod {
+			r = append(r, caller{module: mod})
+		}
+		for _, f := range mod.Functions {
+			if f.Name != nil {
+				r = append(r, caller{module: mod, function: f})
+			}
+		}
+	}
+	return r
+}
+
+// walkCalls calls fn for each call or function reference of the body, builtins included
+func walkCalls(cb *CodeBody, fn func(cb *CodeBody)) {
+	if cb == nil {
+		return
+	}
+	if (cb.Kind == CallBodyKind || cb.Kind == FuncVarBodyKind) && cb.Function != nil && cb.Token != nil {
+		fn(cb)
+	}
+	for _, c := range cb.Children {
+		walkCalls(c, fn)
+	}
+}
+
+// findCaller returns the mod or function the item describes
+func (m *Module) findCaller(item lsp.CallHierarchyItem) (caller, bool) {
+	key := itemKey(item)
+	for _, c := range m.callers() {
+		if c.function == nil && c.module.ModToken != nil && keyOf(c.module.ModToken) == key {
+			return c, true
+		}
+		if c.function != nil && keyOf(c.function.Name) == key {
+			return c, true
+		}
+	}
+	return caller{}, false
+}
+
+// PrepareCallHierarchy returns the function, or the mod, whose name or a call to which is at the given position
+func (m *Module) PrepareCallHierarchy(p lsp.Position) []lsp.CallHierarchyItem {
+	callers := m.callers()
+	byKey := map[tokenKey]caller{}
+	for _, c := range callers {
+		if c.function != nil {
+			byKey[keyOf(c.function.Name)] = c
+		}
+	}
+
+	target := (*caller)(nil)
+	for _, c := range callers {
+		c := c
+		switch {
+		case c.module != m:
+		case c.function == nil && tokenContains(c.module.ModToken, p):
+			target = &c
+		case c.function != nil && tokenContains(c.function.Name, p):
+			target = &c
+		default:
+			walkCalls(c.body(), func(cb *CodeBody) {
+				if callee, ok := byKey[keyOf(cb.Function)]; ok && tokenContains(cb.Token, p) {
+					target = &callee
+				}
+			})
+		}
+		if target != nil {
+			break
+		}
+	}
+	if target == nil {
+		return nil
+	}
+	item, ok := target.item()
+	if !ok {
+		return nil
+	}
+	return []lsp.CallHierarchyItem{item}
+}
+
+func sortRanges(rs []lsp.Range) {
+	sort.Slice(rs, func(i, j int) bool { return positionBefore(rs[i].Start, rs[j].Start) })
+}
+
+// IncomingCalls returns the mod and functions, among the module and its includes, calling or referencing the item
+func (m *Module) IncomingCalls(item lsp.CallHierarchyItem) []lsp.CallHierarchyIncomingCall {
+	target := itemKey(item)
+	r := []lsp.CallHierarchyIncomingCall(nil)
+	for _, c := range m.callers() {
+		ranges := []lsp.Range(nil)
+		walkCalls(c.body(), func(cb *CodeBody) {
+			if keyOf(cb.Function) == target {
+				ranges = append(ranges, cb.Token.Range())
+			}
+		})
+		if len(ranges) == 0 {
+			continue
+		}
+		from, ok := c.item()
+		if !ok {
+			continue
+		}
+		sortRanges(ranges)
+		r = append(r, lsp.CallHierarchyIncomingCall{From: from, FromRanges: ranges})
+	}
+	return r
+}
+
+// OutgoingCalls returns the functions the item calls or references, builtins are left out
+func (m *Module) OutgoingCalls(item lsp.CallHierarchyItem) []lsp.CallHierarchyOutgoingCall {
+	c, ok := m.findCaller(item)
+	if !ok {
+		return nil
+	}
+	byKey := map[tokenKey]caller{}
+	for _, c := range m.callers() {
+		if c.function != nil {
+			byKey[keyOf(c.function.Name)] = c
+		}
+	}
+
+	order := []tokenKey(nil)
+	ranges := map[tokenKey][]lsp.Range{}
+	walkCalls(c.body(), func(cb *CodeBody) {
+		k := keyOf(cb.Function)
+		if _, ok := byKey[k]; !ok {
+			return
+		}
+		if _, ok := ranges[k]; !ok {
+			order = append(order, k)
+		}
+		ranges[k] = append(ranges[k], cb.Token.Range())
+	})
+
+	r := []lsp.CallHierarchyOutgoingCall(nil)
+	for _, k := range order {
+		to, ok := byKey[k].item()
+		if !ok {
+			continue
+		}
+		sortRanges(ranges[k])
+		r = append(r, lsp.CallHierarchyOutgoingCall{To: to, FromRanges: ranges[k]})
+	}
+	return r
+}
@@ -0,0 +1,65 @@
+package clls
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+	"go.uber.org/zap"
+)
+
+func TestCallHierarchy(t *testing.T) {
+	mainURI := uri.New("file:///main.clvm")
+	libURI := uri.New("file:///lib.clib")
+	mod, err := LoadCLVMFromStrings(zap.NewNop(), mainURI, map[lsp.DocumentURI]string{
+		mainURI: `(mod (A)
+	(include lib.clib)
+	(defun twice (x) (+ x x))
+	(defun apply (f x) (a f (list x)))
+	(create-coin (twice A) (apply twice A))
+)`,
+		libURI: `(
+	(defun create-coin (ph amount) (list 51 ph amount))
+)`,
+	})
+	require.NoError(t, err)
+
+	names := func(items []lsp.CallHierarchyItem) []string {
+		r := []string(nil)
+		for _, i := range items {
+			r = append(r, i.Name)
+		}
+		return r
+	}
+
+	// on a call to an included function
+	items := mod.PrepareCallHierarchy(lsp.Position{Line: 4, Character: 3})
+	require.Equal(t, []string{"create-coin"}, names(items))
+	require.Equal(t, libURI, items[0].URI)
+
+	incoming := mod.IncomingCalls(items[0])
+	require.Len(t, incoming, 1)
+	require.Equal(t, "mod", incoming[0].From.Name)
+	require.Equal(t, mainURI, incoming[0].From.URI)
+
+	// twice is called and passed as a value
+	items = mod.PrepareCallHierarchy(lsp.Position{Line: 2, Character: 10})
+	require.Equal(t, []string{"twice"}, names(items))
+	incoming = mod.IncomingCalls(items[0])
+	require.Len(t, incoming, 1)
+	require.Len(t, incoming[0].FromRanges, 2)
+	require.Equal(t, uint32(4), incoming[0].FromRanges[0].Start.Line)
+
+	items = mod.PrepareCallHierarchy(lsp.Position{Line: 0, Character: 2})
+	require.Equal(t, []string{"mod"}, names(items))
+	outgoing := mod.OutgoingCalls(items[0])
+	to := []string(nil)
+	for _, o := range outgoing {
+		to = append(to, o.To.Name)
+	}
+	require.Equal(t, []string{"create-coin", "twice", "apply"}, to)
+	require.Len(t, outgoing[1].FromRanges, 2)
+
+	require.Empty(t, mod.PrepareCallHierarchy(lsp.Position{Line: 3, Character: 23}))
+}
@@ -0,0 +1,151 @@
+package clls
+
+import (
+	"regexp"
+
+	lsp "go.lsp.dev/protocol"
+)
+
+var literalRegexp = regexp.MustCompile(`^(-?[0-9]+|0x[0-9a-fA-F]*)$`)
+
+// isLiteral reports whether the token is a number, an hex value or a string rather than a name
+func isLiteral(t *Token) bool {
+	return t.Kind == quoteToken || t.Value == "." || literalRegexp.MatchString(t.Value)
+}
+
+// paramsArity returns the number of arguments accepted by a params tree, max is -1 when there is a rest parameter
+func paramsArity(params interface{}) (min int, max int) {
+	switch params := params.(type) {
+	case *Token:
+		if params != nil {
+			return 0, -1
+		}
+	case *ASTNode:
+		for i, c := range params.Children {
+			if t, ok := c.(*Token); ok && t.Value == "." {
+				if i == len(params.Children)-1 {
+					break
+				}
+				return min, -1
+			}
+			min++
+		}
+	}
+	return min, min
+}
+
+func functionArity(f *Function) (min int, max int, ok bool) {
+	if f.Builtin {
+		bd, ok := builtins[f.Name.Value]
+		if !ok {
+			return 0, 0, false
+		}
+		return bd.MinArgs, bd.MaxArgs, true
+	}
+	min, max = paramsArity(f.Params)
+	return min, max, true
+}
+
+type checker struct {
+	mod      *Module
+	problems []*Problem
+	// inline function bodies are expanded at the call site, free names are resolved there
+	allowFreeNames bool
+}
+
+func (c *checker) add(r lsp.Range, severity lsp.DiagnosticSeverity, format string, args ...interface{}) {
+	c.problems = append(c.problems, newProblem(r, severity, format, args...))
+}
+
+func (c *checker) checkCall(cb *CodeBody) {
+	f, ok := c.mod.lookupFunction(cb.Function.Value)
+	if !ok {
+		return
+	}
+	for _, a := range cb.CallArgs {
+		if a != nil && a.Kind == valueBodyKind && a.Token != nil && a.Token.Value == "." {
+			return // dotted call, the arguments count is unknown
+		}
+	}
+	min, max, ok := functionArity(f)
+	if !ok {
+		return
+	}
+	n := len(cb.CallArgs)
+	if n < min || (max != -1 && n > max) {
+		c.add(nodeRange(cb.Raw), lsp.DiagnosticSeverityError, "'%s' takes %s but got %d", f.Name.Value, arityString(min, max), n)
+	}
+}
+
+// checkQuasiQuoted only checks the unquoted parts of a qq form
+func (c *checker) checkQuasiQuoted(cb *CodeBody) {
+	if cb == nil {
+		return
+	}
+	if cb.Kind == CallBodyKind && cb.Function.Value == "unquote" {
+		c.check(cb)
+		return
+	}
+	for _, child := range cb.Children {
+		c.checkQuasiQuoted(child)
+	}
+}
+
+func (c *checker) check(cb *CodeBody) {
+	if cb == nil {
+		return
+	}
+	switch cb.Kind {
+	case CallBodyKind:
+		switch cb.Function.Value {
+		case "q", "quote":
+			return
+		case "qq":
+			c.checkCall(cb)
+			for _, a := range cb.CallArgs {
+				c.checkQuasiQuoted(a)
+			}
+			return
+		}
+		c.checkCall(cb)
+	case OperatorBodyKind:
+		c.checkCall(cb)
+	case IfBodyKind:
+		b := builtins["if"]
+		if n := len(cb.Children); n < b.MinArgs || n > b.MaxArgs {
+			c.add(nodeRange(cb.Raw), lsp.DiagnosticSeverityError, "'if' takes %s but got %d", arityString(b.MinArgs, b.MaxArgs), n)
+		}
+	case blockBodyKind:
+		if len(cb.Children) > 0 && cb.Children[0] != nil && cb.Children[0].Kind == valueBodyKind {
+			if t := cb.Children[0].Token; t != nil && !isLiteral(t) {
+				c.add(t.Range(), lsp.DiagnosticSeverityError, "unknown operator '%s'", t.Value)
+				for _, child := range cb.Children[1:] {
+					c.check(child)
+				}
+				return
+			}
+		}
+	case valueBodyKind:
+		if cb.Token != nil && !isLiteral(cb.Token) && !c.allowFreeNames {
+			c.add(cb.Token.Range(), lsp.DiagnosticSeverityWarning, "undefined name '%s'", cb.Token.Value)
+		}
+	}
+	for _, child := range cb.Children {
+		c.check(child)
+	}
+}
+
+// Check reports calls to unknown operators, references to undefined names and calls with a wrong arguments count
+func (m *Module) Check() []*Problem {
+	c := &checker{mod: m}
+	for _, cst := range m.Constants {
+		c.check(cst.Value)
+	}
+	for _, f := range m.Functions {
+		c.allowFreeNames = f.Inline
+		c.check(f.Body)
+	}
+	c.allowFreeNames = false
+	c.check(m.Main)
+	return c.problems
+}
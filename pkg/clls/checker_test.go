@@ -0,0 +1,33 @@
+package clls
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+	"go.uber.org/zap"
+)
+
+func TestCheck(t *testing.T) {
+	mod, err := LoadCLVMFromStrings(zap.NewNop(), uri.New("file://main.clvm"), map[lsp.DocumentURI]string{
+		uri.New("file://main.clvm"): `(mod (A)
+	(defun rest-args (x y . z) x)
+	(defun-inline free-names () B)
+	(c (sha265 A) (list (rest-args 1) (rest-args 1 2 3 4) (if A B) (q . foo) (qq (foo (unquote bar))) (free-names)))
+)`,
+	})
+	require.NoError(t, err)
+
+	messages := []string(nil)
+	for _, p := range mod.Check() {
+		messages = append(messages, p.Error())
+	}
+	require.Equal(t, []string{
+		"4:6: unknown operator 'sha265'",
+		"4:22: 'rest-args' takes at least 2 arguments but got 1",
+		"4:56: 'if' takes exactly 3 arguments but got 2",
+		"4:62: undefined name 'B'",
+		"4:93: undefined name 'bar'",
+	}, messages)
+}
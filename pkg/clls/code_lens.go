@@ -0,0 +1,23 @@
+package clls
+
+import (
+	"fmt"
+
+	lsp "go.lsp.dev/protocol"
+)
+
+// CodeLenses returns a lens above the mod keyword showing the tree hash of the compiled module,
+// modules that don't compile get no lens since their diagnostics already explain why
+func (m *Module) CodeLenses() []lsp.CodeLens {
+	if !m.IsMod || m.ModToken == nil {
+		return nil
+	}
+	prog, err := m.Compile()
+	if err != nil {
+		return nil
+	}
+	return []lsp.CodeLens{{
+		Range:   m.ModToken.Range(),
+		Command: &lsp.Command{Title: fmt.Sprintf("sha256tree: 0x%x", prog.Code.TreeHash())},
+	}}
+}
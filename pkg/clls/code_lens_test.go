@@ -0,0 +1,31 @@
+package clls
+
+import (
+	"testing"
+
+	"github.com/clls-dev/clls/pkg/examples"
+	"github.com/stretchr/testify/require"
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+	"go.uber.org/zap"
+)
+
+func TestCodeLenses(t *testing.T) {
+	for name, hash := range map[string]string{
+		"p2_conditions.clvm": "1c77d7d5efde60a7a1d2d27db6d746bc8e568aea1ef8586ca967a0d60b83cc36",
+		// the standard transaction puzzle
+		"p2_delegated_puzzle_or_hidden_puzzle.clvm": "e9aaa49f45bad5c889b86ee3341550c155cfdd10c3a6757de618d20612fffd52",
+	} {
+		src, err := examples.F.ReadFile(name)
+		require.NoError(t, err)
+		mod, err := LoadCLVMFromStrings(zap.NewNop(), uri.New("file://main.clvm"), map[lsp.DocumentURI]string{
+			uri.New("file://main.clvm"):            string(src),
+			uri.New("file://condition_codes.clvm"): ConditionCodes,
+		})
+		require.NoError(t, err)
+		lenses := mod.CodeLenses()
+		require.Len(t, lenses, 1, name)
+		require.Equal(t, mod.ModToken.Range(), lenses[0].Range)
+		require.Equal(t, "sha256tree: 0x"+hash, lenses[0].Command.Title, name)
+	}
+}
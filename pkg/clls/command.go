@@ -96,43 +96,9 @@ func Command(rootName string) (*ffcli.Command, *string) {
 
 const fileURIPrefix = "file://"
 
-// TODO: replace p with documentURI
+// LoadCLVM loads the module of the document, included files are looked up next to the files including them
 func LoadCLVM(l *zap.Logger, documentURI lsp.DocumentURI, readFile func(lsp.DocumentURI) (string, error)) (*Module, error) {
-	f, err := readFile(documentURI)
-	if err != nil {
-		return nil, errors.Wrap(err, "read file")
-	}
-
-	tokens := []*Token(nil)
-	tch, errptr := tokenize(f, documentURI)
-	duptch := make(chan *Token)
-	go func() {
-		defer close(duptch)
-		for token := range tch {
-			duptch <- token
-			tokens = append(tokens, token)
-		}
-	}()
-
-	ast, err := parseAST(duptch)
-	if err != nil {
-		return nil, errors.Wrap(err, "parse syntax tree")
-	}
-
-	if *errptr != nil {
-		return nil, errors.Wrap(*errptr, "tokenize")
-	}
-
-	mods, err := parseModules(l, ast, documentURI, readFile, tokens)
-	if err != nil {
-		return nil, errors.Wrap(err, "parse modules")
-	}
-	if len(mods) == 0 {
-		return nil, errors.New("no modules in file")
-	}
-
-	return mods[0], nil
-
+	return (&Loader{Logger: l, ReadFile: readFile}).Load(documentURI)
 }
 
 func LoadCLVMFromStrings(l *zap.Logger, documentURI lsp.DocumentURI, files map[lsp.DocumentURI]string) (*Module, error) {
@@ -146,6 +112,7 @@ func LoadCLVMFromStrings(l *zap.Logger, documentURI lsp.DocumentURI, files map[l
 }
 
 type constant struct {
+	Raw   *ASTNode
 	Token *Token
 	Name  interface{}
 	Value *CodeBody
@@ -199,8 +166,10 @@ func (f *Function) varTokens() map[string]*Token {
 }
 
 type include struct {
+	Raw       *ASTNode
 	Token     *Token
 	Value     interface{}
+	URI       lsp.DocumentURI // file the path resolves to
 	Module    *Module
 	LoadError error
 }
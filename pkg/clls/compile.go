@@ -0,0 +1,794 @@
+package clls
+
+import (
+	"encoding/hex"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/clls-dev/clls/pkg/clvm"
+	lsp "go.lsp.dev/protocol"
+)
+
+// Program is a compiled module
+type Program struct {
+	Code *clvm.Value
+	// Sources maps nodes of Code to the source tokens they were compiled from
+	Sources map[*clvm.Value]*Token
+	// Frames maps the compiled bodies of the mod and of its functions to their description
+	Frames map[*clvm.Value]*Frame
+}
+
+// Frame describes the body of the mod or of a function, the units a debugger steps in and out of
+type Frame struct {
+	Name     string
+	Function *Function // nil for the mod body
+	Params   []FrameParam
+}
+
+// FrameParam is a parameter of a frame with its path in the environment of the body
+type FrameParam struct {
+	Name string
+	Path *clvm.Value
+}
+
+func newFrame(name string, f *Function, params *clvm.Value, sc scope) *Frame {
+	fr := &Frame{Name: name, Function: f}
+	var walk func(p *clvm.Value)
+	walk = func(p *clvm.Value) {
+		if p.IsPair() {
+			walk(p.First)
+			walk(p.Rest)
+		} else if !p.IsNil() {
+			fr.Params = append(fr.Params, FrameParam{Name: string(p.Atom), Path: sc[string(p.Atom)]})
+		}
+	}
+	walk(params)
+	return fr
+}
+
+// maxExpansionDepth bounds nested macro and inline function expansions
+const maxExpansionDepth = 256
+
+type compiler struct {
+	mod      *Module
+	tokens   map[*clvm.Value]*Token   // source token of the values read from the syntax tree
+	literals map[*clvm.Value]struct{} // atoms written as numbers, hex or strings rather than names
+	sources  map[*clvm.Value]*Token
+	macros   map[*Function]*clvm.Value
+
+	// paths of the functions and constants stored in the environment, nil when compiling a macro
+	env scope
+
+	site  *Token // token of the expression being expanded, for values produced by macros
+	depth int
+}
+
+func newCompiler(m *Module) *compiler {
+	return &compiler{
+		mod:      m,
+		tokens:   map[*clvm.Value]*Token{},
+		literals: map[*clvm.Value]struct{}{},
+		sources:  map[*clvm.Value]*Token{},
+		macros:   map[*Function]*clvm.Value{},
+	}
+}
+
+func (c *compiler) errorf(v *clvm.Value, format string, args ...interface{}) error {
+	r := lsp.Range{}
+	if t, ok := c.tokens[v]; ok {
+		r = t.Range()
+	} else if c.site != nil {
+		r = c.site.Range()
+	}
+	return newProblem(r, lsp.DiagnosticSeverityError, format, args...)
+}
+
+// mark records the source of a compiled node
+func (c *compiler) mark(out, src *clvm.Value) *clvm.Value {
+	if t, ok := c.tokens[src]; ok {
+		c.sources[out] = t
+	} else if c.site != nil {
+		c.sources[out] = c.site
+	}
+	return out
+}
+
+func (c *compiler) isLiteral(v *clvm.Value) bool {
+	_, ok := c.literals[v]
+	return ok
+}
+
+// read converts a syntax tree node to a value, names are kept as atoms holding their text
+func (c *compiler) read(n interface{}) (*clvm.Value, error) {
+	switch n := n.(type) {
+	case *Token:
+		if n == nil {
+			return clvm.Nil, nil
+		}
+		v, literal, err := readAtom(n)
+		if err != nil {
+			return nil, newProblem(n.Range(), lsp.DiagnosticSeverityError, "%s", err)
+		}
+		c.tokens[v] = n
+		if literal {
+			c.literals[v] = struct{}{}
+		}
+		return v, nil
+	case *ASTNode:
+		if n == nil {
+			return clvm.Nil, nil
+		}
+		items := []*clvm.Value(nil)
+		tail := clvm.Nil
+		for i, child := range n.Children {
+			if t, ok := child.(*Token); ok && t.Kind == basicToken && t.Value == "." {
+				if i == 0 || i != len(n.Children)-2 {
+					return nil, newProblem(t.Range(), lsp.DiagnosticSeverityError, "misplaced dot")
+				}
+				var err error
+				if tail, err = c.read(n.Children[i+1]); err != nil {
+					return nil, err
+				}
+				break
+			}
+			v, err := c.read(child)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		for i := len(items) - 1; i >= 0; i-- {
+			tail = clvm.Cons(items[i], tail)
+		}
+		if tail.IsPair() {
+			if t, ok := n.Children[0].(*Token); ok {
+				c.tokens[tail] = t
+			} else if n.OpenToken != nil {
+				c.tokens[tail] = n.OpenToken
+			}
+		}
+		return tail, nil
+	}
+	return clvm.Nil, nil
+}
+
+func readAtom(t *Token) (v *clvm.Value, literal bool, err error) {
+	if t.Kind == quoteToken {
+		return clvm.Atom([]byte(t.Value)), true, nil
+	}
+	switch {
+	case strings.HasPrefix(t.Value, "0x") && literalRegexp.MatchString(t.Value):
+		h := t.Value[2:]
+		if len(h)%2 == 1 {
+			h = "0" + h
+		}
+		b, err := hex.DecodeString(h)
+		if err != nil {
+			return nil, false, err
+		}
+		return clvm.Atom(b), true, nil
+	case literalRegexp.MatchString(t.Value):
+		i, _ := new(big.Int).SetString(t.Value, 10)
+		return clvm.Int(i), true, nil
+	}
+	return clvm.Atom([]byte(t.Value)), false, nil
+}
+
+// quoteData converts names of operators in quoted data to their opcodes, like the assembler does
+func (c *compiler) quoteData(v *clvm.Value) *clvm.Value {
+	if v.IsPair() {
+		return clvm.Cons(c.quoteData(v.First), c.quoteData(v.Rest))
+	}
+	if !c.isLiteral(v) {
+		if op, ok := clvm.OperatorsByName[string(v.Atom)]; ok {
+			return clvm.Atom(op.OpcodeBytes())
+		}
+	}
+	return v
+}
+
+func quoteAtom() *clvm.Value {
+	return clvm.Atom(clvm.OperatorsByName["q"].OpcodeBytes())
+}
+
+func (c *compiler) quote(v *clvm.Value) *clvm.Value {
+	return clvm.Cons(quoteAtom(), c.quoteData(v))
+}
+
+func opcode(name string) *clvm.Value {
+	return clvm.Atom(clvm.OperatorsByName[name].OpcodeBytes())
+}
+
+// function quotes the optimized code, the branches of an if are optimized on their own like in the reference compiler
+func (c *compiler) function(code *clvm.Value) *clvm.Value {
+	return clvm.Cons(quoteAtom(), c.optimize(code))
+}
+
+// ifCode evaluates only the selected branch: (a (i cond (q . then) (q . else)) 1)
+func (c *compiler) ifCode(cond, then, els *clvm.Value) *clvm.Value {
+	return clvm.List(opcode("a"), clvm.List(opcode("i"), cond, c.function(then), c.function(els)), clvm.Int64(1))
+}
+
+// paramsPaths returns the path of each name of a params tree, the env is first walked with
+// the prefix steps, bits are read from the least significant one and 1 means rest
+func paramsPaths(params *clvm.Value, bits *big.Int, depth uint, paths map[string]*clvm.Value) {
+	if params.IsPair() {
+		paramsPaths(params.First, bits, depth+1, paths)
+		paramsPaths(params.Rest, new(big.Int).SetBit(bits, int(depth), 1), depth+1, paths)
+		return
+	}
+	if params.IsNil() {
+		return
+	}
+	paths[string(params.Atom)] = pathAtom(new(big.Int).SetBit(bits, int(depth), 1))
+}
+
+func (c *compiler) lookupFunction(name string) (*Function, bool) {
+	if f, ok := c.mod.FunctionsByName[name]; ok {
+		return f, true
+	}
+	for _, im := range c.mod.includedModules() {
+		if f, ok := im.FunctionsByName[name]; ok {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+func (c *compiler) lookupConstant(name string) (*constant, bool) {
+	if cst, ok := c.mod.constsByName[name]; ok {
+		return cst, true
+	}
+	for _, im := range c.mod.includedModules() {
+		if cst, ok := im.constsByName[name]; ok {
+			return cst, true
+		}
+	}
+	return nil, false
+}
+
+// functionRef returns a node holding the path of the function in the environment
+func (c *compiler) functionRef(v *clvm.Value, f *Function) (*clvm.Value, error) {
+	if c.env == nil {
+		return nil, c.errorf(v, "macros can't use the function '%s'", f.Name.Value)
+	}
+	path, ok := c.env[f.Name.Value]
+	if !ok {
+		return nil, c.errorf(v, "the function '%s' is not named in the code of the mod", f.Name.Value)
+	}
+	return c.mark(clvm.Atom(path.Atom), v), nil
+}
+
+type scope map[string]*clvm.Value
+
+func (sc scope) with(bindings scope) scope {
+	r := scope{}
+	for k, v := range sc {
+		r[k] = v
+	}
+	for k, v := range bindings {
+		r[k] = v
+	}
+	return r
+}
+
+func (c *compiler) compile(v *clvm.Value, sc scope) (*clvm.Value, error) {
+	if v.IsPair() {
+		return c.compileList(v, sc)
+	}
+	if v.IsNil() || c.isLiteral(v) {
+		return c.mark(c.quote(v), v), nil
+	}
+	name := string(v.Atom)
+	if e, ok := sc[name]; ok {
+		if !e.IsPair() {
+			e = clvm.Atom(e.Atom) // own node for the source map
+		}
+		return c.mark(e, v), nil
+	}
+	if cst, ok := c.lookupConstant(name); ok {
+		if cst.Value == nil {
+			return nil, c.errorf(v, "constant '%s' has no value", name)
+		}
+		data, err := c.read(cst.Value.Raw)
+		if err != nil {
+			return nil, err
+		}
+		return c.mark(c.quote(data), v), nil
+	}
+	if f, ok := c.lookupFunction(name); ok && !f.Inline && !f.Macro {
+		return c.functionRef(v, f)
+	}
+	// other names are quoted like in the reference compiler, macros use them to build code
+	return c.mark(c.quote(v), v), nil
+}
+
+// compileArgs compiles the arguments of a call, tail is nil unless the list is dotted
+func (c *compiler) compileArgs(args *clvm.Value, sc scope) (items []*clvm.Value, tail *clvm.Value, err error) {
+	for ; args.IsPair(); args = args.Rest {
+		a, err := c.compile(args.First, sc)
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, a)
+	}
+	if !args.IsNil() {
+		if tail, err = c.compile(args, sc); err != nil {
+			return nil, nil, err
+		}
+	}
+	return items, tail, nil
+}
+
+func (c *compiler) properArgs(v *clvm.Value, sc scope) ([]*clvm.Value, error) {
+	items, tail, err := c.compileArgs(v.Rest, sc)
+	if err != nil {
+		return nil, err
+	}
+	if tail != nil {
+		return nil, c.errorf(v, "'%s' doesn't take dotted arguments", v.First.Atom)
+	}
+	return items, nil
+}
+
+// consList builds the code of a list from the code of its items: (c a (c b tail))
+func consList(items []*clvm.Value, tail *clvm.Value) *clvm.Value {
+	if tail == nil {
+		tail = clvm.Nil
+	}
+	for i := len(items) - 1; i >= 0; i-- {
+		tail = clvm.List(opcode("c"), items[i], tail)
+	}
+	return tail
+}
+
+func (c *compiler) arity(v *clvm.Value, name string, min, max int) error {
+	items, _ := v.Rest.ListItems()
+	if n := len(items); n < min || (max != -1 && n > max) {
+		return c.errorf(v, "'%s' takes %s but got %d", name, arityString(min, max), n)
+	}
+	return nil
+}
+
+func (c *compiler) compileList(v *clvm.Value, sc scope) (*clvm.Value, error) {
+	head := v.First
+	if head.IsPair() {
+		// ((OP) . args) is kept as is, the runtime applies OP to the unevaluated args
+		if head.First.IsPair() || !head.Rest.IsNil() {
+			return nil, c.errorf(v, "the operator of a call must be an atom or (OP)")
+		}
+		return c.mark(c.quoteData(v), v), nil
+	}
+	if c.isLiteral(head) {
+		// numbers in operator position are opcodes
+		args, err := c.properArgs(v, sc)
+		if err != nil {
+			return nil, err
+		}
+		return c.mark(clvm.List(append([]*clvm.Value{head}, args...)...), v), nil
+	}
+
+	name := string(head.Atom)
+	switch name {
+	case "q":
+		return c.mark(c.quote(v.Rest), v), nil
+	case "quote":
+		if err := c.arity(v, name, 1, 1); err != nil {
+			return nil, err
+		}
+		return c.mark(c.quote(v.Rest.First), v), nil
+	case "qq":
+		if err := c.arity(v, name, 1, 1); err != nil {
+			return nil, err
+		}
+		return c.quasiQuote(v.Rest.First, sc)
+	case "unquote":
+		return nil, c.errorf(v, "unquote outside of qq")
+	case "mod", "defun", "defun-inline", "defmacro", "defconstant", "include":
+		return nil, c.errorf(v, "'%s' is only allowed at the top level of a mod", name)
+	}
+
+	if f, ok := c.lookupFunction(name); ok {
+		switch {
+		case f.Macro:
+			return c.expandMacro(v, f, sc)
+		case f.Inline:
+			return c.inline(v, f, sc)
+		}
+		ref, err := c.functionRef(head, f)
+		if err != nil {
+			return nil, err
+		}
+		items, tail, err := c.compileArgs(v.Rest, sc)
+		if err != nil {
+			return nil, err
+		}
+		// functions run with the environment tree followed by their arguments as environment
+		return c.mark(clvm.List(opcode("a"), ref, clvm.List(opcode("c"), clvm.Int64(2), c.optimize(consList(items, tail)))), v), nil
+	}
+
+	switch name {
+	case "if":
+		if err := c.arity(v, name, 3, 3); err != nil {
+			return nil, err
+		}
+		args, err := c.properArgs(v, sc)
+		if err != nil {
+			return nil, err
+		}
+		return c.mark(c.ifCode(args[0], args[1], args[2]), v), nil
+	case "list":
+		args, err := c.properArgs(v, sc)
+		if err != nil {
+			return nil, err
+		}
+		return c.mark(consList(args, nil), v), nil
+	case "assert", "and", "or":
+		if name == "assert" {
+			if err := c.arity(v, name, 1, -1); err != nil {
+				return nil, err
+			}
+		}
+		args, err := c.properArgs(v, sc)
+		if err != nil {
+			return nil, err
+		}
+		return c.mark(c.logicCode(name, args), v), nil
+	case "function":
+		if err := c.arity(v, name, 1, 1); err != nil {
+			return nil, err
+		}
+		body, err := c.compile(v.Rest.First, sc)
+		if err != nil {
+			return nil, err
+		}
+		return c.mark(c.function(body), v), nil
+	}
+
+	op, ok := clvm.OperatorsByName[name]
+	if !ok {
+		if _, fromSource := c.tokens[head]; fromSource {
+			return nil, c.errorf(head, "unknown operator '%s'", name)
+		}
+		// atoms produced by macros are used as opcodes
+		args, err := c.properArgs(v, sc)
+		if err != nil {
+			return nil, err
+		}
+		return c.mark(clvm.List(append([]*clvm.Value{head}, args...)...), v), nil
+	}
+	if err := c.arity(v, name, op.MinArgs, op.MaxArgs); err != nil {
+		return nil, err
+	}
+	args, err := c.properArgs(v, sc)
+	if err != nil {
+		return nil, err
+	}
+	return c.mark(clvm.List(append([]*clvm.Value{clvm.Atom(op.OpcodeBytes())}, args...)...), v), nil
+}
+
+// logicCode expands assert, and and or into nested ifs
+func (c *compiler) logicCode(name string, args []*clvm.Value) *clvm.Value {
+	switch name {
+	case "assert":
+		if len(args) == 1 {
+			return args[0]
+		}
+		return c.ifCode(args[0], c.logicCode(name, args[1:]), clvm.List(opcode("x")))
+	case "and":
+		if len(args) == 0 {
+			return clvm.Cons(quoteAtom(), clvm.Int64(1))
+		}
+		return c.ifCode(args[0], c.logicCode(name, args[1:]), clvm.Nil)
+	}
+	if len(args) == 0 {
+		return clvm.Nil
+	}
+	return c.ifCode(args[0], clvm.Cons(quoteAtom(), clvm.Int64(1)), c.logicCode(name, args[1:]))
+}
+
+func (c *compiler) containsUnquote(v *clvm.Value) bool {
+	if !v.IsPair() {
+		return false
+	}
+	if !v.First.IsPair() && !c.isLiteral(v.First) && string(v.First.Atom) == "unquote" {
+		return true
+	}
+	return c.containsUnquote(v.First) || c.containsUnquote(v.Rest)
+}
+
+// quasiQuote quotes v except for its unquote forms, which are compiled
+func (c *compiler) quasiQuote(v *clvm.Value, sc scope) (*clvm.Value, error) {
+	if !c.containsUnquote(v) {
+		return c.mark(c.quote(v), v), nil
+	}
+	if !v.First.IsPair() && string(v.First.Atom) == "unquote" {
+		if err := c.arity(v, "unquote", 1, 1); err != nil {
+			return nil, err
+		}
+		return c.compile(v.Rest.First, sc)
+	}
+	first, err := c.quasiQuote(v.First, sc)
+	if err != nil {
+		return nil, err
+	}
+	rest, err := c.quasiQuote(v.Rest, sc)
+	if err != nil {
+		return nil, err
+	}
+	return c.mark(clvm.List(opcode("c"), first, rest), v), nil
+}
+
+func (c *compiler) enter(v *clvm.Value) (leave func(), err error) {
+	if c.depth >= maxExpansionDepth {
+		return nil, c.errorf(v, "too many nested expansions, is there a recursive macro or inline function?")
+	}
+	site := c.site
+	if t, ok := c.tokens[v]; ok {
+		c.site = t
+	}
+	c.depth++
+	return func() {
+		c.depth--
+		c.site = site
+	}, nil
+}
+
+// expandMacro runs the compiled macro with the unevaluated arguments and compiles the resulting code
+func (c *compiler) expandMacro(v *clvm.Value, f *Function, sc scope) (*clvm.Value, error) {
+	leave, err := c.enter(v)
+	if err != nil {
+		return nil, err
+	}
+	defer leave()
+
+	code, ok := c.macros[f]
+	if !ok {
+		params, err := c.read(f.Params)
+		if err != nil {
+			return nil, err
+		}
+		body, err := c.read(f.RawBody)
+		if err != nil {
+			return nil, err
+		}
+		paths := scope{}
+		paramsPaths(params, new(big.Int), 0, paths)
+		mc := *c
+		mc.env = nil
+		if code, err = mc.compile(body, paths); err != nil {
+			return nil, err
+		}
+		c.macros[f] = code
+	}
+	expansion, _, err := clvm.Run(code, v.Rest, 0)
+	if err != nil {
+		return nil, c.errorf(v, "macro '%s' failed: %s", f.Name.Value, err)
+	}
+	return c.compile(expansion, sc)
+}
+
+// bindParams binds the names of a params tree to the code extracting them from the value
+func bindParams(params, value *clvm.Value, bindings scope) {
+	if params.IsPair() {
+		bindParams(params.First, clvm.List(opcode("f"), value), bindings)
+		bindParams(params.Rest, clvm.List(opcode("r"), value), bindings)
+		return
+	}
+	if !params.IsNil() {
+		bindings[string(params.Atom)] = value
+	}
+}
+
+// inline substitutes the compiled arguments to the parameters in the function body,
+// free names are resolved in the caller scope
+func (c *compiler) inline(v *clvm.Value, f *Function, sc scope) (*clvm.Value, error) {
+	leave, err := c.enter(v)
+	if err != nil {
+		return nil, err
+	}
+	defer leave()
+
+	params, err := c.read(f.Params)
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.read(f.RawBody)
+	if err != nil {
+		return nil, err
+	}
+	args, tail, err := c.compileArgs(v.Rest, sc)
+	if err != nil {
+		return nil, err
+	}
+	bindings := scope{}
+	p := params
+	for ; p.IsPair(); p = p.Rest {
+		if len(args) == 0 {
+			if tail == nil {
+				return nil, c.errorf(v, "'%s' takes more arguments", f.Name.Value)
+			}
+			bindParams(p, tail, bindings)
+			p = clvm.Nil
+			break
+		}
+		bindParams(p.First, args[0], bindings)
+		args = args[1:]
+	}
+	if !p.IsNil() {
+		bindParams(p, consList(args, tail), bindings)
+	} else if len(args) > 0 {
+		return nil, c.errorf(v, "'%s' takes fewer arguments", f.Name.Value)
+	}
+	return c.compile(body, sc.with(bindings))
+}
+
+// Compile lowers the mod into a CLVM program like the reference compiler does. Functions defined with defun and
+// constants are stored in the environment next to the arguments and functions are called with a, inline functions
+// and macros are expanded at the call site. The code is then optimized so that the program has the canonical
+// tree hash.
+func (m *Module) Compile() (*Program, error) {
+	if !m.IsMod {
+		return nil, newProblem(nodeRange(m.ModToken), lsp.DiagnosticSeverityError, "only mod forms can be compiled")
+	}
+	for _, p := range m.Problems {
+		if p.Severity == lsp.DiagnosticSeverityError {
+			return nil, p
+		}
+	}
+	if m.Main == nil {
+		return nil, newProblem(nodeRange(m.ModToken), lsp.DiagnosticSeverityError, "mod has no body")
+	}
+
+	c := newCompiler(m)
+	args, err := c.read(m.Args)
+	if err != nil {
+		return nil, err
+	}
+	main, err := c.read(m.Main.Raw)
+	if err != nil {
+		return nil, err
+	}
+	names, err := c.environmentNames(main)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(names) == 0 {
+		sc := scope{}
+		paramsPaths(args, new(big.Int), 0, sc)
+		code, err := c.compile(main, sc)
+		if err != nil {
+			return nil, err
+		}
+		code = c.optimize(code)
+		return &Program{Code: code, Sources: c.sources, Frames: map[*clvm.Value]*Frame{code: newFrame("mod", nil, args, sc)}}, nil
+	}
+
+	// the environment is (tree . arguments), the tree holds the functions and constants
+	c.env = scope{}
+	for i, name := range names {
+		c.env[name] = pathAtom(treePath(len(names), i))
+	}
+	sc := c.env.with(nil)
+	paramsPaths(args, big.NewInt(1), 1, sc)
+	code, err := c.compile(main, sc)
+	if err != nil {
+		return nil, err
+	}
+	code = c.optimize(code)
+	frames := map[*clvm.Value]*Frame{code: newFrame("mod", nil, args, sc)}
+
+	entries := make([]*clvm.Value, len(names))
+	for i, name := range names {
+		if cst, ok := c.lookupConstant(name); ok {
+			if cst.Value == nil {
+				return nil, newProblem(cst.Token.Range(), lsp.DiagnosticSeverityError, "constant '%s' has no value", name)
+			}
+			data, err := c.read(cst.Value.Raw)
+			if err != nil {
+				return nil, err
+			}
+			entries[i] = c.quote(data)
+			continue
+		}
+		f, _ := c.lookupFunction(name)
+		params, err := c.read(f.Params)
+		if err != nil {
+			return nil, err
+		}
+		body, err := c.read(f.RawBody)
+		if err != nil {
+			return nil, err
+		}
+		sc := c.env.with(nil)
+		paramsPaths(params, big.NewInt(1), 1, sc)
+		fc, err := c.compile(body, sc)
+		if err != nil {
+			return nil, err
+		}
+		fc = c.optimize(fc)
+		frames[fc] = newFrame(f.Name.Value, f, params, sc)
+		entries[i] = clvm.Cons(quoteAtom(), fc)
+	}
+	return &Program{
+		Code:    c.optimize(clvm.List(opcode("a"), clvm.Cons(quoteAtom(), code), clvm.List(opcode("c"), treeCode(entries), clvm.Int64(1)))),
+		Sources: c.sources,
+		Frames:  frames,
+	}, nil
+}
+
+// environmentNames returns the sorted names of the functions and constants to store in the environment. Like the
+// reference compiler, these are the names written in the main expression and, transitively, in the functions,
+// inline functions and macros named there.
+func (c *compiler) environmentNames(main *clvm.Value) ([]string, error) {
+	seen := map[string]struct{}{}
+	queue := []string(nil)
+	var add func(v *clvm.Value)
+	add = func(v *clvm.Value) {
+		if v.IsPair() {
+			add(v.First)
+			add(v.Rest)
+			return
+		}
+		if _, ok := seen[string(v.Atom)]; !ok {
+			seen[string(v.Atom)] = struct{}{}
+			queue = append(queue, string(v.Atom))
+		}
+	}
+	add(main)
+
+	names := []string(nil)
+	for ; len(queue) > 0; queue = queue[1:] {
+		name := queue[0]
+		if _, ok := c.lookupConstant(name); ok {
+			names = append(names, name)
+			continue
+		}
+		f, ok := c.lookupFunction(name)
+		if !ok {
+			continue
+		}
+		if !f.Inline && !f.Macro {
+			names = append(names, name)
+		}
+		for _, n := range []interface{}{f.Params, f.RawBody} {
+			v, err := c.read(n)
+			if err != nil {
+				return nil, err
+			}
+			add(v)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// treePath returns the path of the i-th of n items in the balanced tree built by treeCode, the tree is the
+// first of the environment
+func treePath(n, i int) *big.Int {
+	path := new(big.Int)
+	depth := 1
+	for n > 1 {
+		half := n / 2
+		if i >= half {
+			path.SetBit(path, depth, 1)
+			i -= half
+			n -= half
+		} else {
+			n = half
+		}
+		depth++
+	}
+	return path.SetBit(path, depth, 1)
+}
+
+// treeCode builds the code of a balanced tree of the values of the items, the first half goes left
+func treeCode(items []*clvm.Value) *clvm.Value {
+	if len(items) == 1 {
+		return items[0]
+	}
+	half := len(items) / 2
+	return clvm.List(opcode("c"), treeCode(items[:half]), treeCode(items[half:]))
+}
@@ -0,0 +1,141 @@
+package clls
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/clls-dev/clls/pkg/clvm"
+	"github.com/clls-dev/clls/pkg/examples"
+	"github.com/stretchr/testify/require"
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+	"go.uber.org/zap"
+)
+
+func compileString(t *testing.T, src string) (*Program, error) {
+	t.Helper()
+	mod, err := LoadCLVMFromStrings(zap.NewNop(), uri.New("file://main.clvm"), map[lsp.DocumentURI]string{
+		uri.New("file://main.clvm"):            src,
+		uri.New("file://condition_codes.clvm"): ConditionCodes,
+	})
+	require.NoError(t, err)
+	return mod.Compile()
+}
+
+func TestCompileExamples(t *testing.T) {
+	for name, expected := range map[string]string{
+		"p2_conditions.clvm":                  "(c (q . 1) 2)",
+		"calculate_synthetic_public_key.clvm": "(point_add 2 (pubkey_for_exp (sha256 2 5)))",
+		"sha256tree_module.clvm":              "(a (q 2 2 (c 2 (c 5 ()))) (c (q 2 (i (l 5) (q 11 (q . 2) (a 2 (c 2 (c 9 ()))) (a 2 (c 2 (c 13 ())))) (q 11 (q . 1) 5)) 1) 1))",
+	} {
+		src, err := examples.F.ReadFile(name)
+		require.NoError(t, err)
+		p, err := compileString(t, string(src))
+		require.NoError(t, err, name)
+		require.Equal(t, expected, p.Code.String(), name)
+	}
+}
+
+func TestCompileReferenceOutput(t *testing.T) {
+	// serialized programs and tree hashes from the reference compiler
+	for name, expected := range map[string]struct{ hex, hash string }{
+		"sha256tree_module.clvm": {
+			"ff02ffff01ff02ff02ffff04ff02ffff04ff05ff80808080ffff04ffff01ff02ffff03ffff07ff0580ffff01ff0bffff0102ffff02ff02ffff04ff02ffff04ff09ff80808080ffff02ff02ffff04ff02ffff04ff0dff8080808080ffff01ff0bffff0101ff058080ff0180ff018080",
+			"eb4ead6576048c9d730b5ced00646c7fdd390649cfdf48a00de1590cdd8ee18f",
+		},
+		"p2_delegated_puzzle_or_hidden_puzzle.clvm": {
+			"ff02ffff01ff02ffff03ff0bffff01ff02ffff03ffff09ff05ffff1dff0bffff1effff0bff0bffff02ff06ffff04ff02ffff04ff17ff8080808080808080ffff01ff02ff17ff2f80ffff01ff088080ff0180ffff01ff04ffff04ff04ffff04ff05ffff04ffff02ff06ffff04ff02ffff04ff17ff80808080ff80808080ffff02ff17ff2f808080ff0180ffff04ffff01ff32ff02ffff03ffff07ff0580ffff01ff0bffff0102ffff02ff06ffff04ff02ffff04ff09ff80808080ffff02ff06ffff04ff02ffff04ff0dff8080808080ffff01ff0bffff0101ff058080ff0180ff018080",
+			"e9aaa49f45bad5c889b86ee3341550c155cfdd10c3a6757de618d20612fffd52",
+		},
+	} {
+		src, err := examples.F.ReadFile(name)
+		require.NoError(t, err)
+		p, err := compileString(t, string(src))
+		require.NoError(t, err, name)
+		h, err := p.Code.Hex()
+		require.NoError(t, err)
+		require.Equal(t, expected.hex, h, name)
+		require.Equal(t, expected.hash, fmt.Sprintf("%x", p.Code.TreeHash()), name)
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	for src, expected := range map[string]string{
+		"(f (r 5))":                      "21",
+		"(r (f 1))":                      "6",
+		"(f (c 5 11))":                   "5",
+		"(c (q . 1) (c (q . 2) ()))":     "(q 1 2)",
+		"(+ (q . 1) (q . 2))":            "(q . 3)",
+		"(a (q 16 5 11) 1)":              "(+ 5 11)",
+		"(a (q 16 2 5) (c 11 (c 5 ())))": "(+ 11 5)",
+		"(a () 5)":                       "()",
+		"(c 5 (q))":                      "(c 5 ())",
+		"(x (q . 1))":                    "(x (q . 1))",
+		"(q . (f 5))":                    "(q 5 5)",
+	} {
+		v, err := clvm.Assemble(src)
+		require.NoError(t, err)
+		require.Equal(t, expected, newCompiler(&Module{}).optimize(v).String(), src)
+	}
+}
+
+func TestCompileAndRun(t *testing.T) {
+	p, err := compileString(t, `(mod (N (A B . REST))
+	(include condition_codes.clvm)
+	(defconstant BASE (1 2))
+	(defmacro twice (X) (qq (+ (unquote X) (unquote X))))
+	(defun fact (n) (if (= n 1) 1 (* n (fact (- n 1)))))
+	(defun-inline add (x y . more) (+ x y (f more)))
+	(defun sum (items) (if items (+ (f items) (sum (r items))) 0))
+	(list
+		(fact N)
+		(add A B 100)
+		(twice N)
+		(sum REST)
+		(qq ((unquote CREATE_COIN) (unquote A) . (unquote BASE)))
+		(assert (> N 1) (and A B) (or () B))
+		sum
+	)
+)`)
+	require.NoError(t, err)
+
+	env, err := clvm.Assemble("(5 (3 4 10 20 30))")
+	require.NoError(t, err)
+	res, _, err := clvm.Run(p.Code, env, 0)
+	require.NoError(t, err)
+	items, ok := res.ListItems()
+	require.True(t, ok)
+	require.Len(t, items, 7)
+	expected, err := clvm.Assemble("(120 107 10 60 (51 3 1 2) 1)")
+	require.NoError(t, err)
+	require.Equal(t, expected.String(), clvm.List(items[:6]...).String())
+	require.True(t, items[6].IsPair(), "a function used as a value is its code")
+
+	_, _, err = clvm.Run(p.Code, clvm.List(clvm.Int64(1), clvm.List(clvm.Int64(3), clvm.Int64(4))), 0)
+	require.Error(t, err, "assert raises")
+
+	for _, tc := range []struct{ src, message string }{
+		{"(mod (A) (foo . A))", "1:11: unknown operator 'foo'"},
+		{"(mod (A) (if A 1))", "1:11: 'if' takes exactly 3 arguments but got 2"},
+		{"(mod (A) (unquote A))", "1:11: unquote outside of qq"},
+		{"(condition_codes)", "1:2: only mod forms can be compiled"},
+	} {
+		_, err := compileString(t, tc.src)
+		require.EqualError(t, err, tc.message)
+	}
+}
+
+func TestCompileDeserialisation(t *testing.T) {
+	src, err := examples.F.ReadFile("chialisp_deserialisation.clvm")
+	require.NoError(t, err)
+	p, err := compileString(t, string(src))
+	require.NoError(t, err)
+
+	v, err := clvm.Assemble(`(51 (0xcafef00d "a long enough atom for a two bytes size prefix, a long enough atom") . 1000)`)
+	require.NoError(t, err)
+	b, err := clvm.Serialize(v)
+	require.NoError(t, err)
+	res, _, err := clvm.Run(p.Code, clvm.List(clvm.Atom(b)), 0)
+	require.NoError(t, err)
+	require.True(t, v.Equal(res), res.String())
+}
@@ -0,0 +1,219 @@
+package clls
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	lsp "go.lsp.dev/protocol"
+)
+
+func (m *Module) includedModules() []*Module {
+	mods := []*Module(nil)
+	visited := map[*Module]struct{}{m: {}}
+	var walk func(*Module)
+	walk = func(mod *Module) {
+		for _, incl := range mod.Includes {
+			if incl.Module == nil {
+				continue
+			}
+			if _, ok := visited[incl.Module]; ok {
+				continue
+			}
+			visited[incl.Module] = struct{}{}
+			mods = append(mods, incl.Module)
+			walk(incl.Module)
+		}
+	}
+	walk(m)
+	return mods
+}
+
+// allFunctions returns the module functions and the ones pulled in through includes
+func (m *Module) allFunctions() map[string]*Function {
+	r := map[string]*Function{}
+	for _, im := range m.includedModules() {
+		for k, v := range im.FunctionsByName {
+			r[k] = v
+		}
+	}
+	for k, v := range m.FunctionsByName {
+		r[k] = v
+	}
+	return r
+}
+
+// scopeVarTokens returns the parameters visible at the given position
+func (m *Module) scopeVarTokens(p lsp.Position) map[string]*Token {
+	for _, f := range m.Functions {
+		if f.Raw.containsPosition(p) {
+			return f.varTokens()
+		}
+	}
+	if m.IsMod {
+		return m.varTokens()
+	}
+	return nil
+}
+
+// inCallPosition reports whether the word at the given position is the first element of a list
+func (m *Module) inCallPosition(p lsp.Position) bool {
+	line, char := int(p.Line), int(p.Character)
+	prev := (*Token)(nil)
+	for _, t := range m.tokens {
+		if t.Line > line || (t.Line == line && t.StartChar >= char) {
+			break
+		}
+		if t.Kind == basicToken && t.Line == line && char <= t.EndChar() {
+			break // this is the word being completed
+		}
+		if t.Kind != spaceToken && t.Kind != lineReturnToken && t.Kind != commentToken {
+			prev = t
+		}
+	}
+	return prev != nil && prev.Kind == parensOpenToken
+}
+
+func escapeSnippet(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `$`, `\$`, `}`, `\}`).Replace(s)
+}
+
+// paramsPlaceholders returns the positional parameters of a params tree, stopping at a dotted rest parameter
+func paramsPlaceholders(params interface{}) []string {
+	n, ok := params.(*ASTNode)
+	if !ok {
+		return nil
+	}
+	r := []string(nil)
+	for _, c := range n.Children {
+		if t, ok := c.(*Token); ok && t.Value == "." {
+			break
+		}
+		r = append(r, nodeString(c))
+	}
+	return r
+}
+
+func builtinPlaceholders(name string) []string {
+	bd, ok := builtins[name]
+	if !ok || bd.MaxArgs == -1 {
+		return nil
+	}
+	return strings.Fields(strings.Trim(bd.Params, "()"))
+}
+
+func snippet(name string, placeholders []string) string {
+	s := escapeSnippet(name)
+	for i, p := range placeholders {
+		s += fmt.Sprintf(" ${%d:%s}", i+1, escapeSnippet(p))
+	}
+	return s
+}
+
+// Completions returns the parameters, functions, constants and builtins available at the given position
+func (m *Module) Completions(p lsp.Position) []lsp.CompletionItem {
+	inCall := m.inCallPosition(p)
+	items := []lsp.CompletionItem(nil)
+	seen := map[string]struct{}{}
+	add := func(item lsp.CompletionItem) {
+		if _, ok := seen[item.Label]; ok {
+			return
+		}
+		seen[item.Label] = struct{}{}
+		items = append(items, item)
+	}
+
+	vars := m.scopeVarTokens(p)
+	for _, name := range sortedKeys(vars) {
+		add(lsp.CompletionItem{
+			Label:    name,
+			Kind:     lsp.CompletionItemKindVariable,
+			Detail:   "parameter",
+			SortText: "0" + name,
+		})
+	}
+
+	funcs := m.allFunctions()
+	for _, name := range sortedKeys(funcs) {
+		f := funcs[name]
+		item := lsp.CompletionItem{
+			Label:    name,
+			Kind:     lsp.CompletionItemKindFunction,
+			Detail:   functionSignature(f),
+			SortText: "1" + name,
+		}
+		if inCall {
+			item.InsertText = snippet(name, paramsPlaceholders(f.Params))
+			item.InsertTextFormat = lsp.InsertTextFormatSnippet
+		}
+		add(item)
+	}
+
+	consts := m.constTokens()
+	for _, name := range sortedKeys(consts) {
+		add(lsp.CompletionItem{
+			Label:    name,
+			Kind:     lsp.CompletionItemKindConstant,
+			Detail:   "constant",
+			SortText: "2" + name,
+		})
+	}
+
+	for _, f := range builtinFuncs {
+		name := f.Name.Value
+		item := lsp.CompletionItem{
+			Label:    name,
+			Kind:     lsp.CompletionItemKindFunction,
+			Detail:   functionSignature(f),
+			SortText: "3" + name,
+		}
+		if inCall {
+			item.InsertText = snippet(name, builtinPlaceholders(name))
+			item.InsertTextFormat = lsp.InsertTextFormatSnippet
+		}
+		add(item)
+	}
+
+	return items
+}
+
+// ResolveCompletion fills the documentation of a completion item returned by Completions
+func (m *Module) ResolveCompletion(item *lsp.CompletionItem) {
+	tok := (*Token)(nil)
+	switch item.Kind {
+	case lsp.CompletionItemKindFunction:
+		if f, ok := m.allFunctions()[item.Label]; ok && f.Name != nil {
+			tok = f.Name
+		} else if f, ok := BuiltinFuncsByName[item.Label]; ok {
+			tok = f.Name
+		}
+	case lsp.CompletionItemKindConstant:
+		tok = m.constTokens()[item.Label]
+	}
+	if tok == nil {
+		return
+	}
+	if doc := m.Hover(&Symbol{Token: tok}); doc != "" {
+		item.Documentation = lsp.MarkupContent{Kind: lsp.Markdown, Value: doc}
+	}
+}
+
+func sortedKeys(m interface{}) []string {
+	keys := []string(nil)
+	switch m := m.(type) {
+	case map[string]*Token:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*Function:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*include:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
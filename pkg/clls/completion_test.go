@@ -0,0 +1,97 @@
+package clls
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+	"go.uber.org/zap"
+)
+
+const completionSource = `(mod (A B)
+	(include lib.clib)
+	; the answer
+	(defconstant ANSWER 42)
+	; sums its arguments
+	(defun add (x y . rest) (+ x y))
+	(add A (double B))
+)`
+
+func loadCompletionModule(t *testing.T) *Module {
+	mod, err := LoadCLVMFromStrings(zap.NewNop(), uri.New("file://main.clvm"), map[lsp.DocumentURI]string{
+		uri.New("file://main.clvm"): completionSource,
+		uri.New("file://lib.clib"):  "((defun double (x) (* x 2)))",
+	})
+	require.NoError(t, err)
+	return mod
+}
+
+func completionsByLabel(items []lsp.CompletionItem) map[string]lsp.CompletionItem {
+	r := map[string]lsp.CompletionItem{}
+	for _, item := range items {
+		r[item.Label] = item
+	}
+	return r
+}
+
+func TestCompletions(t *testing.T) {
+	mod := loadCompletionModule(t)
+
+	// in the body of add, in call position
+	items := completionsByLabel(mod.Completions(lsp.Position{Line: 5, Character: 26}))
+	require.Contains(t, items, "x")
+	require.Contains(t, items, "rest")
+	require.NotContains(t, items, "A", "the module arguments are not visible in functions")
+	require.Equal(t, lsp.CompletionItem{
+		Label:            "add",
+		Kind:             lsp.CompletionItemKindFunction,
+		Detail:           "(defun add (x y . rest))",
+		SortText:         "1add",
+		InsertText:       "add ${1:x} ${2:y}",
+		InsertTextFormat: lsp.InsertTextFormatSnippet,
+	}, items["add"])
+	require.Equal(t, "double ${1:x}", items["double"].InsertText, "included functions")
+	require.Equal(t, lsp.CompletionItem{Label: "ANSWER", Kind: lsp.CompletionItemKindConstant, Detail: "constant", SortText: "2ANSWER"}, items["ANSWER"])
+	require.Equal(t, "sha256", items["sha256"].Label)
+	require.Equal(t, "sha256", items["sha256"].InsertText, "any number of arguments")
+	require.Equal(t, "i ${1:cond} ${2:then} ${3:else}", items["i"].InsertText)
+
+	// in the main expression, as an argument
+	items = completionsByLabel(mod.Completions(lsp.Position{Line: 6, Character: 8}))
+	require.Equal(t, lsp.CompletionItem{Label: "A", Kind: lsp.CompletionItemKindVariable, Detail: "parameter", SortText: "0A"}, items["A"])
+	require.NotContains(t, items, "rest")
+	require.Empty(t, items["add"].InsertText, "no snippet outside of call position")
+	require.Equal(t, lsp.InsertTextFormat(0), items["add"].InsertTextFormat)
+
+	// parameters come first, then functions, constants and builtins
+	all := mod.Completions(lsp.Position{Line: 6, Character: 8})
+	require.Equal(t, "A", all[0].Label)
+	require.Equal(t, "B", all[1].Label)
+	require.Equal(t, "add", all[2].Label)
+	require.Equal(t, "double", all[3].Label)
+	require.Equal(t, "ANSWER", all[4].Label)
+}
+
+func TestResolveCompletion(t *testing.T) {
+	mod := loadCompletionModule(t)
+	items := completionsByLabel(mod.Completions(lsp.Position{Line: 6, Character: 2}))
+
+	for label, doc := range map[string]string{
+		"add":    "```chialisp\n(defun add (x y . rest))\n```\n\nsums its arguments",
+		"ANSWER": "```chialisp\n(defconstant ANSWER 42)\n```\n\nthe answer",
+		"double": "```chialisp\n(defun double (x))\n```\n\nDefined in `file://lib.clib`",
+	} {
+		item := items[label]
+		mod.ResolveCompletion(&item)
+		require.Equal(t, lsp.MarkupContent{Kind: lsp.Markdown, Value: doc}, item.Documentation, label)
+	}
+
+	item := items["sha256"]
+	mod.ResolveCompletion(&item)
+	require.Contains(t, item.Documentation.(lsp.MarkupContent).Value, "```chialisp\n(sha256 ")
+
+	item = items["A"]
+	mod.ResolveCompletion(&item)
+	require.Nil(t, item.Documentation, "parameters have no documentation")
+}
@@ -0,0 +1,70 @@
+package clls
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	lsp "go.lsp.dev/protocol"
+)
+
+// OffsetAt returns the byte offset of the position in the text, characters are UTF-16 code units
+// as in the protocol and a character past the end of its line stands for the end of the line
+func OffsetAt(text string, p lsp.Position) (int, error) {
+	off := 0
+	for line := uint32(0); line < p.Line; line++ {
+		i := strings.IndexAny(text[off:], "\r\n")
+		if i < 0 {
+			return 0, errors.Errorf("line %d out of range", p.Line)
+		}
+		off += i + 1
+		if text[off-1] == '\r' && off < len(text) && text[off] == '\n' {
+			off++
+		}
+	}
+
+	units := uint32(0)
+	for i, r := range text[off:] {
+		if r == '\n' || r == '\r' {
+			return off + i, nil
+		}
+		n := uint32(1)
+		if r >= 0x10000 {
+			n = 2 // surrogate pair
+		}
+		if units+n > p.Character {
+			return off + i, nil
+		}
+		units += n
+	}
+	return len(text), nil
+}
+
+// ContentChange is a change of a document as sent by the client, a change without range replaces the whole text.
+// The protocol package decodes a missing range as the empty range at the start of the document.
+type ContentChange struct {
+	Range *lsp.Range `json:"range,omitempty"`
+	Text  string     `json:"text"`
+}
+
+// ApplyContentChanges returns the text with the changes applied in order
+func ApplyContentChanges(text string, changes []ContentChange) (string, error) {
+	for _, c := range changes {
+		if c.Range == nil {
+			text = c.Text
+			continue
+		}
+		start, err := OffsetAt(text, c.Range.Start)
+		if err != nil {
+			return "", errors.Wrap(err, "range start")
+		}
+		end, err := OffsetAt(text, c.Range.End)
+		if err != nil {
+			return "", errors.Wrap(err, "range end")
+		}
+		if end < start {
+			return "", errors.New("range end before start")
+		}
+		text = text[:start] + c.Text + text[end:]
+	}
+	return text, nil
+}
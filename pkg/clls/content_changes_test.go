@@ -0,0 +1,72 @@
+package clls
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	lsp "go.lsp.dev/protocol"
+)
+
+func change(startLine, startChar, endLine, endChar uint32, text string) ContentChange {
+	return ContentChange{
+		Range: &lsp.Range{
+			Start: lsp.Position{Line: startLine, Character: startChar},
+			End:   lsp.Position{Line: endLine, Character: endChar},
+		},
+		Text: text,
+	}
+}
+
+func TestOffsetAt(t *testing.T) {
+	text := "(mod ()\r\n  \"é𝄞x\"\n)"
+
+	off, err := OffsetAt(text, lsp.Position{Line: 1, Character: 4})
+	require.NoError(t, err)
+	require.Equal(t, "𝄞x\"\n)", text[off:])
+
+	off, err = OffsetAt(text, lsp.Position{Line: 1, Character: 6})
+	require.NoError(t, err)
+	require.Equal(t, "x\"\n)", text[off:])
+
+	off, err = OffsetAt(text, lsp.Position{Line: 1, Character: 5})
+	require.NoError(t, err)
+	require.Equal(t, "𝄞x\"\n)", text[off:], "inside a surrogate pair")
+
+	off, err = OffsetAt(text, lsp.Position{Line: 0, Character: 100})
+	require.NoError(t, err)
+	require.Equal(t, "\r\n  \"é𝄞x\"\n)", text[off:])
+
+	off, err = OffsetAt(text, lsp.Position{Line: 2, Character: 1})
+	require.NoError(t, err)
+	require.Equal(t, len(text), off)
+
+	_, err = OffsetAt(text, lsp.Position{Line: 3})
+	require.Error(t, err)
+}
+
+func TestApplyContentChanges(t *testing.T) {
+	text, err := ApplyContentChanges("(mod (A)\n  \"𝄞\"\n  A\n)", []ContentChange{
+		change(1, 3, 1, 5, "hello"),
+		change(2, 2, 2, 3, "(+ A 1)"),
+		change(0, 6, 0, 6, "B "),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "(mod (B A)\n  \"hello\"\n  (+ A 1)\n)", text)
+
+	_, err = ApplyContentChanges("(mod ())", []ContentChange{change(0, 4, 0, 2, "")})
+	require.Error(t, err)
+
+	text, err = ApplyContentChanges("(mod ())", []ContentChange{
+		change(0, 5, 0, 7, "(A)"),
+		{Text: "(mod (B)\n  B\n)"},
+		change(1, 2, 1, 3, "(+ B 1)"),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "(mod (B)\n  (+ B 1)\n)", text, "a change without range replaces the text")
+
+	changes := []ContentChange(nil)
+	require.NoError(t, json.Unmarshal([]byte(`[{"text":"(mod ())"},{"range":{"start":{"line":0,"character":0},"end":{"line":0,"character":0}},"text":";"}]`), &changes))
+	require.Nil(t, changes[0].Range)
+	require.NotNil(t, changes[1].Range)
+}
@@ -0,0 +1,56 @@
+package clls
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/clls-dev/clls/pkg/clvm"
+	"github.com/pkg/errors"
+)
+
+// CurriedParams returns the names of the leading uppercase parameters of the mod, the ones meant to be curried
+func (m *Module) CurriedParams() []string {
+	n, ok := m.Args.(*ASTNode)
+	if !ok {
+		return nil
+	}
+	names := []string(nil)
+	for _, c := range n.Children {
+		t, ok := c.(*Token)
+		if !ok || t.Kind != basicToken || !isCurriedName(t.Text) {
+			break
+		}
+		names = append(names, t.Text)
+	}
+	return names
+}
+
+func isCurriedName(s string) bool {
+	return s != "." && s == strings.ToUpper(s) && s != strings.ToLower(s)
+}
+
+var namedArgRegexp = regexp.MustCompile(`^([A-Z_][A-Z0-9_]*)=(.*)$`)
+
+// CurryArgs assembles the values to curry into the mod, each one can be prefixed by the name of its parameter as in NAME=value,
+// there must be one value per curried parameter
+func (m *Module) CurryArgs(args []string) ([]*clvm.Value, error) {
+	params := m.CurriedParams()
+	if len(args) != len(params) {
+		return nil, errors.Errorf("expected %d curried argument(s) %v but got %d", len(params), params, len(args))
+	}
+	values := make([]*clvm.Value, len(args))
+	for i, a := range args {
+		if match := namedArgRegexp.FindStringSubmatch(a); match != nil {
+			if match[1] != params[i] {
+				return nil, errors.Errorf("argument %d is named %s but the parameter is %s", i+1, match[1], params[i])
+			}
+			a = match[2]
+		}
+		v, err := clvm.Assemble(a)
+		if err != nil {
+			return nil, errors.Wrapf(err, "assemble %s", params[i])
+		}
+		values[i] = v
+	}
+	return values, nil
+}
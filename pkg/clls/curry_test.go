@@ -0,0 +1,28 @@
+package clls
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+	"go.uber.org/zap"
+)
+
+func TestCurryArgs(t *testing.T) {
+	mod, err := LoadCLVMFromStrings(zap.NewNop(), uri.New("file://main.clvm"), map[lsp.DocumentURI]string{
+		uri.New("file://main.clvm"): "(mod (MOD_HASH AMOUNT2 solution) (list MOD_HASH AMOUNT2 solution))",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"MOD_HASH", "AMOUNT2"}, mod.CurriedParams())
+
+	args, err := mod.CurryArgs([]string{"MOD_HASH=0xcafef00d", "(1 2)"})
+	require.NoError(t, err)
+	require.Equal(t, "0xcafef00d", args[0].String())
+	require.Equal(t, "(q 2)", args[1].String())
+
+	_, err = mod.CurryArgs([]string{"0xcafe"})
+	require.EqualError(t, err, "expected 2 curried argument(s) [MOD_HASH AMOUNT2] but got 1")
+	_, err = mod.CurryArgs([]string{"AMOUNT2=1", "MOD_HASH=2"})
+	require.EqualError(t, err, "argument 1 is named AMOUNT2 but the parameter is MOD_HASH")
+}
@@ -0,0 +1,293 @@
+package clls
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/clls-dev/clls/pkg/clvm"
+	"github.com/pkg/errors"
+	lsp "go.lsp.dev/protocol"
+)
+
+// DebugStep tells a debugger how far to run before stopping again
+type DebugStep int
+
+const (
+	DebugContinue DebugStep = iota // until a breakpoint
+	DebugStepIn                    // until the next expression
+	DebugStepOver                  // until another line of the current frame or a caller
+	DebugStepOut                   // until the current frame returns
+)
+
+// DebugFrame is a running mod or function body, Token is the innermost expression being evaluated in it
+type DebugFrame struct {
+	*Frame
+	Env   *clvm.Value
+	Token *Token
+}
+
+// Value returns the value of a parameter of the frame
+func (f *DebugFrame) Value(name string) (*clvm.Value, error) {
+	for _, p := range f.Params {
+		if p.Name == name {
+			return clvm.TraversePath(p.Path.Atom, f.Env)
+		}
+	}
+	return nil, errors.Errorf("unknown parameter '%s'", name)
+}
+
+// DebugStop describes a debugged program when it stops, Frames go from the innermost to the outermost one
+type DebugStop struct {
+	Reason string // entry, step, breakpoint, pause or exception
+	Frames []*DebugFrame
+	Done   bool // the program finished with Result or failed with Err
+	Result *clvm.Value
+	Cost   uint64
+	Err    error
+}
+
+var errDebugAborted = errors.New("debug session closed")
+
+type openStep struct {
+	depth int
+	token *Token
+}
+
+type runningFrame struct {
+	frame *Frame
+	env   *clvm.Value
+	depth int
+	steps []openStep // expressions of the frame being evaluated, innermost last
+	token *Token     // last expression evaluated in the frame
+}
+
+// Debugger runs a program step by step, a step is the evaluation of an expression written in the source
+type Debugger struct {
+	program *Program
+	env     *clvm.Value
+	maxCost uint64
+	lines   map[lsp.DocumentURI]map[int]struct{} // lines having steps
+
+	mu          sync.Mutex
+	breakpoints map[lsp.DocumentURI]map[int]struct{}
+	paused      bool
+
+	started  bool
+	resume   chan DebugStep
+	stops    chan *DebugStop
+	quit     chan struct{}
+	quitOnce sync.Once
+	done     *DebugStop
+
+	// owned by the run goroutine
+	frames       []*runningFrame
+	step         DebugStep
+	originFrames int
+	origin       *Token
+	last         *Token
+}
+
+// Debug prepares a debugger running the program with env as its environment
+func (p *Program) Debug(env *clvm.Value, maxCost uint64) *Debugger {
+	d := &Debugger{
+		program:     p,
+		env:         env,
+		maxCost:     maxCost,
+		lines:       map[lsp.DocumentURI]map[int]struct{}{},
+		breakpoints: map[lsp.DocumentURI]map[int]struct{}{},
+		resume:      make(chan DebugStep),
+		stops:       make(chan *DebugStop),
+		quit:        make(chan struct{}),
+	}
+	for v, t := range p.Sources {
+		if !isDebugStep(v) {
+			continue
+		}
+		if d.lines[t.DocumentURI] == nil {
+			d.lines[t.DocumentURI] = map[int]struct{}{}
+		}
+		d.lines[t.DocumentURI][t.Line] = struct{}{}
+	}
+	return d
+}
+
+// isDebugStep tells if evaluating the compiled node is worth stopping at, quotes and paths are not
+func isDebugStep(v *clvm.Value) bool {
+	return v.IsPair() && (v.First.IsPair() || !bytes.Equal(v.First.Atom, clvm.OperatorsByName["q"].OpcodeBytes()))
+}
+
+// SetBreakpoints replaces the breakpoints of a document, lines start at 0,
+// the result tells which lines have code to stop at
+func (d *Debugger) SetBreakpoints(u lsp.DocumentURI, lines []int) []bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	verified := make([]bool, len(lines))
+	bps := map[int]struct{}{}
+	for i, l := range lines {
+		bps[l] = struct{}{}
+		_, verified[i] = d.lines[u][l]
+	}
+	d.breakpoints[u] = bps
+	return verified
+}
+
+// Pause stops the running program at the next step
+func (d *Debugger) Pause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.paused = true
+}
+
+// Resume runs the program until the next stop, the first call starts it and stops at entry when step is DebugStepIn
+func (d *Debugger) Resume(step DebugStep) *DebugStop {
+	if d.done != nil {
+		return d.done
+	}
+	if !d.started {
+		d.started = true
+		d.step = step
+		go d.run()
+	} else {
+		select {
+		case d.resume <- step:
+		case <-d.quit:
+		}
+	}
+	select {
+	case stop := <-d.stops:
+		if stop.Done {
+			d.done = stop
+		}
+		return stop
+	case <-d.quit:
+		d.done = &DebugStop{Done: true, Err: errDebugAborted}
+		return d.done
+	}
+}
+
+// Close aborts the program
+func (d *Debugger) Close() {
+	d.quitOnce.Do(func() { close(d.quit) })
+}
+
+func (d *Debugger) run() {
+	res, cost, err := clvm.RunTraced(d.program.Code, d.env, d.maxCost, d.trace)
+	if err == errDebugAborted {
+		return
+	}
+	if err != nil {
+		// stop where the evaluation failed so that the environment can be inspected
+		if _, err := d.stop(&DebugStop{Reason: "exception", Frames: d.snapshot(), Err: err}); err != nil {
+			return
+		}
+	}
+	select {
+	case d.stops <- &DebugStop{Done: true, Result: res, Cost: cost, Err: err}:
+	case <-d.quit:
+	}
+}
+
+// stop hands the stop to Resume and waits for the next step
+func (d *Debugger) stop(s *DebugStop) (DebugStep, error) {
+	select {
+	case d.stops <- s:
+	case <-d.quit:
+		return 0, errDebugAborted
+	}
+	select {
+	case step := <-d.resume:
+		return step, nil
+	case <-d.quit:
+		return 0, errDebugAborted
+	}
+}
+
+func (d *Debugger) trace(program, env *clvm.Value, depth int) error {
+	// evaluations at the same depth or above have returned
+	for len(d.frames) > 0 && d.frames[len(d.frames)-1].depth >= depth {
+		d.frames = d.frames[:len(d.frames)-1]
+	}
+	if len(d.frames) > 0 {
+		top := d.frames[len(d.frames)-1]
+		for len(top.steps) > 0 && top.steps[len(top.steps)-1].depth >= depth {
+			top.steps = top.steps[:len(top.steps)-1]
+		}
+	}
+	if fr, ok := d.program.Frames[program]; ok {
+		d.frames = append(d.frames, &runningFrame{frame: fr, env: env, depth: depth})
+	}
+
+	t, ok := d.program.Sources[program]
+	if !ok || len(d.frames) == 0 || !isDebugStep(program) {
+		return nil
+	}
+	top := d.frames[len(d.frames)-1]
+	top.steps = append(top.steps, openStep{depth: depth, token: t})
+	top.token = t
+
+	reason := d.stopReason(t)
+	d.last = t
+	if reason == "" {
+		return nil
+	}
+	step, err := d.stop(&DebugStop{Reason: reason, Frames: d.snapshot()})
+	if err != nil {
+		return err
+	}
+	d.step, d.originFrames, d.origin = step, len(d.frames), t
+	return nil
+}
+
+func sameLine(a, b *Token) bool {
+	return a != nil && b != nil && a.DocumentURI == b.DocumentURI && a.Line == b.Line
+}
+
+func (d *Debugger) stopReason(t *Token) string {
+	if d.last == nil && d.step == DebugStepIn {
+		return "entry"
+	}
+
+	d.mu.Lock()
+	paused := d.paused
+	d.paused = false
+	_, breakpoint := d.breakpoints[t.DocumentURI][t.Line]
+	d.mu.Unlock()
+
+	switch {
+	case paused:
+		return "pause"
+	case breakpoint && !sameLine(d.last, t):
+		return "breakpoint"
+	}
+
+	n := len(d.frames)
+	switch d.step {
+	case DebugStepIn:
+		return "step"
+	case DebugStepOver:
+		if n < d.originFrames || (n == d.originFrames && !sameLine(d.origin, t)) {
+			return "step"
+		}
+	case DebugStepOut:
+		if n < d.originFrames {
+			return "step"
+		}
+	}
+	return ""
+}
+
+func (d *Debugger) snapshot() []*DebugFrame {
+	frames := make([]*DebugFrame, 0, len(d.frames))
+	for i := len(d.frames) - 1; i >= 0; i-- {
+		f := d.frames[i]
+		t := f.token
+		if len(f.steps) > 0 {
+			t = f.steps[len(f.steps)-1].token
+		}
+		if t == nil && f.frame.Function != nil {
+			t = f.frame.Function.Name
+		}
+		frames = append(frames, &DebugFrame{Frame: f.frame, Env: f.env, Token: t})
+	}
+	return frames
+}
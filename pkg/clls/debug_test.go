@@ -0,0 +1,91 @@
+package clls
+
+import (
+	"testing"
+
+	"github.com/clls-dev/clls/pkg/clvm"
+	"github.com/stretchr/testify/require"
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+)
+
+func TestDebugger(t *testing.T) {
+	p, err := compileString(t, `(mod (N)
+	(defun fact (n)
+		(if (= n 1)
+			1
+			(* n (fact (- n 1)))))
+	(+ (fact N) (* N 2))
+)`)
+	require.NoError(t, err)
+	main := uri.New("file://main.clvm")
+	line := func(s *DebugStop) int { return s.Frames[0].Token.Line }
+	value := func(f *DebugFrame, name string) string {
+		v, err := f.Value(name)
+		require.NoError(t, err)
+		return v.String()
+	}
+
+	d := p.Debug(clvm.List(clvm.Int64(3)), 0)
+	defer d.Close()
+	require.Equal(t, []bool{true, false}, d.SetBreakpoints(main, []int{2, 1}))
+
+	s := d.Resume(DebugStepIn)
+	require.Equal(t, "entry", s.Reason)
+	require.Equal(t, 5, line(s))
+	require.Len(t, s.Frames, 1)
+	require.Equal(t, "mod", s.Frames[0].Name)
+	require.Equal(t, "3", value(s.Frames[0], "N"))
+
+	s = d.Resume(DebugContinue)
+	require.Equal(t, "breakpoint", s.Reason)
+	require.Equal(t, 2, line(s))
+	require.Len(t, s.Frames, 2)
+	require.Equal(t, "fact", s.Frames[0].Name)
+	require.Equal(t, "3", value(s.Frames[0], "n"))
+
+	s = d.Resume(DebugStepOver)
+	require.Equal(t, "step", s.Reason)
+	require.Equal(t, 4, line(s))
+	require.Len(t, s.Frames, 2)
+
+	s = d.Resume(DebugStepIn)
+	require.Equal(t, 4, line(s)) // (fact (- n 1))
+	s = d.Resume(DebugStepIn)
+	require.Equal(t, 4, line(s)) // (- n 1)
+	s = d.Resume(DebugStepIn)
+	require.Equal(t, "breakpoint", s.Reason)
+	require.Len(t, s.Frames, 3)
+	require.Equal(t, "2", value(s.Frames[0], "n"))
+	require.Equal(t, "3", value(s.Frames[1], "n"))
+
+	d.SetBreakpoints(main, nil)
+	s = d.Resume(DebugStepOut)
+	require.Equal(t, "step", s.Reason)
+	require.Len(t, s.Frames, 1)
+
+	s = d.Resume(DebugContinue)
+	require.True(t, s.Done)
+	require.NoError(t, s.Err)
+	require.Equal(t, "12", s.Result.String())
+}
+
+func TestDebuggerException(t *testing.T) {
+	p, err := compileString(t, `(mod (A)
+	(defun check (a) (if a a (x)))
+	(check A)
+)`)
+	require.NoError(t, err)
+	d := p.Debug(clvm.List(clvm.Nil), 0)
+	defer d.Close()
+
+	s := d.Resume(DebugContinue)
+	require.Equal(t, "exception", s.Reason)
+	require.Error(t, s.Err)
+	require.Equal(t, "check", s.Frames[0].Name)
+	require.Equal(t, lsp.DocumentURI("file://main.clvm"), s.Frames[0].Token.DocumentURI)
+
+	s = d.Resume(DebugContinue)
+	require.True(t, s.Done)
+	require.Error(t, s.Err)
+}
@@ -0,0 +1,114 @@
+package clls
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	lsp "go.lsp.dev/protocol"
+)
+
+// Problem is an issue found in a document, attached to a range of it
+type Problem struct {
+	Range    lsp.Range
+	Severity lsp.DiagnosticSeverity
+	Message  string
+}
+
+func (p *Problem) Error() string {
+	return fmt.Sprintf("%d:%d: %s", p.Range.Start.Line+1, p.Range.Start.Character+1, p.Message)
+}
+
+func (p *Problem) Diagnostic() lsp.Diagnostic {
+	severity := p.Severity
+	if severity == 0 {
+		severity = lsp.DiagnosticSeverityError
+	}
+	return lsp.Diagnostic{
+		Range:    p.Range,
+		Severity: severity,
+		Source:   CommandName,
+		Message:  p.Message,
+	}
+}
+
+func newProblem(r lsp.Range, severity lsp.DiagnosticSeverity, format string, args ...interface{}) *Problem {
+	return &Problem{Range: r, Severity: severity, Message: fmt.Sprintf(format, args...)}
+}
+
+// nodeRange returns the source range covered by a syntax tree node
+func nodeRange(n interface{}) lsp.Range {
+	switch n := n.(type) {
+	case *Token:
+		if n != nil {
+			return n.Range()
+		}
+	case *ASTNode:
+		if n == nil || n.OpenToken == nil {
+			break
+		}
+		r := n.OpenToken.Range()
+		if n.CloseToken != nil {
+			r.End = n.CloseToken.Range().End
+		}
+		return r
+	}
+	return lsp.Range{}
+}
+
+// ErrorDiagnostic converts an error returned while loading a module into a diagnostic,
+// using the location of the underlying problem if there is one
+func ErrorDiagnostic(err error) lsp.Diagnostic {
+	if p, ok := errors.Cause(err).(*Problem); ok {
+		return p.Diagnostic()
+	}
+	return lsp.Diagnostic{
+		Severity: lsp.DiagnosticSeverityError,
+		Source:   CommandName,
+		Message:  err.Error(),
+	}
+}
+
+// Diagnostics returns the problems found while loading the module, including failed includes
+func (m *Module) Diagnostics() []lsp.Diagnostic {
+	diags := []lsp.Diagnostic{}
+	for _, p := range m.Problems {
+		diags = append(diags, p.Diagnostic())
+	}
+	for _, p := range m.Check() {
+		diags = append(diags, p.Diagnostic())
+	}
+	for _, k := range sortedKeys(m.Includes) {
+		incl := m.Includes[k]
+		if incl.LoadError == nil {
+			continue
+		}
+		r := nodeRange(incl.Value)
+		if incl.Value == nil {
+			r = incl.Token.Range()
+		}
+		diags = append(diags, newProblem(r, lsp.DiagnosticSeverityError, "failed to include '%s': %s", k, incl.LoadError).Diagnostic())
+	}
+	for _, k := range sortedKeys(m.Includes) {
+		incl := m.Includes[k]
+		if err := incl.circularInclude(m.uri); err != nil {
+			diags = append(diags, newProblem(nodeRange(incl.Value), lsp.DiagnosticSeverityError, "%s", err).Diagnostic())
+		}
+	}
+	return diags
+}
+
+// circularInclude returns the error of a deeper include looping back to the given file through this include,
+// the loader detects the loop where it closes, so it would not be reported in the file starting it otherwise
+func (incl *include) circularInclude(u lsp.DocumentURI) error {
+	if incl.Module == nil || u == "" {
+		return nil
+	}
+	for _, mod := range append([]*Module{incl.Module}, incl.Module.includedModules()...) {
+		for _, k := range sortedKeys(mod.Includes) {
+			if err, ok := mod.Includes[k].LoadError.(*circularIncludeError); ok && err.chain[0] == u {
+				return err
+			}
+		}
+	}
+	return nil
+}
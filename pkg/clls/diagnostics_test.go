@@ -0,0 +1,73 @@
+package clls
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+	"go.uber.org/zap"
+)
+
+func lspRange(startLine, startChar, endLine, endChar uint32) lsp.Range {
+	return lsp.Range{
+		Start: lsp.Position{Line: startLine, Character: startChar},
+		End:   lsp.Position{Line: endLine, Character: endChar},
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	cases := []struct {
+		name  string
+		text  string
+		diags []lsp.Diagnostic
+	}{
+		{"valid", "(mod (A)\n  (+ A 1)\n)", []lsp.Diagnostic{}},
+		{"unexpected closing parenthesis", "(mod (A)\n  (+ A 1))\n)", []lsp.Diagnostic{{
+			Range: lspRange(2, 0, 2, 1), Severity: lsp.DiagnosticSeverityError, Source: CommandName, Message: "unexpected closing parenthesis",
+		}}},
+		{"unclosed parenthesis", "(mod (A)\n  (+ A 1)\n", []lsp.Diagnostic{{
+			Range: lspRange(0, 0, 0, 1), Severity: lsp.DiagnosticSeverityError, Source: CommandName, Message: "unclosed parenthesis",
+		}}},
+		{"failed include", "(mod (A)\n  (include missing.clib)\n  (c A A)\n)", []lsp.Diagnostic{{
+			Range: lspRange(1, 11, 1, 23), Severity: lsp.DiagnosticSeverityError, Source: CommandName,
+			Message: "failed to include 'missing.clib': read file: unknown file 'file://missing.clib'",
+		}}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mod, err := LoadCLVM(zap.NewNop(), uri.New("file://main.clvm"), func(u lsp.DocumentURI) (string, error) {
+				if u != uri.New("file://main.clvm") {
+					return "", fmt.Errorf("unknown file '%s'", u)
+				}
+				return c.text, nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, c.diags, mod.Diagnostics())
+		})
+	}
+}
+
+func TestErrorDiagnostic(t *testing.T) {
+	// the tokenizer fails on unclosed strings, the diagnostic spans until the end of the document
+	_, err := LoadCLVMFromStrings(zap.NewNop(), uri.New("file://main.clvm"), map[lsp.DocumentURI]string{
+		uri.New("file://main.clvm"): "(mod (A)\n  (concat A \"unclosed)\n)",
+	})
+	require.Error(t, err)
+	require.Equal(t, lsp.Diagnostic{
+		Range: lspRange(1, 12, 2, 1), Severity: lsp.DiagnosticSeverityError, Source: CommandName, Message: "unclosed quote",
+	}, ErrorDiagnostic(err))
+
+	// the end character counts UTF-16 code units, 𝄞 takes two of them and é one
+	_, err = LoadCLVMFromStrings(zap.NewNop(), uri.New("file://main.clvm"), map[lsp.DocumentURI]string{
+		uri.New("file://main.clvm"): "(mod (A)\n  (concat A \"unclosed)\n) ; 𝄞 é",
+	})
+	require.Error(t, err)
+	require.Equal(t, lspRange(1, 12, 2, 8), ErrorDiagnostic(err).Range)
+
+	require.Equal(t, lsp.Diagnostic{
+		Severity: lsp.DiagnosticSeverityError, Source: CommandName, Message: "parse modules: no modules in file",
+	}, ErrorDiagnostic(errors.Wrap(errors.New("no modules in file"), "parse modules")))
+}
@@ -0,0 +1,45 @@
+package clls
+
+import (
+	"sort"
+
+	lsp "go.lsp.dev/protocol"
+)
+
+// resolvedIncludes returns the includes whose file was loaded, in source order
+func (m *Module) resolvedIncludes() []*include {
+	r := []*include(nil)
+	for _, incl := range m.Includes {
+		if _, ok := incl.Value.(*Token); ok && incl.Module != nil && incl.URI != "" {
+			r = append(r, incl)
+		}
+	}
+	sort.Slice(r, func(i, j int) bool {
+		return positionBefore(nodeRange(r[i].Value).Start, nodeRange(r[j].Value).Start)
+	})
+	return r
+}
+
+// DocumentLinks returns a link to the included file on each include path,
+// paths that failed to load are left out since their diagnostics explain why
+func (m *Module) DocumentLinks() []lsp.DocumentLink {
+	links := []lsp.DocumentLink{}
+	for _, incl := range m.resolvedIncludes() {
+		links = append(links, lsp.DocumentLink{
+			Range:   nodeRange(incl.Value),
+			Target:  incl.URI,
+			Tooltip: incl.URI.Filename(),
+		})
+	}
+	return links
+}
+
+// IncludeLocation returns the start of the included file when the position is on an include path
+func (m *Module) IncludeLocation(p lsp.Position) (lsp.Location, bool) {
+	for _, incl := range m.resolvedIncludes() {
+		if tokenContains(incl.Value.(*Token), p) {
+			return lsp.Location{URI: incl.URI}, true
+		}
+	}
+	return lsp.Location{}, false
+}
@@ -0,0 +1,41 @@
+package clls
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+	"go.uber.org/zap"
+)
+
+func TestDocumentLinks(t *testing.T) {
+	mod, err := LoadCLVMFromStrings(zap.NewNop(), uri.New("file:///puzzles/main.clvm"), map[lsp.DocumentURI]string{
+		uri.New("file:///puzzles/main.clvm"): `(mod (A)
+	(include condition_codes.clvm)
+	(include missing.clib)
+	(include lib/curry.clib)
+	A
+)`,
+		uri.New("file:///puzzles/condition_codes.clvm"): ConditionCodes,
+		uri.New("file:///puzzles/lib/curry.clib"):       "((defun curry (m a) (c m a)))",
+	})
+	require.NoError(t, err)
+
+	links := mod.DocumentLinks()
+	require.Len(t, links, 2)
+	require.Equal(t, uri.New("file:///puzzles/condition_codes.clvm"), links[0].Target)
+	require.Equal(t, lsp.Range{Start: lsp.Position{Line: 1, Character: 10}, End: lsp.Position{Line: 1, Character: 30}}, links[0].Range)
+	require.Equal(t, uri.New("file:///puzzles/lib/curry.clib"), links[1].Target)
+
+	loc, ok := mod.IncludeLocation(lsp.Position{Line: 3, Character: 14})
+	require.True(t, ok)
+	require.Equal(t, uri.New("file:///puzzles/lib/curry.clib"), loc.URI)
+
+	_, ok = mod.IncludeLocation(lsp.Position{Line: 2, Character: 14})
+	require.False(t, ok)
+
+	diags := mod.Diagnostics()
+	require.Len(t, diags, 1)
+	require.Equal(t, uint32(2), diags[0].Range.Start.Line)
+}
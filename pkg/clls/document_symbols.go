@@ -0,0 +1,134 @@
+package clls
+
+import (
+	"sort"
+
+	lsp "go.lsp.dev/protocol"
+)
+
+// paramsTokensList returns the names of a parameters tree in source order
+func paramsTokensList(n interface{}) []*Token {
+	switch n := n.(type) {
+	case *Token:
+		if n != nil && n.Kind == basicToken && n.Text != "." {
+			return []*Token{n}
+		}
+	case *ASTNode:
+		if n == nil {
+			return nil
+		}
+		toks := []*Token(nil)
+		for _, c := range n.Children {
+			toks = append(toks, paramsTokensList(c)...)
+		}
+		return toks
+	}
+	return nil
+}
+
+func paramsSymbols(params interface{}) []lsp.DocumentSymbol {
+	syms := []lsp.DocumentSymbol(nil)
+	for _, t := range paramsTokensList(params) {
+		syms = append(syms, lsp.DocumentSymbol{
+			Name:           t.Value,
+			Kind:           lsp.SymbolKindVariable,
+			Range:          t.Range(),
+			SelectionRange: t.Range(),
+		})
+	}
+	return syms
+}
+
+var functionSymbolKinds = map[string]lsp.SymbolKind{
+	"defun":        lsp.SymbolKindFunction,
+	"defun-inline": lsp.SymbolKindMethod,
+	"defmacro":     lsp.SymbolKindOperator,
+}
+
+func functionSymbol(f *Function) (lsp.DocumentSymbol, bool) {
+	if f.Name == nil || f.Raw == nil {
+		return lsp.DocumentSymbol{}, false
+	}
+	keyword := "defun"
+	if f.KeywordToken != nil {
+		keyword = f.KeywordToken.Value
+	}
+	return lsp.DocumentSymbol{
+		Name:           f.Name.Value,
+		Detail:         keyword + " " + nodeString(f.Params),
+		Kind:           functionSymbolKinds[keyword],
+		Range:          nodeRange(f.Raw),
+		SelectionRange: f.Name.Range(),
+		Children:       paramsSymbols(f.Params),
+	}, true
+}
+
+func constantSymbol(c *constant) (lsp.DocumentSymbol, bool) {
+	name, ok := c.Name.(*Token)
+	if !ok || c.Raw == nil {
+		return lsp.DocumentSymbol{}, false
+	}
+	detail := ""
+	if len(c.Raw.Children) > 2 {
+		detail = nodeString(c.Raw.Children[2])
+	}
+	return lsp.DocumentSymbol{
+		Name:           name.Value,
+		Detail:         detail,
+		Kind:           lsp.SymbolKindConstant,
+		Range:          nodeRange(c.Raw),
+		SelectionRange: name.Range(),
+	}, true
+}
+
+func includeSymbol(incl *include) (lsp.DocumentSymbol, bool) {
+	path, ok := incl.Value.(*Token)
+	if !ok || incl.Raw == nil {
+		return lsp.DocumentSymbol{}, false
+	}
+	return lsp.DocumentSymbol{
+		Name:           path.Value,
+		Detail:         "include",
+		Kind:           lsp.SymbolKindFile,
+		Range:          nodeRange(incl.Raw),
+		SelectionRange: path.Range(),
+	}, true
+}
+
+func positionBefore(a, b lsp.Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Character < b.Character)
+}
+
+// DocumentSymbols returns the outline of the module, the definitions are children of the mod symbol
+// when the file is a mod and top-level symbols otherwise
+func (m *Module) DocumentSymbols() []lsp.DocumentSymbol {
+	defs := []lsp.DocumentSymbol(nil)
+	for _, incl := range m.Includes {
+		if sym, ok := includeSymbol(incl); ok {
+			defs = append(defs, sym)
+		}
+	}
+	for _, c := range m.Constants {
+		if sym, ok := constantSymbol(c); ok {
+			defs = append(defs, sym)
+		}
+	}
+	for _, f := range m.Functions {
+		if sym, ok := functionSymbol(f); ok {
+			defs = append(defs, sym)
+		}
+	}
+	sort.Slice(defs, func(i, j int) bool { return positionBefore(defs[i].Range.Start, defs[j].Range.Start) })
+
+	if !m.IsMod {
+		return defs
+	}
+	return []lsp.DocumentSymbol{{
+		Name:           "mod",
+		Detail:         nodeString(m.Args),
+		Kind:           lsp.SymbolKindModule,
+		Range:          nodeRange(m.Raw),
+		SelectionRange: m.ModToken.Range(),
+		Children:       append(paramsSymbols(m.Args), defs...),
+	}}
+}
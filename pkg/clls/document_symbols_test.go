@@ -0,0 +1,67 @@
+package clls
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+	"go.uber.org/zap"
+)
+
+func TestDocumentSymbols(t *testing.T) {
+	mod, err := LoadCLVMFromStrings(zap.NewNop(), uri.New("file://main.clvm"), map[lsp.DocumentURI]string{
+		uri.New("file://main.clvm"): `(mod (A (B . C))
+	(include condition_codes.clvm)
+	(defconstant ONE 1)
+	(defmacro twice (X) (qq (+ (unquote X) (unquote X))))
+	(defun-inline inc (x) (+ x ONE))
+	(defun add (x y)
+		(+ x y)
+	)
+	(add (inc A) (twice B))
+)`,
+		uri.New("file://condition_codes.clvm"): ConditionCodes,
+	})
+	require.NoError(t, err)
+
+	syms := mod.DocumentSymbols()
+	require.Len(t, syms, 1)
+	require.Equal(t, "mod", syms[0].Name)
+	require.Equal(t, lsp.SymbolKindModule, syms[0].Kind)
+	require.Equal(t, uint32(9), syms[0].Range.End.Line)
+
+	type entry struct {
+		name string
+		kind lsp.SymbolKind
+	}
+	children := []entry(nil)
+	for _, c := range syms[0].Children {
+		children = append(children, entry{c.Name, c.Kind})
+	}
+	require.Equal(t, []entry{
+		{"A", lsp.SymbolKindVariable},
+		{"B", lsp.SymbolKindVariable},
+		{"C", lsp.SymbolKindVariable},
+		{"condition_codes.clvm", lsp.SymbolKindFile},
+		{"ONE", lsp.SymbolKindConstant},
+		{"twice", lsp.SymbolKindOperator},
+		{"inc", lsp.SymbolKindMethod},
+		{"add", lsp.SymbolKindFunction},
+	}, children)
+
+	add := syms[0].Children[7]
+	require.Equal(t, lsp.Range{Start: lsp.Position{Line: 5, Character: 1}, End: lsp.Position{Line: 7, Character: 2}}, add.Range)
+	require.Equal(t, lsp.Range{Start: lsp.Position{Line: 5, Character: 8}, End: lsp.Position{Line: 5, Character: 11}}, add.SelectionRange)
+	require.Len(t, add.Children, 2)
+}
+
+func TestFunctionSymbolWithoutKeyword(t *testing.T) {
+	name := &Token{Value: "foo", Line: 1, StartChar: 7, Text: "foo"}
+	sym, ok := functionSymbol(&Function{Raw: &ASTNode{}, Name: name, Params: &Token{Value: "X", Text: "X"}})
+	require.True(t, ok)
+	require.Equal(t, "foo", sym.Name)
+	require.Equal(t, "defun X", sym.Detail)
+	require.Equal(t, lsp.SymbolKindFunction, sym.Kind)
+	require.Equal(t, name.Range(), sym.SelectionRange)
+}
@@ -0,0 +1,132 @@
+package clls
+
+import (
+	"sort"
+
+	lsp "go.lsp.dev/protocol"
+)
+
+// nodeFoldingRanges returns a range for every node of the tree spanning several lines
+func nodeFoldingRanges(n *ASTNode) []lsp.FoldingRange {
+	if n == nil {
+		return nil
+	}
+	r := []lsp.FoldingRange(nil)
+	if n.OpenToken != nil && n.CloseToken != nil && n.CloseToken.Line > n.OpenToken.Line {
+		r = append(r, lsp.FoldingRange{
+			StartLine:      uint32(n.OpenToken.Line),
+			StartCharacter: uint32(n.OpenToken.StartChar),
+			EndLine:        uint32(n.CloseToken.Line),
+			EndCharacter:   uint32(n.CloseToken.EndChar()),
+		})
+	}
+	for _, c := range n.Children {
+		if c, ok := c.(*ASTNode); ok {
+			r = append(r, nodeFoldingRanges(c)...)
+		}
+	}
+	return r
+}
+
+// lineComments returns the comments that are the first token on their line,
+// trailing comments after code don't belong to a comment block
+func lineComments(tokens []*Token) []*Token {
+	comments := []*Token(nil)
+	codeLine := -1
+	for _, t := range tokens {
+		switch t.Kind {
+		case spaceToken, lineReturnToken:
+		case commentToken:
+			if t.Line != codeLine {
+				comments = append(comments, t)
+			}
+		default:
+			codeLine = t.Line
+		}
+	}
+	return comments
+}
+
+// commentFoldingRanges returns a range for each run of comments on consecutive lines
+func commentFoldingRanges(tokens []*Token) []lsp.FoldingRange {
+	comments := lineComments(tokens)
+	r := []lsp.FoldingRange(nil)
+	for i := 0; i < len(comments); {
+		j := i
+		for j+1 < len(comments) && comments[j+1].Line == comments[j].Line+1 {
+			j++
+		}
+		if j > i {
+			r = append(r, lsp.FoldingRange{
+				StartLine:      uint32(comments[i].Line),
+				StartCharacter: uint32(comments[i].StartChar),
+				EndLine:        uint32(comments[j].Line),
+				EndCharacter:   uint32(comments[j].EndChar()),
+				Kind:           lsp.CommentFoldingRange,
+			})
+		}
+		i = j + 1
+	}
+	return r
+}
+
+// headerFoldingRange returns the range of the include and defconstant forms starting the module body
+func (m *Module) headerFoldingRange() (lsp.FoldingRange, bool) {
+	if m.Raw == nil {
+		return lsp.FoldingRange{}, false
+	}
+	children := m.Raw.Children
+	if m.IsMod {
+		if len(children) < 3 {
+			return lsp.FoldingRange{}, false
+		}
+		children = children[2:]
+	}
+	var first, last *ASTNode
+	for _, c := range children {
+		n, ok := c.(*ASTNode)
+		if !ok || len(n.Children) == 0 {
+			break
+		}
+		if t, ok := n.Children[0].(*Token); !ok || (t.Value != "include" && t.Value != "defconstant") {
+			break
+		}
+		if first == nil {
+			first = n
+		}
+		last = n
+	}
+	if first == nil || first.OpenToken == nil || last.CloseToken == nil || last.CloseToken.Line <= first.OpenToken.Line {
+		return lsp.FoldingRange{}, false
+	}
+	return lsp.FoldingRange{
+		StartLine:      uint32(first.OpenToken.Line),
+		StartCharacter: uint32(first.OpenToken.StartChar),
+		EndLine:        uint32(last.CloseToken.Line),
+		EndCharacter:   uint32(last.CloseToken.EndChar()),
+		Kind:           lsp.ImportsFoldingRange,
+	}, true
+}
+
+// FoldingRanges returns the foldable expressions, comment blocks and header of the module,
+// only the largest range starting on a given line is kept since editors fold by line
+func (m *Module) FoldingRanges() []lsp.FoldingRange {
+	all := nodeFoldingRanges(m.Raw)
+	if header, ok := m.headerFoldingRange(); ok {
+		all = append(all, header)
+	}
+	all = append(all, commentFoldingRanges(m.tokens)...)
+
+	byLine := map[uint32]lsp.FoldingRange{}
+	for _, fr := range all {
+		if prev, ok := byLine[fr.StartLine]; !ok || fr.EndLine > prev.EndLine {
+			byLine[fr.StartLine] = fr
+		}
+	}
+	r := make([]lsp.FoldingRange, 0, len(byLine))
+	for _, fr := range byLine {
+		r = append(r, fr)
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].StartLine < r[j].StartLine })
+	return r
+}
@@ -0,0 +1,75 @@
+package clls
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+	"go.uber.org/zap"
+)
+
+func TestFoldingRanges(t *testing.T) {
+	mod, err := LoadCLVMFromStrings(zap.NewNop(), uri.New("file://main.clvm"), map[lsp.DocumentURI]string{
+		uri.New("file://main.clvm"): `; adds things
+; to other things
+(mod (A B)
+	(include condition_codes.clvm)
+	(defconstant ONE 1)
+	(defconstant TWO 2)
+
+	; add
+	(defun add (x y)
+		(+ x y)
+	)
+	(add (add A ONE) ; one
+		B) ; two
+)`,
+		uri.New("file://condition_codes.clvm"): ConditionCodes,
+	})
+	require.NoError(t, err)
+
+	type fold struct {
+		start, end uint32
+		kind       lsp.FoldingRangeKind
+	}
+	folds := []fold(nil)
+	for _, fr := range mod.FoldingRanges() {
+		folds = append(folds, fold{fr.StartLine, fr.EndLine, fr.Kind})
+	}
+	require.Equal(t, []fold{
+		{0, 1, lsp.CommentFoldingRange},
+		{2, 13, ""},
+		{3, 5, lsp.ImportsFoldingRange},
+		{8, 10, ""},
+		{11, 12, ""},
+	}, folds)
+}
+
+func TestTrailingCommentsDontFold(t *testing.T) {
+	mod, err := LoadCLVMFromStrings(zap.NewNop(), uri.New("file://main.clvm"), map[lsp.DocumentURI]string{
+		uri.New("file://main.clvm"): `(mod (A B)
+	(defconstant ONE 1) ; one
+	(defconstant TWO 2) ; two
+	; a block
+	; of comments
+	(+ A B) ; sum
+	; after the sum
+)`,
+	})
+	require.NoError(t, err)
+
+	comments := []lsp.FoldingRange(nil)
+	for _, fr := range mod.FoldingRanges() {
+		if fr.Kind == lsp.CommentFoldingRange {
+			comments = append(comments, fr)
+		}
+	}
+	require.Equal(t, []lsp.FoldingRange{{
+		StartLine:      3,
+		StartCharacter: 1,
+		EndLine:        4,
+		EndCharacter:   14,
+		Kind:           lsp.CommentFoldingRange,
+	}}, comments)
+}
@@ -0,0 +1,171 @@
+package clls
+
+import (
+	"fmt"
+	"strings"
+)
+
+// definition describes what a symbol definition token refers to
+type definition struct {
+	Module   *Module
+	Function *Function // the defined function, or the one owning the parameter
+	Constant *constant
+	Param    bool
+}
+
+func (m *Module) definitions() map[*Token]*definition {
+	defs := map[*Token]*definition{}
+	m.collectDefinitions(defs, map[*Module]struct{}{})
+	for _, f := range builtinFuncs {
+		defs[f.Name] = &definition{Function: f}
+	}
+	return defs
+}
+
+func (m *Module) collectDefinitions(defs map[*Token]*definition, visited map[*Module]struct{}) {
+	if _, ok := visited[m]; ok {
+		return
+	}
+	visited[m] = struct{}{}
+
+	for _, incl := range m.Includes {
+		if incl.Module != nil {
+			incl.Module.collectDefinitions(defs, visited)
+		}
+	}
+	for _, t := range m.varTokens() {
+		defs[t] = &definition{Module: m, Param: true}
+	}
+	for _, c := range m.Constants {
+		if t, ok := c.Name.(*Token); ok {
+			defs[t] = &definition{Module: m, Constant: c}
+		}
+	}
+	for _, f := range m.Functions {
+		if f.Name != nil {
+			defs[f.Name] = &definition{Module: m, Function: f}
+		}
+		for _, t := range f.varTokens() {
+			defs[t] = &definition{Module: m, Function: f, Param: true}
+		}
+	}
+}
+
+// leadingComments returns the text of the comment lines directly above the given line
+func leadingComments(comments []*Token, line int) []string {
+	byLine := map[int]*Token{}
+	for _, c := range comments {
+		byLine[c.Line] = c
+	}
+	lines := []string(nil)
+	for l := line - 1; l >= 0; l-- {
+		c, ok := byLine[l]
+		if !ok {
+			break
+		}
+		lines = append([]string{strings.TrimSpace(strings.TrimLeft(c.Value, ";"))}, lines...)
+	}
+	return lines
+}
+
+func pluralArgs(n int) string {
+	if n == 1 {
+		return "1 argument"
+	}
+	return fmt.Sprintf("%d arguments", n)
+}
+
+func arityString(min, max int) string {
+	switch {
+	case max == -1 && min == 0:
+		return "any number of arguments"
+	case max == -1:
+		return "at least " + pluralArgs(min)
+	case min == max:
+		return "exactly " + pluralArgs(min)
+	}
+	return fmt.Sprintf("%d to %d arguments", min, max)
+}
+
+func functionSignature(f *Function) string {
+	if f.Builtin {
+		params := "()"
+		if bd, ok := builtins[f.Name.Value]; ok {
+			params = bd.Params
+		}
+		return "(" + f.Name.Value + " " + strings.TrimPrefix(params, "(")
+	}
+	keyword := "defun"
+	if f.KeywordToken != nil {
+		keyword = f.KeywordToken.Value
+	}
+	name := "?"
+	if f.Name != nil {
+		name = f.Name.Value
+	}
+	return fmt.Sprintf("(%s %s %s)", keyword, name, nodeString(f.Params))
+}
+
+func functionDoc(m *Module, f *Function) string {
+	if f.Builtin {
+		bd, ok := builtins[f.Name.Value]
+		if !ok {
+			return "Builtin operator."
+		}
+		return fmt.Sprintf("%s\n\nTakes %s.", bd.Doc, arityString(bd.MinArgs, bd.MaxArgs))
+	}
+	if m == nil || f.KeywordToken == nil {
+		return ""
+	}
+	line := f.KeywordToken.Line
+	if f.Raw != nil && f.Raw.OpenToken != nil {
+		line = f.Raw.OpenToken.Line
+	}
+	return strings.Join(leadingComments(m.Comments, line), "\n")
+}
+
+func markdownCode(code string) string {
+	return "```chialisp\n" + code + "\n```"
+}
+
+// Hover returns a markdown description of the given symbol, or an empty string if there is nothing to show
+func (m *Module) Hover(sym *Symbol) string {
+	if sym == nil || sym.Token == nil {
+		return ""
+	}
+	def, ok := m.definitions()[sym.Token]
+	if !ok {
+		return ""
+	}
+
+	parts := []string(nil)
+	switch {
+	case def.Param:
+		code := "(parameter) " + sym.Token.Value
+		if def.Function != nil {
+			parts = append(parts, markdownCode(code), "Parameter of:\n"+markdownCode(functionSignature(def.Function)))
+		} else {
+			parts = append(parts, markdownCode(code), "Module argument")
+		}
+	case def.Constant != nil:
+		value := "()"
+		if def.Constant.Value != nil {
+			value = nodeString(def.Constant.Value.Raw)
+		}
+		parts = append(parts, markdownCode(fmt.Sprintf("(defconstant %s %s)", sym.Token.Value, value)))
+		if def.Constant.Token != nil {
+			if doc := strings.Join(leadingComments(def.Module.Comments, def.Constant.Token.Line), "\n"); doc != "" {
+				parts = append(parts, doc)
+			}
+		}
+	case def.Function != nil:
+		parts = append(parts, markdownCode(functionSignature(def.Function)))
+		if doc := functionDoc(def.Module, def.Function); doc != "" {
+			parts = append(parts, doc)
+		}
+	}
+	if def.Module != nil && def.Module != m && sym.Token.DocumentURI != "" {
+		parts = append(parts, fmt.Sprintf("Defined in `%s`", sym.Token.DocumentURI))
+	}
+	return strings.Join(parts, "\n\n")
+}
@@ -0,0 +1,66 @@
+package clls
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+	"go.uber.org/zap"
+)
+
+// symbolAt returns the symbol having a token at the position, like the server does
+func symbolAt(mod *Module, line, char int) *Symbol {
+	for _, sym := range mod.Symbols(zap.NewNop()) {
+		for _, st := range sym.Tokens() {
+			if st.Line == line && st.StartChar <= char && char <= st.EndChar() {
+				return sym
+			}
+		}
+	}
+	return nil
+}
+
+func TestHover(t *testing.T) {
+	mod, err := LoadCLVMFromStrings(zap.NewNop(), uri.New("file://main.clvm"), map[lsp.DocumentURI]string{
+		uri.New("file://main.clvm"): `(mod (A B)
+	(include lib.clib)
+	; the answer
+	(defconstant ANSWER 42)
+	; sums its arguments
+	; twice
+	(defun add (x y) (+ x y))
+	(defmacro twice (X) (qq (+ (unquote X) (unquote X))))
+	(add (double A) (twice ANSWER))
+)`,
+		uri.New("file://lib.clib"): `(
+	; doubles
+	(defun double (x) (* x 2))
+)`,
+	})
+	require.NoError(t, err)
+
+	cases := []struct {
+		name       string
+		line, char int
+		hover      string
+	}{
+		{"function", 8, 3, "```chialisp\n(defun add (x y))\n```\n\nsums its arguments\ntwice"},
+		{"function definition", 6, 9, "```chialisp\n(defun add (x y))\n```\n\nsums its arguments\ntwice"},
+		{"parameter", 6, 21, "```chialisp\n(parameter) x\n```\n\nParameter of:\n```chialisp\n(defun add (x y))\n```"},
+		{"module argument", 8, 14, "```chialisp\n(parameter) A\n```\n\nModule argument"},
+		{"constant", 8, 25, "```chialisp\n(defconstant ANSWER 42)\n```\n\nthe answer"},
+		{"macro", 8, 19, "```chialisp\n(defmacro twice (X))\n```"},
+		{"keyword", 6, 3, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.hover, mod.Hover(symbolAt(mod, c.line, c.char)))
+		})
+	}
+
+	// included and builtin functions are resolved through their definition tokens
+	lib := mod.Includes["lib.clib"].Module
+	require.Equal(t, "```chialisp\n(defun double (x))\n```\n\ndoubles\n\nDefined in `file://lib.clib`", mod.Hover(&Symbol{Token: lib.Functions[0].Name}))
+	require.Equal(t, "```chialisp\n(sha256 atoms ...)\n```\n\nReturns the SHA-256 hash of the concatenation of the given atoms.\n\nOpcode `0x0b`, cost: 87 + 134 per argument + 2 per argument byte.\n\nTakes any number of arguments.", mod.Hover(&Symbol{Token: BuiltinFuncsByName["sha256"].Name}))
+}
@@ -0,0 +1,270 @@
+package clls
+
+import (
+	"context"
+	"crypto/sha256"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+	"go.uber.org/zap"
+)
+
+// Loader loads modules and the files they include, a module is parsed once per content
+// of its file and of the files it includes, so a loader can be kept to load files as they change
+type Loader struct {
+	Logger   *zap.Logger
+	ReadFile func(lsp.DocumentURI) (string, error)
+	// IncludeDirs are searched in order for included files that are not next to the file including them
+	IncludeDirs []string
+
+	mu      sync.Mutex // held by a load until its includes are loaded, loads run one at a time
+	files   map[lsp.DocumentURI]*loadedFile
+	loading []*loadedFile // files being loaded, the innermost include last
+}
+
+// loadedFile is the result of loading a file with a given content
+type loadedFile struct {
+	uri    lsp.DocumentURI
+	hash   [32]byte
+	module *Module
+	err    error
+	deps   []lsp.DocumentURI // resolved includes
+	built  []*loadedFile     // the loads of the deps the module was built with, an include loaded again since is newer
+	probes []lsp.DocumentURI // files looked for before resolving the includes, they didn't exist
+}
+
+func (ld *Loader) logger() *zap.Logger {
+	if ld.Logger == nil {
+		return zap.NewNop()
+	}
+	return ld.Logger
+}
+
+// resolveInclude returns the first readable file named p in the directory of the including file or the include dirs
+func (ld *Loader) resolveInclude(from lsp.DocumentURI, p string) (lsp.DocumentURI, error) {
+	dirs := []string{filepath.Dir(from.Filename())}
+	if filepath.IsAbs(p) {
+		dirs = []string{""}
+	} else {
+		dirs = append(dirs, ld.IncludeDirs...)
+	}
+	var firstErr error
+	for _, dir := range dirs {
+		u := uri.New(fileURIPrefix + filepath.Join(dir, p))
+		_, err := ld.ReadFile(u)
+		if err == nil {
+			return u, nil
+		}
+		if n := len(ld.loading); n > 0 {
+			ld.loading[n-1].probes = append(ld.loading[n-1].probes, u)
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if len(dirs) == 1 {
+		return "", errors.Wrap(firstErr, "read file")
+	}
+	return "", errors.Errorf("not found in %s", strings.Join(dirs, ", "))
+}
+
+// circularIncludeError is returned when loading a file that is being loaded, the chain starts and ends with it
+type circularIncludeError struct {
+	chain []lsp.DocumentURI
+}
+
+func (e *circularIncludeError) Error() string {
+	names := []string(nil)
+	for _, u := range e.chain {
+		names = append(names, filepath.Base(u.Filename()))
+	}
+	return "circular include " + strings.Join(names, " -> ")
+}
+
+func newCircularIncludeError(loading []*loadedFile, u lsp.DocumentURI) error {
+	chain := []lsp.DocumentURI(nil)
+	for _, lf := range loading {
+		chain = append(chain, lf.uri)
+	}
+	return &circularIncludeError{chain: append(chain, u)}
+}
+
+// upToDate tells whether the cached file was loaded from the current content of itself and of its includes
+func (ld *Loader) upToDate(u lsp.DocumentURI, content *string, checked map[lsp.DocumentURI]bool) bool {
+	if ok, done := checked[u]; done {
+		return ok
+	}
+	checked[u] = true // includes cycles are checked once
+	ok := func() bool {
+		lf, ok := ld.files[u]
+		if !ok {
+			return false
+		}
+		if content == nil {
+			c, err := ld.ReadFile(u)
+			if err != nil {
+				return false
+			}
+			content = &c
+		}
+		if sha256.Sum256([]byte(*content)) != lf.hash {
+			return false
+		}
+		for _, p := range lf.probes {
+			if _, err := ld.ReadFile(p); err == nil {
+				return false // the include now resolves to another file
+			}
+		}
+		for i, d := range lf.deps {
+			if ld.files[d] != lf.built[i] || !ld.upToDate(d, nil, checked) {
+				return false
+			}
+		}
+		return true
+	}()
+	checked[u] = ok
+	return ok
+}
+
+// Load reads, parses and analyzes the module of the document along with the files it includes,
+// including a file that is being loaded fails with a circular include error
+func (ld *Loader) Load(documentURI lsp.DocumentURI) (*Module, error) {
+	return ld.LoadContext(context.Background(), documentURI)
+}
+
+// LoadContext is Load stopping before the next file once the context is done,
+// the files it didn't finish are loaded again by the next load
+func (ld *Loader) LoadContext(ctx context.Context, documentURI lsp.DocumentURI) (*Module, error) {
+	ld.mu.Lock()
+	defer ld.mu.Unlock()
+	return ld.load(ctx, documentURI)
+}
+
+func (ld *Loader) load(ctx context.Context, documentURI lsp.DocumentURI) (*Module, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f, err := ld.ReadFile(documentURI)
+	if err != nil {
+		return nil, errors.Wrap(err, "read file")
+	}
+	for i, lf := range ld.loading {
+		if lf.uri == documentURI {
+			return nil, newCircularIncludeError(ld.loading[i:], documentURI)
+		}
+	}
+	if ld.files == nil {
+		ld.files = map[lsp.DocumentURI]*loadedFile{}
+	}
+	if ld.upToDate(documentURI, &f, map[lsp.DocumentURI]bool{}) {
+		lf := ld.files[documentURI]
+		return lf.module, lf.err
+	}
+
+	lf := &loadedFile{uri: documentURI, hash: sha256.Sum256([]byte(f))}
+	ld.loading = append(ld.loading, lf)
+	lf.module, lf.err = ld.parse(ctx, documentURI, f)
+	ld.loading = ld.loading[:len(ld.loading)-1]
+	if err := ctx.Err(); err != nil {
+		return nil, err // an include may be missing from the module
+	}
+	if lf.module != nil {
+		for _, incl := range lf.module.Includes {
+			if incl.URI != "" {
+				lf.deps = append(lf.deps, incl.URI)
+			}
+		}
+		sort.Slice(lf.deps, func(i, j int) bool { return lf.deps[i] < lf.deps[j] })
+		for _, d := range lf.deps {
+			lf.built = append(lf.built, ld.files[d])
+		}
+	}
+	ld.files[documentURI] = lf
+	return lf.module, lf.err
+}
+
+func (ld *Loader) parse(ctx context.Context, documentURI lsp.DocumentURI, f string) (*Module, error) {
+	tokens := []*Token(nil)
+	tch, errptr := tokenize(f, documentURI)
+	duptch := make(chan *Token)
+	go func() {
+		defer close(duptch)
+		for token := range tch {
+			duptch <- token
+			tokens = append(tokens, token)
+		}
+	}()
+
+	ast, problems, err := parseAST(duptch)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse syntax tree")
+	}
+
+	if *errptr != nil {
+		return nil, errors.Wrap(*errptr, "tokenize")
+	}
+
+	mods, err := parseModules(ctx, ld, ast, documentURI, tokens)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse modules")
+	}
+	if len(mods) == 0 {
+		return nil, errors.New("no modules in file")
+	}
+
+	mods[0].Problems = append(problems, mods[0].Problems...)
+	return mods[0], nil
+}
+
+// Dependencies returns the files the loaded file includes directly
+func (ld *Loader) Dependencies(u lsp.DocumentURI) []lsp.DocumentURI {
+	ld.mu.Lock()
+	defer ld.mu.Unlock()
+	if lf, ok := ld.files[u]; ok {
+		return append([]lsp.DocumentURI(nil), lf.deps...)
+	}
+	return nil
+}
+
+// Dependents returns the loaded files including the given one, directly or through other includes
+func (ld *Loader) Dependents(u lsp.DocumentURI) []lsp.DocumentURI {
+	graph := ld.Graph()
+	seen := map[lsp.DocumentURI]struct{}{u: {}}
+	queue := []lsp.DocumentURI{u}
+	r := []lsp.DocumentURI(nil)
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for from, deps := range graph {
+			if _, ok := seen[from]; ok {
+				continue
+			}
+			for _, d := range deps {
+				if d == cur {
+					seen[from] = struct{}{}
+					queue = append(queue, from)
+					r = append(r, from)
+					break
+				}
+			}
+		}
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i] < r[j] })
+	return r
+}
+
+// Graph returns the includes of every loaded file
+func (ld *Loader) Graph() map[lsp.DocumentURI][]lsp.DocumentURI {
+	ld.mu.Lock()
+	defer ld.mu.Unlock()
+	g := make(map[lsp.DocumentURI][]lsp.DocumentURI, len(ld.files))
+	for u, lf := range ld.files {
+		g[u] = append([]lsp.DocumentURI(nil), lf.deps...)
+	}
+	return g
+}
@@ -0,0 +1,166 @@
+package clls
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+	"go.uber.org/zap"
+)
+
+func TestLoaderIncludeDirs(t *testing.T) {
+	files := map[lsp.DocumentURI]string{
+		uri.New("file:///proj/puzzles/main.clvm"): `(mod (A)
+	(include condition_codes.clib)
+	(include sha256tree.clib)
+	(include missing.clib)
+	(sha256tree A)
+)`,
+		uri.New("file:///proj/puzzles/condition_codes.clib"): "((defconstant LOCAL 1))",
+		uri.New("file:///proj/include/condition_codes.clib"): "((defconstant SHARED 1))",
+		uri.New("file:///proj/include/sha256tree.clib"):      "((defun sha256tree (x) x))",
+		uri.New("file:///vendor/sha256tree.clib"):            "((defun other (x) x))",
+	}
+	ld := &Loader{
+		ReadFile: func(u lsp.DocumentURI) (string, error) {
+			f, ok := files[u]
+			if !ok {
+				return "", fmt.Errorf("unknown file '%s'", u)
+			}
+			return f, nil
+		},
+		IncludeDirs: []string{"/proj/include", "/vendor"},
+	}
+	mod, err := ld.Load(uri.New("file:///proj/puzzles/main.clvm"))
+	require.NoError(t, err)
+
+	// the directory of the including file comes first, then the include dirs in order
+	require.Equal(t, uri.New("file:///proj/puzzles/condition_codes.clib"), mod.Includes["condition_codes.clib"].URI)
+	require.Equal(t, uri.New("file:///proj/include/sha256tree.clib"), mod.Includes["sha256tree.clib"].URI)
+	require.NotNil(t, mod.Includes["sha256tree.clib"].Module)
+
+	missing := mod.Includes["missing.clib"]
+	require.Nil(t, missing.Module)
+	require.EqualError(t, missing.LoadError, "not found in /proj/puzzles, /proj/include, /vendor")
+}
+
+func TestLoaderCache(t *testing.T) {
+	files := map[lsp.DocumentURI]string{
+		uri.New("file:///a.clvm"):   "(mod (A) (include lib.clib) (include b.clib) (f A))",
+		uri.New("file:///b.clib"):   "((include lib.clib) (defun g (x) (f x)))",
+		uri.New("file:///lib.clib"): "((defun f (x) x))",
+	}
+	ld := &Loader{ReadFile: func(u lsp.DocumentURI) (string, error) {
+		f, ok := files[u]
+		if !ok {
+			return "", fmt.Errorf("unknown file '%s'", u)
+		}
+		return f, nil
+	}}
+
+	a, err := ld.Load(uri.New("file:///a.clvm"))
+	require.NoError(t, err)
+	lib := a.Includes["lib.clib"].Module
+	require.NotNil(t, lib)
+	require.Same(t, lib, a.Includes["b.clib"].Module.Includes["lib.clib"].Module)
+
+	again, err := ld.Load(uri.New("file:///a.clvm"))
+	require.NoError(t, err)
+	require.Same(t, a, again)
+
+	require.Equal(t, []lsp.DocumentURI{uri.New("file:///b.clib"), uri.New("file:///lib.clib")}, ld.Dependencies(uri.New("file:///a.clvm")))
+	require.Equal(t, []lsp.DocumentURI{uri.New("file:///a.clvm"), uri.New("file:///b.clib")}, ld.Dependents(uri.New("file:///lib.clib")))
+
+	// a change in an include reloads the files depending on it
+	files[uri.New("file:///lib.clib")] = "((defun f (x y) x))"
+	changed, err := ld.Load(uri.New("file:///a.clvm"))
+	require.NoError(t, err)
+	require.NotSame(t, a, changed)
+	require.NotSame(t, lib, changed.Includes["lib.clib"].Module)
+
+	// even when the include was loaded first
+	files[uri.New("file:///lib.clib")] = "((defun f (x y z) x))"
+	newLib, err := ld.Load(uri.New("file:///lib.clib"))
+	require.NoError(t, err)
+	reloaded, err := ld.Load(uri.New("file:///a.clvm"))
+	require.NoError(t, err)
+	require.Same(t, newLib, reloaded.Includes["lib.clib"].Module)
+	require.Same(t, newLib, reloaded.Includes["b.clib"].Module.Includes["lib.clib"].Module)
+
+	// so does an include now found in a directory searched first
+	ld.IncludeDirs = []string{"/lib"}
+	files[uri.New("file:///lib/c.clib")] = "()"
+	files[uri.New("file:///a.clvm")] = "(mod (A) (include c.clib) A)"
+	withC, err := ld.Load(uri.New("file:///a.clvm"))
+	require.NoError(t, err)
+	require.Equal(t, uri.New("file:///lib/c.clib"), withC.Includes["c.clib"].URI)
+	files[uri.New("file:///c.clib")] = "()"
+	local, err := ld.Load(uri.New("file:///a.clvm"))
+	require.NoError(t, err)
+	require.Equal(t, uri.New("file:///c.clib"), local.Includes["c.clib"].URI)
+}
+
+func TestLoaderCircularInclude(t *testing.T) {
+	mod, err := LoadCLVMFromStrings(zap.NewNop(), uri.New("file:///a.clvm"), map[lsp.DocumentURI]string{
+		uri.New("file:///a.clvm"): "(mod (A) (include b.clib) (include d.clib) A)",
+		uri.New("file:///b.clib"): "((include c.clib))",
+		uri.New("file:///c.clib"): "(\n(include b.clib))",
+		uri.New("file:///d.clib"): "((include a.clvm))",
+	})
+	require.NoError(t, err)
+
+	c := mod.Includes["b.clib"].Module.Includes["c.clib"].Module
+	require.NotNil(t, c)
+	require.EqualError(t, c.Includes["b.clib"].LoadError, "circular include b.clib -> c.clib -> b.clib")
+
+	diags := c.Diagnostics()
+	require.Len(t, diags, 1)
+	require.Equal(t, lsp.Range{Start: lsp.Position{Line: 1, Character: 9}, End: lsp.Position{Line: 1, Character: 15}}, diags[0].Range)
+
+	// the file starting the loop gets the error on its own include
+	diags = mod.Diagnostics()
+	require.Len(t, diags, 1)
+	require.Equal(t, uint32(0), diags[0].Range.Start.Line)
+	require.Equal(t, uint32(35), diags[0].Range.Start.Character)
+	require.Equal(t, "circular include a.clvm -> d.clib -> a.clvm", diags[0].Message)
+}
+
+func TestLoaderContext(t *testing.T) {
+	files := map[lsp.DocumentURI]string{
+		uri.New("file:///a.clvm"):   "(mod (A) (include lib.clib) (f A))",
+		uri.New("file:///lib.clib"): "((defun f (x) x))",
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ld := &Loader{ReadFile: func(u lsp.DocumentURI) (string, error) {
+		if u == uri.New("file:///lib.clib") {
+			cancel() // while resolving the include
+		}
+		f, ok := files[u]
+		if !ok {
+			return "", fmt.Errorf("unknown file '%s'", u)
+		}
+		return f, nil
+	}}
+	_, err := ld.LoadContext(ctx, uri.New("file:///a.clvm"))
+	require.Equal(t, context.Canceled, err)
+	require.Empty(t, ld.Graph(), "cancelled loads are not cached")
+
+	// loads of one loader run one at a time
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mod, err := ld.Load(uri.New("file:///a.clvm"))
+			if assert.NoError(t, err) {
+				assert.NotNil(t, mod.Includes["lib.clib"].Module)
+			}
+		}()
+	}
+	wg.Wait()
+}
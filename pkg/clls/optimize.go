@@ -0,0 +1,273 @@
+package clls
+
+import (
+	"bytes"
+	"math/big"
+
+	"github.com/clls-dev/clls/pkg/clvm"
+)
+
+// constantFoldingMaxCost bounds the evaluation of constant expressions, a quoted program applied to itself never returns
+const constantFoldingMaxCost = 11000000000
+
+// optimize rewrites compiled code to the equivalent code the reference compiler emits, the passes are
+// tried in order and the first one changing the code restarts them, like optimize_sexp in clvm_tools.
+// Nodes created by a pass inherit the source of the node they replace.
+func (c *compiler) optimize(v *clvm.Value) *clvm.Value {
+	passes := []func(*clvm.Value) *clvm.Value{
+		consOptimizer,
+		constantOptimizer,
+		consQAOptimizer,
+		c.varChangeOptimizer,
+		c.childrenOptimizer,
+		pathOptimizer,
+		quoteNullOptimizer,
+		applyNullOptimizer,
+	}
+	for v.IsPair() {
+		next := v
+		for _, pass := range passes {
+			if next = pass(v); next != v && !next.Equal(v) {
+				break
+			}
+			next = v
+		}
+		if next == v {
+			return v
+		}
+		if _, ok := c.sources[next]; !ok && next.IsPair() {
+			if t, ok := c.sources[v]; ok {
+				c.sources[next] = t
+			}
+		}
+		v = next
+	}
+	return v
+}
+
+func isOp(v *clvm.Value, name string) bool {
+	return !v.IsPair() && bytes.Equal(v.Atom, clvm.OperatorsByName[name].OpcodeBytes())
+}
+
+// matchCall returns the arguments of (name args...) if v is a call of the operator with n arguments
+func matchCall(v *clvm.Value, name string, n int) ([]*clvm.Value, bool) {
+	if !v.IsPair() || !isOp(v.First, name) {
+		return nil, false
+	}
+	args, ok := v.Rest.ListItems()
+	return args, ok && len(args) == n
+}
+
+// quoted returns the quoted value if v is (q . X)
+func quoted(v *clvm.Value) (*clvm.Value, bool) {
+	if v.IsPair() && isOp(v.First, "q") {
+		return v.Rest, true
+	}
+	return nil, false
+}
+
+// listWithTail builds a list of the items ending with tail instead of nil
+func listWithTail(items []*clvm.Value, tail *clvm.Value) *clvm.Value {
+	for i := len(items) - 1; i >= 0; i-- {
+		tail = clvm.Cons(items[i], tail)
+	}
+	return tail
+}
+
+func nonNil(v *clvm.Value) bool {
+	return v.IsPair() || len(v.Atom) > 0
+}
+
+// seemsConstant tells if v doesn't depend on its environment, only nil is a constant atom since the others are paths
+func seemsConstant(v *clvm.Value) bool {
+	if !v.IsPair() {
+		return v.IsNil()
+	}
+	if op := v.First; !op.IsPair() {
+		if isOp(op, "q") {
+			return true
+		}
+		if isOp(op, "x") {
+			return false
+		}
+	} else if !seemsConstant(op) {
+		return false
+	}
+	for args := v.Rest; args.IsPair(); args = args.Rest {
+		if !seemsConstant(args.First) {
+			return false
+		}
+	}
+	return true
+}
+
+// consOptimizer rewrites (f (c A B)) to A and (r (c A B)) to B
+func consOptimizer(v *clvm.Value) *clvm.Value {
+	for i, name := range []string{"f", "r"} {
+		if args, ok := matchCall(v, name, 1); ok {
+			if cons, ok := matchCall(args[0], "c", 2); ok {
+				return cons[i]
+			}
+		}
+	}
+	return v
+}
+
+// constantOptimizer evaluates the code not depending on its environment and quotes the result,
+// code failing at runtime is kept so that it fails when the program runs
+func constantOptimizer(v *clvm.Value) *clvm.Value {
+	if !seemsConstant(v) || !nonNil(v) {
+		return v
+	}
+	res, _, err := clvm.Run(v, clvm.Nil, constantFoldingMaxCost)
+	if err != nil {
+		return v
+	}
+	return clvm.Cons(quoteAtom(), res)
+}
+
+// consQAOptimizer rewrites (a (q . SEXP) 1) to SEXP
+func consQAOptimizer(v *clvm.Value) *clvm.Value {
+	if args, ok := matchCall(v, "a", 2); ok {
+		if sexp, ok := quoted(args[0]); ok && !args[1].IsPair() && args[1].AsInt().Cmp(big.NewInt(1)) == 0 {
+			return sexp
+		}
+	}
+	return v
+}
+
+// consPart returns the part of the cons the value of args is made of, or the code taking it
+func consPart(args *clvm.Value, rest bool) *clvm.Value {
+	if cons, ok := matchCall(args, "c", 2); ok {
+		if rest {
+			return cons[1]
+		}
+		return cons[0]
+	}
+	if rest {
+		return clvm.List(opcode("r"), args)
+	}
+	return clvm.List(opcode("f"), args)
+}
+
+// pathFromArgs returns the code taking the value at path in the value of args
+func pathFromArgs(path *big.Int, args *clvm.Value) *clvm.Value {
+	if path.Cmp(big.NewInt(1)) <= 0 {
+		return args
+	}
+	return pathFromArgs(new(big.Int).Rsh(path, 1), consPart(args, path.Bit(0) == 1))
+}
+
+// subArgs substitutes the paths of the code with the code taking their values in the value of args
+func subArgs(v, args *clvm.Value) *clvm.Value {
+	if !v.IsPair() {
+		if v.IsNil() {
+			return v
+		}
+		return pathFromArgs(new(big.Int).SetBytes(v.Atom), args)
+	}
+	first := v.First
+	if first.IsPair() {
+		first = subArgs(first, args)
+	} else if isOp(first, "q") {
+		return v
+	}
+	items := []*clvm.Value{first}
+	rest := v.Rest
+	for ; rest.IsPair(); rest = rest.Rest {
+		items = append(items, subArgs(rest.First, args))
+	}
+	return listWithTail(items, rest)
+}
+
+// varChangeOptimizer rewrites (a (q . (op ARGS...)) ENV) to (op ARGS'...) with the paths of ARGS taken in ENV,
+// it is kept only when each of the resulting arguments is a path or a constant
+func (c *compiler) varChangeOptimizer(v *clvm.Value) *clvm.Value {
+	args, ok := matchCall(v, "a", 2)
+	if !ok {
+		return v
+	}
+	sexp, ok := quoted(args[0])
+	if !ok {
+		return v
+	}
+	sub := subArgs(sexp, args[1])
+	if seemsConstant(sub) {
+		return c.optimize(sub)
+	}
+	if !sub.IsPair() {
+		return v
+	}
+	items := []*clvm.Value(nil)
+	rest := sub
+	for ; rest.IsPair(); rest = rest.Rest {
+		o := c.optimize(rest.First)
+		if _, ok := quoted(o); o.IsPair() && !ok {
+			return v
+		}
+		items = append(items, o)
+	}
+	return listWithTail(items, rest)
+}
+
+// childrenOptimizer optimizes the items of a list that isn't quoted
+func (c *compiler) childrenOptimizer(v *clvm.Value) *clvm.Value {
+	if _, ok := quoted(v); ok || !v.IsPair() {
+		return v
+	}
+	items := []*clvm.Value(nil)
+	changed := false
+	rest := v
+	for ; rest.IsPair(); rest = rest.Rest {
+		o := c.optimize(rest.First)
+		changed = changed || o != rest.First
+		items = append(items, o)
+	}
+	if !changed {
+		return v
+	}
+	return listWithTail(items, rest)
+}
+
+// composePaths returns the path of the value at second in the value at first
+func composePaths(first, second *big.Int) *big.Int {
+	second = new(big.Int).Set(second)
+	mask := big.NewInt(1)
+	for t := new(big.Int).Set(first); t.Cmp(big.NewInt(1)) > 0; t.Rsh(t, 1) {
+		second.Lsh(second, 1)
+		mask.Lsh(mask, 1)
+	}
+	mask.Sub(mask, big.NewInt(1))
+	return second.Or(second, mask.And(mask, first))
+}
+
+// pathAtom encodes a path in the fewest bytes, paths are read as unsigned integers
+func pathAtom(path *big.Int) *clvm.Value {
+	return clvm.Atom(path.Bytes())
+}
+
+// pathOptimizer rewrites (f PATH) and (r PATH) to the path of the first or rest of the value at PATH
+func pathOptimizer(v *clvm.Value) *clvm.Value {
+	for i, name := range []string{"f", "r"} {
+		if args, ok := matchCall(v, name, 1); ok && !args[0].IsPair() && nonNil(args[0]) {
+			return pathAtom(composePaths(new(big.Int).SetBytes(args[0].Atom), big.NewInt(int64(2+i))))
+		}
+	}
+	return v
+}
+
+// quoteNullOptimizer rewrites (q . ()) to ()
+func quoteNullOptimizer(v *clvm.Value) *clvm.Value {
+	if q, ok := quoted(v); ok && q.IsNil() {
+		return clvm.Nil
+	}
+	return v
+}
+
+// applyNullOptimizer rewrites (a () . ARGS) to ()
+func applyNullOptimizer(v *clvm.Value) *clvm.Value {
+	if v.IsPair() && isOp(v.First, "a") && v.Rest.IsPair() && v.Rest.First.IsNil() {
+		return clvm.Nil
+	}
+	return v
+}
@@ -1,17 +1,17 @@
 package clls
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
-	"path/filepath"
 
 	"github.com/pkg/errors"
 	lsp "go.lsp.dev/protocol"
-	"go.lsp.dev/uri"
 	"go.uber.org/zap"
 )
 
 type Module struct {
+	Raw             *ASTNode
 	Args            interface{}
 	Constants       []*constant
 	Functions       []*Function
@@ -22,6 +22,9 @@ type Module struct {
 	ModToken        *Token
 	IsMod           bool
 	Comments        []*Token
+	Problems        []*Problem `json:",omitempty"`
+	tokens          []*Token
+	uri             lsp.DocumentURI
 }
 
 type Symbol struct {
@@ -40,10 +43,14 @@ func (s *Symbol) DefinitionLocation() lsp.Location {
 	return s.Token.Location()
 }
 
+func (m *Module) addProblem(r lsp.Range, severity lsp.DiagnosticSeverity, format string, args ...interface{}) {
+	m.Problems = append(m.Problems, newProblem(r, severity, format, args...))
+}
+
 func makeSymbolsMap(l *zap.Logger, cb *CodeBody) map[*Token][]*Token {
 	m := map[*Token][]*Token{}
 	switch cb.Kind {
-	case CallBodyKind, FuncVarBodyKind:
+	case CallBodyKind, FuncVarBodyKind, OperatorBodyKind:
 		if cb.Token == nil {
 			panic("found call body kind with no token")
 		}
@@ -89,6 +96,11 @@ func (m *Module) Symbols(l *zap.Logger) []*Symbol {
 	for _, c := range m.Constants {
 		syms[c.Name.(*Token)] = []*Token{}
 	}
+	for _, f := range m.Functions {
+		if f.Name != nil {
+			syms[f.Name] = []*Token{}
+		}
+	}
 
 	ctoks := m.constTokens()
 	for _, f := range m.Functions {
@@ -114,7 +126,8 @@ func (m *Module) Symbols(l *zap.Logger) []*Symbol {
 	return result
 }
 
-func parseModules(l *zap.Logger, tree *ASTNode, documentURI lsp.DocumentURI, readFile func(lsp.DocumentURI) (string, error), tokens []*Token) ([]*Module, error) {
+func parseModules(ctx context.Context, ld *Loader, tree *ASTNode, documentURI lsp.DocumentURI, tokens []*Token) ([]*Module, error) {
+	l := ld.logger()
 	if tree == nil {
 		return nil, errors.New("empty tree")
 	}
@@ -140,10 +153,13 @@ func parseModules(l *zap.Logger, tree *ASTNode, documentURI lsp.DocumentURI, rea
 		firstChild := n.Children[0]
 
 		mod := &Module{
+			Raw:             n,
 			FunctionsByName: map[string]*Function{},
 			constsByName:    map[string]*constant{},
 			Includes:        map[string]*include{},
 			Comments:        comments,
+			tokens:          tokens,
+			uri:             documentURI,
 		}
 
 		if t, ok := firstChild.(*Token); ok {
@@ -153,15 +169,23 @@ func parseModules(l *zap.Logger, tree *ASTNode, documentURI lsp.DocumentURI, rea
 			}
 		}
 
+		if len(mods) > 0 {
+			mods[0].addProblem(nodeRange(n), lsp.DiagnosticSeverityWarning, "only the first top-level expression is loaded")
+		}
+
 		children := n.Children
 		if mod.IsMod && len(n.Children) > 2 {
 			mod.Args = n.Children[1]
 			children = n.Children[2:]
+		} else if mod.IsMod {
+			mod.addProblem(mod.ModToken.Range(), lsp.DiagnosticSeverityError, "mod is missing its arguments or body")
+			children = nil
 		}
-		remaining := []*ASTNode(nil)
-		for _, mn := range children {
+		remaining := []interface{}(nil)
+		for i, mn := range children {
 			mn, ok := mn.(*ASTNode)
 			if !ok {
+				remaining = append(remaining, children[i]) // an atom body like (mod (X) X)
 				continue
 			}
 
@@ -176,17 +200,23 @@ func parseModules(l *zap.Logger, tree *ASTNode, documentURI lsp.DocumentURI, rea
 			switch t.Value {
 			case "include":
 				fincl := &include{
+					Raw:   mn,
 					Token: t,
 				}
 				var filePath string
+				if len(mn.Children) < 2 {
+					mod.addProblem(nodeRange(mn), lsp.DiagnosticSeverityError, "include is missing its file path")
+				} else if _, ok := mn.Children[1].(*Token); !ok {
+					mod.addProblem(nodeRange(mn.Children[1]), lsp.DiagnosticSeverityError, "include file path must be an atom")
+				}
 				if len(mn.Children) > 1 {
 					fincl.Value = mn.Children[1]
 					if t, ok := mn.Children[1].(*Token); ok {
 						filePath = t.Value
 						var err error
-						dir := filepath.Dir(documentURI.Filename())
-						u := "file://" + filepath.Join(dir, filePath)
-						if fincl.Module, err = LoadCLVM(l, uri.New(u), readFile); err != nil {
+						if fincl.URI, err = ld.resolveInclude(documentURI, filePath); err != nil {
+							fincl.LoadError = err
+						} else if fincl.Module, err = ld.load(ctx, fincl.URI); err != nil {
 							fincl.Module = nil
 							fincl.LoadError = err
 						}
@@ -209,9 +239,24 @@ func parseModules(l *zap.Logger, tree *ASTNode, documentURI lsp.DocumentURI, rea
 
 				if len(mn.Children) > 1 {
 					if f.Name, ok = mn.Children[1].(*Token); ok {
+						if _, ok := mod.FunctionsByName[f.Name.Value]; ok {
+							mod.addProblem(f.Name.Range(), lsp.DiagnosticSeverityError, "%s '%s' redeclared", t.Value, f.Name.Value)
+						}
 						mod.FunctionsByName[f.Name.Value] = f
+					} else {
+						mod.addProblem(nodeRange(mn.Children[1]), lsp.DiagnosticSeverityError, "%s name must be an atom", t.Value)
 					}
 				}
+				switch {
+				case len(mn.Children) < 2:
+					mod.addProblem(nodeRange(mn), lsp.DiagnosticSeverityError, "%s is missing its name", t.Value)
+				case len(mn.Children) < 3:
+					mod.addProblem(nodeRange(mn), lsp.DiagnosticSeverityError, "%s is missing its parameters", t.Value)
+				case len(mn.Children) < 4:
+					mod.addProblem(nodeRange(mn), lsp.DiagnosticSeverityError, "%s is missing its body", t.Value)
+				case len(mn.Children) > 4:
+					mod.addProblem(nodeRange(mn.Children[4]), lsp.DiagnosticSeverityError, "%s has more than one body expression", t.Value)
+				}
 
 				if len(mn.Children) > 2 {
 					f.Params = mn.Children[2]
@@ -226,6 +271,7 @@ func parseModules(l *zap.Logger, tree *ASTNode, documentURI lsp.DocumentURI, rea
 				}
 			case "defconstant":
 				c := &constant{
+					Raw:   mn,
 					Token: t,
 				}
 				mod.Constants = append(mod.Constants, c)
@@ -233,9 +279,22 @@ func parseModules(l *zap.Logger, tree *ASTNode, documentURI lsp.DocumentURI, rea
 				if len(mn.Children) > 1 {
 					c.Name = mn.Children[1]
 					if t, ok := c.Name.(*Token); ok {
+						if _, ok := mod.constsByName[t.Value]; ok {
+							mod.addProblem(t.Range(), lsp.DiagnosticSeverityError, "constant '%s' redeclared", t.Value)
+						}
 						mod.constsByName[t.Value] = c
+					} else {
+						mod.addProblem(nodeRange(c.Name), lsp.DiagnosticSeverityError, "constant name must be an atom")
 					}
 				}
+				switch {
+				case len(mn.Children) < 2:
+					mod.addProblem(nodeRange(mn), lsp.DiagnosticSeverityError, "defconstant is missing its name")
+				case len(mn.Children) < 3:
+					mod.addProblem(nodeRange(mn), lsp.DiagnosticSeverityError, "defconstant is missing its value")
+				case len(mn.Children) > 3:
+					mod.addProblem(nodeRange(mn.Children[3]), lsp.DiagnosticSeverityError, "defconstant has more than one value")
+				}
 
 				if len(mn.Children) > 2 {
 					valBody, err := parseBody(mod, nil, mn.Children[2])
@@ -259,6 +318,14 @@ func parseModules(l *zap.Logger, tree *ASTNode, documentURI lsp.DocumentURI, rea
 			}
 		}
 
+		if mod.IsMod && len(remaining) > 1 {
+			for _, r := range remaining[:len(remaining)-1] {
+				mod.addProblem(nodeRange(r), lsp.DiagnosticSeverityWarning, "expression is ignored, only the last one is the module body")
+			}
+		}
+		if mod.IsMod && len(remaining) == 0 && len(n.Children) > 2 {
+			mod.addProblem(mod.ModToken.Range(), lsp.DiagnosticSeverityError, "mod has no body")
+		}
 		if mod.IsMod && len(remaining) > 0 {
 			var err error
 			if mod.Main, err = parseBody(mod, mod.varTokens(), remaining[len(remaining)-1]); err != nil {
@@ -302,6 +369,20 @@ type CodeBody struct {
 	opChildren []*CodeBody
 }
 
+// lookupFunction finds a function by name in the module, its includes and the builtins
+func (m *Module) lookupFunction(name string) (*Function, bool) {
+	if f, ok := m.FunctionsByName[name]; ok {
+		return f, true
+	}
+	for _, im := range m.includedModules() {
+		if f, ok := im.FunctionsByName[name]; ok {
+			return f, true
+		}
+	}
+	f, ok := BuiltinFuncsByName[name]
+	return f, ok
+}
+
 func parseBody(mod *Module, vars map[string]*Token, tree interface{}) (*CodeBody, error) {
 	if tree == nil {
 		return nil, nil
@@ -331,11 +412,7 @@ func parseBody(mod *Module, vars map[string]*Token, tree interface{}) (*CodeBody
 				}
 			}
 
-			f, ok := mod.FunctionsByName[t.Text]
-			if !ok {
-				f, ok = BuiltinFuncsByName[t.Text]
-			}
-			if ok {
+			if f, ok := mod.lookupFunction(t.Text); ok {
 				return &CodeBody{Kind: FuncVarBodyKind, Raw: tree, Function: f.Name, Token: t}, nil
 			}
 		}
@@ -348,8 +425,8 @@ func parseBody(mod *Module, vars map[string]*Token, tree interface{}) (*CodeBody
 		if ok {
 			switch firstChildAsToken.Kind {
 			case basicToken:
-				switch firstChildAsToken.Value {
-				case "if":
+				switch v := firstChildAsToken.Value; {
+				case v == "if":
 					cb := &CodeBody{
 						Raw:   tree,
 						Kind:  IfBodyKind,
@@ -380,7 +457,7 @@ func parseBody(mod *Module, vars map[string]*Token, tree interface{}) (*CodeBody
 						cb.Children = append(cb.Children, eb)
 					}
 					return cb, nil
-				case "+", "-", "*", "/", ">", "=", ">s":
+				case isOperatorName(v):
 					ccb := []*CodeBody(nil)
 					for _, c := range tree.Children[1:] {
 						cb, err := parseBody(mod, vars, c)
@@ -392,6 +469,9 @@ func parseBody(mod *Module, vars map[string]*Token, tree interface{}) (*CodeBody
 					return &CodeBody{
 						Raw:        tree,
 						Kind:       OperatorBodyKind,
+						Token:      firstChildAsToken,
+						Function:   BuiltinFuncsByName[v].Name,
+						CallArgs:   ccb,
 						opChildren: ccb,
 						Children:   ccb,
 					}, nil
@@ -404,11 +484,7 @@ func parseBody(mod *Module, vars map[string]*Token, tree interface{}) (*CodeBody
 								Constant: c,
 							}, nil
 						}
-						f, ok := mod.FunctionsByName[t.Value]
-						if !ok {
-							f, ok = BuiltinFuncsByName[t.Value]
-						}
-						if ok {
+						if f, ok := mod.lookupFunction(t.Value); ok {
 							args := []*CodeBody(nil)
 							for _, e := range tree.Children[1:] {
 								//fmt.Println("parsing code body", mod, vars, e)
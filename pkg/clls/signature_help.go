@@ -0,0 +1,153 @@
+package clls
+
+import (
+	"strings"
+
+	lsp "go.lsp.dev/protocol"
+)
+
+// callAt returns the innermost list containing the position whose first element names a function or a builtin
+func (m *Module) callAt(n *ASTNode, p lsp.Position, funcs map[string]*Function) (*ASTNode, *Function) {
+	if n == nil {
+		return nil, nil
+	}
+	for _, c := range n.Children {
+		if c, ok := c.(*ASTNode); ok && c.containsPosition(p) {
+			if call, f := m.callAt(c, p, funcs); call != nil {
+				return call, f
+			}
+			break
+		}
+	}
+	if !n.containsPosition(p) || len(n.Children) == 0 {
+		return nil, nil
+	}
+	head, ok := n.Children[0].(*Token)
+	if !ok || head.Kind != basicToken {
+		return nil, nil
+	}
+	if f, ok := funcs[head.Value]; ok {
+		return n, f
+	}
+	if f, ok := BuiltinFuncsByName[head.Value]; ok {
+		return n, f
+	}
+	return nil, nil
+}
+
+// argumentIndex returns the index of the argument of the call at the position,
+// a position between two arguments belongs to the next one
+func argumentIndex(call *ASTNode, p lsp.Position) int {
+	i := 0
+	for _, c := range call.Children[1:] {
+		if t, ok := c.(*Token); ok && t.Text == "." {
+			continue
+		}
+		if !positionBefore(nodeRange(c).End, p) {
+			return i
+		}
+		i++
+	}
+	return i
+}
+
+// signatureParams returns the labels of the parameters of a params tree and the index of
+// the parameter receiving the remaining arguments, -1 when there is none
+func signatureParams(params interface{}) ([]string, int) {
+	switch params := params.(type) {
+	case *Token:
+		if params != nil && params.Kind == basicToken {
+			return []string{params.Value}, 0 // the whole arguments list
+		}
+	case *ASTNode:
+		if params == nil {
+			return nil, -1
+		}
+		labels := []string(nil)
+		for i, c := range params.Children {
+			if t, ok := c.(*Token); ok && t.Text == "." {
+				if i+1 < len(params.Children) {
+					return append(labels, nodeString(params.Children[i+1])), len(labels)
+				}
+				break
+			}
+			labels = append(labels, nodeString(c))
+		}
+		return labels, -1
+	}
+	return nil, -1
+}
+
+// builtinSignatureParams reads the parameters of a builtin description like (value subtrahends ...)
+func builtinSignatureParams(params string) ([]string, int) {
+	labels := []string(nil)
+	rest := -1
+	for _, f := range strings.Fields(strings.Trim(params, "()")) {
+		if f == "..." {
+			if len(labels) > 0 && rest == -1 {
+				rest = len(labels) - 1
+			}
+			continue
+		}
+		labels = append(labels, f)
+	}
+	return labels, rest
+}
+
+// definingModule returns the module, among m and its includes, declaring the function
+func (m *Module) definingModule(f *Function) *Module {
+	for _, mod := range append([]*Module{m}, m.includedModules()...) {
+		if mod.FunctionsByName[f.Name.Value] == f {
+			return mod
+		}
+	}
+	return nil
+}
+
+// SignatureHelp describes the parameters of the function called at the given position,
+// the active parameter is the one the argument under the cursor binds to
+func (m *Module) SignatureHelp(p lsp.Position) *lsp.SignatureHelp {
+	funcs := m.allFunctions()
+	call, f := m.callAt(m.Raw, p, funcs)
+	if call == nil {
+		return nil
+	}
+
+	var labels []string
+	rest := -1
+	doc := ""
+	if f.Builtin {
+		if bd, ok := builtins[f.Name.Value]; ok {
+			labels, rest = builtinSignatureParams(bd.Params)
+			doc = bd.Doc
+		}
+	} else {
+		labels, rest = signatureParams(f.Params)
+		doc = functionDoc(m.definingModule(f), f)
+	}
+
+	sig := lsp.SignatureInformation{Label: "(" + f.Name.Value}
+	for i, l := range labels {
+		if i == rest && f.Builtin {
+			l += " ..."
+		} else if i == rest {
+			sig.Label += " ."
+		}
+		sig.Label += " " + l
+		sig.Parameters = append(sig.Parameters, lsp.ParameterInformation{Label: l})
+	}
+	sig.Label += ")"
+	if doc != "" {
+		sig.Documentation = &lsp.MarkupContent{Kind: lsp.Markdown, Value: doc}
+	}
+
+	active := argumentIndex(call, p)
+	if active >= len(labels) && rest != -1 {
+		active = rest
+	}
+	sig.ActiveParameter = uint32(active)
+	return &lsp.SignatureHelp{
+		Signatures:      []lsp.SignatureInformation{sig},
+		ActiveParameter: uint32(active),
+	}
+}
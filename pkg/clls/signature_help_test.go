@@ -0,0 +1,51 @@
+package clls
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+	"go.uber.org/zap"
+)
+
+func TestSignatureHelp(t *testing.T) {
+	mod, err := LoadCLVMFromStrings(zap.NewNop(), uri.New("file://main.clvm"), map[lsp.DocumentURI]string{
+		uri.New("file://main.clvm"): `(mod (A B)
+	; sums everything
+	(defun add (x (y z) . rest) (+ x y z rest))
+	(defun all-args args args)
+	(add A (list B B) (- A B) 1 2)
+)`,
+	})
+	require.NoError(t, err)
+
+	cases := []struct {
+		line, char int
+		label      string
+		active     uint32
+	}{
+		{4, 7, "(add x (y z) . rest)", 0},
+		{4, 8, "(add x (y z) . rest)", 1},
+		{4, 19, "(add x (y z) . rest)", 2},
+		{4, 27, "(add x (y z) . rest)", 2},
+		{4, 30, "(add x (y z) . rest)", 2},
+		{4, 13, "(list items ...)", 0},
+		{4, 24, "(- value subtrahends ...)", 1},
+		{3, 24, "", 0},
+	}
+	for _, c := range cases {
+		sh := mod.SignatureHelp(lsp.Position{Line: uint32(c.line), Character: uint32(c.char)})
+		if c.label == "" {
+			require.Nil(t, sh)
+			continue
+		}
+		require.NotNil(t, sh, "%d:%d", c.line, c.char)
+		require.Equal(t, c.label, sh.Signatures[0].Label)
+		require.Equal(t, c.active, sh.ActiveParameter, "%d:%d", c.line, c.char)
+	}
+
+	sh := mod.SignatureHelp(lsp.Position{Line: 4, Character: 8})
+	require.Equal(t, "sums everything", sh.Signatures[0].Documentation.(*lsp.MarkupContent).Value)
+	require.Len(t, sh.Signatures[0].Parameters, 3)
+}
@@ -4,9 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"strings"
 	"unicode"
 
-	"github.com/pkg/errors"
 	lsp "go.lsp.dev/protocol"
 )
 
@@ -202,7 +202,11 @@ func tokenize(text string, documentURI lsp.DocumentURI) (_ chan *Token, errptr *
 					j++
 				}
 				if j == len(text) {
-					*errptr = errors.New("unclosed quote")
+					start := updateTokenLine(&Token{Index: quoteStart})
+					*errptr = newProblem(lsp.Range{
+						Start: lsp.Position{Line: uint32(start.Line), Character: uint32(start.StartChar)},
+						End:   endPosition(text),
+					}, lsp.DiagnosticSeverityError, "unclosed quote")
 					return
 				}
 				i = j + 1
@@ -219,6 +223,24 @@ func tokenize(text string, documentURI lsp.DocumentURI) (_ chan *Token, errptr *
 	return ch, errptr
 }
 
+// endPosition returns the position of the end of the text, the character counts UTF-16 code units as in the protocol
+func endPosition(text string) lsp.Position {
+	lastLine := text[strings.LastIndex(text, "\n")+1:]
+	return lsp.Position{Line: uint32(strings.Count(text, "\n")), Character: uint32(utf16Len(lastLine))}
+}
+
+// utf16Len returns the number of UTF-16 code units encoding s
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n++
+		if r >= 0x10000 {
+			n++ // surrogate pair
+		}
+	}
+	return n
+}
+
 var tokenKindNames = map[tokenKind]string{
 	basicToken:       "basic",
 	parensCloseToken: "close",
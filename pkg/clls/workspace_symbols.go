@@ -0,0 +1,129 @@
+package clls
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	lsp "go.lsp.dev/protocol"
+)
+
+// WorkspaceSymbols returns the functions, macros and constants defined in the module file, included files are left out
+func (m *Module) WorkspaceSymbols() []lsp.SymbolInformation {
+	syms := []lsp.SymbolInformation(nil)
+	add := func(ds lsp.DocumentSymbol, name *Token) {
+		syms = append(syms, lsp.SymbolInformation{
+			Name:          ds.Name,
+			Kind:          ds.Kind,
+			Location:      lsp.Location{URI: name.DocumentURI, Range: ds.SelectionRange},
+			ContainerName: path.Base(string(name.DocumentURI)),
+		})
+	}
+	for _, f := range m.Functions {
+		if ds, ok := functionSymbol(f); ok {
+			add(ds, f.Name)
+		}
+	}
+	for _, c := range m.Constants {
+		if ds, ok := constantSymbol(c); ok {
+			add(ds, c.Name.(*Token))
+		}
+	}
+	return syms
+}
+
+// fuzzyScore matches the query characters in order in the name ignoring case,
+// matches at the start, after a separator or right after the previous match score higher
+func fuzzyScore(query, name string) (int, bool) {
+	q, n := strings.ToLower(query), strings.ToLower(name)
+	score, qi, prev := 0, 0, -2
+	for i := 0; i < len(n) && qi < len(q); i++ {
+		if n[i] != q[qi] {
+			continue
+		}
+		switch {
+		case i == 0:
+			score += 8
+		case i == prev+1:
+			score += 5
+		case n[i-1] == '-' || n[i-1] == '_':
+			score += 4
+		default:
+			score++
+		}
+		prev = i
+		qi++
+	}
+	return score, qi == len(q)
+}
+
+// SymbolIndex holds the symbols defined in a set of files
+type SymbolIndex struct {
+	files map[lsp.DocumentURI][]lsp.SymbolInformation
+}
+
+func NewSymbolIndex() *SymbolIndex {
+	return &SymbolIndex{files: map[lsp.DocumentURI][]lsp.SymbolInformation{}}
+}
+
+// Update replaces the symbols of the module file
+func (idx *SymbolIndex) Update(u lsp.DocumentURI, m *Module) {
+	idx.files[u] = m.WorkspaceSymbols()
+}
+
+func (idx *SymbolIndex) Remove(u lsp.DocumentURI) {
+	delete(idx.files, u)
+}
+
+func (idx *SymbolIndex) Has(u lsp.DocumentURI) bool {
+	_, ok := idx.files[u]
+	return ok
+}
+
+// Files returns the indexed files
+func (idx *SymbolIndex) Files() []lsp.DocumentURI {
+	r := make([]lsp.DocumentURI, 0, len(idx.files))
+	for u := range idx.files {
+		r = append(r, u)
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i] < r[j] })
+	return r
+}
+
+// Search returns the symbols fuzzy matching the query, best matches first, limit 0 means no limit
+func (idx *SymbolIndex) Search(query string, limit int) []lsp.SymbolInformation {
+	type match struct {
+		sym   lsp.SymbolInformation
+		score int
+	}
+	matches := []match(nil)
+	for _, syms := range idx.files {
+		for _, sym := range syms {
+			if score, ok := fuzzyScore(query, sym.Name); ok {
+				matches = append(matches, match{sym, score})
+			}
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		switch {
+		case a.score != b.score:
+			return a.score > b.score
+		case len(a.sym.Name) != len(b.sym.Name):
+			return len(a.sym.Name) < len(b.sym.Name)
+		case a.sym.Name != b.sym.Name:
+			return a.sym.Name < b.sym.Name
+		case a.sym.Location.URI != b.sym.Location.URI:
+			return a.sym.Location.URI < b.sym.Location.URI
+		}
+		return a.sym.Location.Range.Start.Line < b.sym.Location.Range.Start.Line
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	r := make([]lsp.SymbolInformation, len(matches))
+	for i, m := range matches {
+		r[i] = m.sym
+	}
+	return r
+}
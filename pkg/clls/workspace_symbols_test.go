@@ -0,0 +1,43 @@
+package clls
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+	"go.uber.org/zap"
+)
+
+func TestSymbolIndex(t *testing.T) {
+	files := map[lsp.DocumentURI]string{
+		uri.New("file:///ws/a.clvm"): "(mod (A) (defconstant MOD_HASH 0xcafe) (defun sha256tree (x) x) (sha256tree A))",
+		uri.New("file:///ws/b.clib"): "((defmacro assert-ok items 1) (defun-inline tree-hash (x) x))",
+	}
+	idx := NewSymbolIndex()
+	for u := range files {
+		mod, err := LoadCLVMFromStrings(zap.NewNop(), u, files)
+		require.NoError(t, err)
+		idx.Update(u, mod)
+	}
+
+	names := func(syms []lsp.SymbolInformation) []string {
+		r := []string(nil)
+		for _, s := range syms {
+			r = append(r, s.Name)
+		}
+		return r
+	}
+	require.Len(t, idx.Search("", 0), 4)
+	require.Equal(t, []string{"tree-hash", "sha256tree"}, names(idx.Search("tree", 0)))
+	require.Equal(t, []string{"MOD_HASH"}, names(idx.Search("mh", 0)))
+	require.Equal(t, []string{"assert-ok"}, names(idx.Search("aok", 1)))
+
+	sym := idx.Search("sha256tree", 0)[0]
+	require.Equal(t, lsp.SymbolKindFunction, sym.Kind)
+	require.Equal(t, uri.New("file:///ws/a.clvm"), sym.Location.URI)
+	require.Equal(t, "a.clvm", sym.ContainerName)
+
+	idx.Remove(uri.New("file:///ws/a.clvm"))
+	require.Equal(t, []string{"tree-hash"}, names(idx.Search("tree", 0)))
+}
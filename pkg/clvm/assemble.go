@@ -0,0 +1,150 @@
+package clvm
+
+import (
+	"encoding/hex"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	intRegexp = regexp.MustCompile(`^-?[0-9]+$`)
+	hexRegexp = regexp.MustCompile(`^0[xX][0-9a-fA-F]*$`)
+)
+
+type reader struct {
+	text string
+	pos  int
+}
+
+func (r *reader) skipSpaces() {
+	for r.pos < len(r.text) {
+		switch c := r.text[r.pos]; {
+		case c == ';':
+			for r.pos < len(r.text) && r.text[r.pos] != '\n' {
+				r.pos++
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			r.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (r *reader) errorf(format string, args ...interface{}) error {
+	return errors.Errorf("offset %d: "+format, append([]interface{}{r.pos}, args...)...)
+}
+
+func (r *reader) read() (*Value, error) {
+	r.skipSpaces()
+	if r.pos >= len(r.text) {
+		return nil, r.errorf("unexpected end of program")
+	}
+	switch c := r.text[r.pos]; c {
+	case '(':
+		r.pos++
+		return r.readList()
+	case ')':
+		return nil, r.errorf("unexpected closing parenthesis")
+	case '"', '\'':
+		end := strings.IndexByte(r.text[r.pos+1:], c)
+		if end == -1 {
+			return nil, r.errorf("unclosed quote")
+		}
+		s := r.text[r.pos+1 : r.pos+1+end]
+		r.pos += end + 2
+		return Atom([]byte(s)), nil
+	}
+	start := r.pos
+	for r.pos < len(r.text) && !strings.ContainsRune(" \t\r\n();\"'", rune(r.text[r.pos])) {
+		r.pos++
+	}
+	return atomFromWord(r.text[start:r.pos])
+}
+
+func (r *reader) readList() (*Value, error) {
+	items := []*Value(nil)
+	tail := Nil
+	for {
+		r.skipSpaces()
+		if r.pos >= len(r.text) {
+			return nil, r.errorf("unclosed parenthesis")
+		}
+		if r.text[r.pos] == ')' {
+			r.pos++
+			break
+		}
+		if r.text[r.pos] == '.' && r.pos+1 < len(r.text) && strings.ContainsRune(" \t\r\n(", rune(r.text[r.pos+1])) {
+			if len(items) == 0 {
+				return nil, r.errorf("dot without a first element")
+			}
+			r.pos++
+			v, err := r.read()
+			if err != nil {
+				return nil, err
+			}
+			r.skipSpaces()
+			if r.pos >= len(r.text) || r.text[r.pos] != ')' {
+				return nil, r.errorf("expected closing parenthesis after dotted value")
+			}
+			r.pos++
+			tail = v
+			break
+		}
+		v, err := r.read()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	for i := len(items) - 1; i >= 0; i-- {
+		tail = Cons(items[i], tail)
+	}
+	return tail, nil
+}
+
+func atomFromWord(w string) (*Value, error) {
+	switch {
+	case intRegexp.MatchString(w):
+		i, ok := new(big.Int).SetString(w, 10)
+		if !ok {
+			return nil, errors.Errorf("invalid integer '%s'", w)
+		}
+		return Int(i), nil
+	case hexRegexp.MatchString(w):
+		h := w[2:]
+		if len(h)%2 == 1 {
+			h = "0" + h
+		}
+		b, err := hex.DecodeString(h)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode hex")
+		}
+		return Atom(b), nil
+	}
+	if op, ok := OperatorsByName[w]; ok {
+		return Atom(op.OpcodeBytes()), nil
+	}
+	if w == "quote" {
+		return Atom(OperatorsByName["q"].OpcodeBytes()), nil
+	}
+	return Atom([]byte(w)), nil
+}
+
+// Assemble reads a program written in the CLVM s-expression syntax,
+// operator names are replaced by their opcodes and unknown symbols become string atoms
+func Assemble(text string) (*Value, error) {
+	r := &reader{text: text}
+	v, err := r.read()
+	if err != nil {
+		return nil, err
+	}
+	r.skipSpaces()
+	if r.pos != len(r.text) {
+		return nil, r.errorf("unexpected text after the program")
+	}
+	return v, nil
+}
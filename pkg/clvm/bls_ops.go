@@ -0,0 +1,264 @@
+package clvm
+
+import (
+	"math/big"
+
+	bls12381 "github.com/kilic/bls12-381"
+)
+
+// default domain separation tags of g1_map and g2_map, the ones of the augmented signature scheme
+var (
+	g1MapDST = []byte("BLS_SIG_BLS12381G1_XMD:SHA-256_SSWU_RO_AUG_")
+	g2MapDST = []byte("BLS_SIG_BLS12381G2_XMD:SHA-256_SSWU_RO_AUG_")
+)
+
+const maxDSTLen = 255
+
+func g1Arg(op *Operator, g *bls12381.G1, v *Value) (*bls12381.PointG1, error) {
+	b, err := atomArg(op, v)
+	if err != nil {
+		return nil, err
+	}
+	p, err := g.FromCompressed(b)
+	if err != nil {
+		return nil, evalError(v, "%s: atom is not a G1 point: %s", op.Name, err)
+	}
+	return p, nil
+}
+
+func g2Arg(op *Operator, g *bls12381.G2, v *Value) (*bls12381.PointG2, error) {
+	b, err := atomArg(op, v)
+	if err != nil {
+		return nil, err
+	}
+	p, err := g.FromCompressed(b)
+	if err != nil {
+		return nil, evalError(v, "%s: atom is not a G2 point: %s", op.Name, err)
+	}
+	return p, nil
+}
+
+// scalarArg reads an integer reduced modulo the group order
+func scalarArg(op *Operator, order *big.Int, v *Value) (*big.Int, int, error) {
+	i, size, err := intArg(op, v)
+	if err != nil {
+		return nil, 0, err
+	}
+	return new(big.Int).Mod(i, order), size, nil
+}
+
+// g1Fold adds the points to the first one, or subtracts them when sub is set
+func g1Fold(op *Operator, args []*Value, sub bool) (*Value, uint64, error) {
+	g := bls12381.NewG1()
+	acc := g.Zero()
+	cost := op.Cost.Base
+	for i, a := range args {
+		p, err := g1Arg(op, g, a)
+		if err != nil {
+			return nil, 0, err
+		}
+		if sub && i > 0 {
+			g.Sub(acc, acc, p)
+		} else {
+			g.Add(acc, acc, p)
+		}
+		cost += op.Cost.PerArg
+	}
+	return mallocCost(cost, Atom(g.ToCompressed(acc)))
+}
+
+func g2Fold(op *Operator, args []*Value, sub bool) (*Value, uint64, error) {
+	g := bls12381.NewG2()
+	acc := g.Zero()
+	cost := op.Cost.Base
+	for i, a := range args {
+		p, err := g2Arg(op, g, a)
+		if err != nil {
+			return nil, 0, err
+		}
+		if sub && i > 0 {
+			g.Sub(acc, acc, p)
+		} else {
+			g.Add(acc, acc, p)
+		}
+		cost += op.Cost.PerArg
+	}
+	return mallocCost(cost, Atom(g.ToCompressed(acc)))
+}
+
+func opPointAdd(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	return g1Fold(op, args, false)
+}
+
+func opG1Subtract(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	return g1Fold(op, args, true)
+}
+
+func opG2Add(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	return g2Fold(op, args, false)
+}
+
+func opG2Subtract(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	return g2Fold(op, args, true)
+}
+
+func opPubkeyForExp(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	g := bls12381.NewG1()
+	e, size, err := scalarArg(op, g.Q(), args[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	p := g.MulScalarBig(g.New(), g.One(), e)
+	return mallocCost(op.Cost.Base+uint64(size)*op.Cost.PerByte, Atom(g.ToCompressed(p)))
+}
+
+func opG1Multiply(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	g := bls12381.NewG1()
+	p, err := g1Arg(op, g, args[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	e, size, err := scalarArg(op, g.Q(), args[1])
+	if err != nil {
+		return nil, 0, err
+	}
+	p = g.MulScalarBig(g.New(), p, e)
+	return mallocCost(op.Cost.Base+uint64(size)*op.Cost.PerByte, Atom(g.ToCompressed(p)))
+}
+
+func opG2Multiply(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	g := bls12381.NewG2()
+	p, err := g2Arg(op, g, args[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	e, size, err := scalarArg(op, g.Q(), args[1])
+	if err != nil {
+		return nil, 0, err
+	}
+	p = g.MulScalarBig(g.New(), p, e)
+	return mallocCost(op.Cost.Base+uint64(size)*op.Cost.PerByte, Atom(g.ToCompressed(p)))
+}
+
+func opG1Negate(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	g := bls12381.NewG1()
+	p, err := g1Arg(op, g, args[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	return mallocCost(op.Cost.Base, Atom(g.ToCompressed(g.Neg(g.New(), p))))
+}
+
+func opG2Negate(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	g := bls12381.NewG2()
+	p, err := g2Arg(op, g, args[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	return mallocCost(op.Cost.Base, Atom(g.ToCompressed(g.Neg(g.New(), p))))
+}
+
+// mapArgs returns the data and domain separation tag of g1_map and g2_map with the cost of hashing them
+func mapArgs(op *Operator, args []*Value, defaultDST []byte) ([]byte, []byte, uint64, error) {
+	data, err := atomArg(op, args[0])
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	dst := defaultDST
+	if len(args) == 2 {
+		if dst, err = atomArg(op, args[1]); err != nil {
+			return nil, nil, 0, err
+		}
+		if len(dst) > maxDSTLen {
+			return nil, nil, 0, evalError(args[1], "%s: dst is too long", op.Name)
+		}
+	}
+	return data, dst, op.Cost.Base + uint64(len(data)+len(dst))*op.Cost.PerByte, nil
+}
+
+func opG1Map(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	data, dst, cost, err := mapArgs(op, args, g1MapDST)
+	if err != nil {
+		return nil, 0, err
+	}
+	g := bls12381.NewG1()
+	p, err := g.HashToCurve(data, dst)
+	if err != nil {
+		return nil, 0, evalError(List(args...), "%s: %s", op.Name, err)
+	}
+	return mallocCost(cost, Atom(g.ToCompressed(p)))
+}
+
+func opG2Map(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	data, dst, cost, err := mapArgs(op, args, g2MapDST)
+	if err != nil {
+		return nil, 0, err
+	}
+	g := bls12381.NewG2()
+	p, err := g.HashToCurve(data, dst)
+	if err != nil {
+		return nil, 0, evalError(List(args...), "%s: %s", op.Name, err)
+	}
+	return mallocCost(cost, Atom(g.ToCompressed(p)))
+}
+
+func opBLSPairingIdentity(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	if len(args)%2 != 0 {
+		return nil, 0, evalError(List(args...), "%s takes pairs of G1 and G2 points", op.Name)
+	}
+	g1, g2 := bls12381.NewG1(), bls12381.NewG2()
+	e := bls12381.NewEngine()
+	cost := op.Cost.Base
+	for i := 0; i < len(args); i += 2 {
+		p, err := g1Arg(op, g1, args[i])
+		if err != nil {
+			return nil, 0, err
+		}
+		q, err := g2Arg(op, g2, args[i+1])
+		if err != nil {
+			return nil, 0, err
+		}
+		e.AddPair(p, q)
+		cost += op.Cost.PerArg
+	}
+	if !e.Check() {
+		return nil, 0, evalError(List(args...), "%s failed", op.Name)
+	}
+	return Nil, cost, nil
+}
+
+// opBLSVerify checks an aggregate signature of the augmented scheme,
+// where each message is prefixed by its public key before being hashed
+func opBLSVerify(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	if len(args)%2 != 1 {
+		return nil, 0, evalError(List(args...), "%s takes a signature followed by pairs of public keys and messages", op.Name)
+	}
+	g1, g2 := bls12381.NewG1(), bls12381.NewG2()
+	sig, err := g2Arg(op, g2, args[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	e := bls12381.NewEngine()
+	e.AddPairInv(g1.One(), sig)
+	cost := op.Cost.Base
+	for i := 1; i < len(args); i += 2 {
+		pk, err := g1Arg(op, g1, args[i])
+		if err != nil {
+			return nil, 0, err
+		}
+		msg, err := atomArg(op, args[i+1])
+		if err != nil {
+			return nil, 0, err
+		}
+		h, err := g2.HashToCurve(append(append([]byte{}, args[i].Atom...), msg...), g2MapDST)
+		if err != nil {
+			return nil, 0, evalError(args[i+1], "%s: %s", op.Name, err)
+		}
+		e.AddPair(pk, h)
+		cost += op.Cost.PerArg
+	}
+	if !e.Check() {
+		return nil, 0, evalError(List(args...), "%s failed", op.Name)
+	}
+	return Nil, cost, nil
+}
@@ -0,0 +1,57 @@
+package clvm
+
+import (
+	"bytes"
+)
+
+// Curry binds args to the first parameters of mod following the standard convention,
+// the result is (a (q . mod) (c (q . arg1) (c (q . arg2) ... 1)))
+func Curry(mod *Value, args ...*Value) *Value {
+	env := Atom([]byte{0x01})
+	for i := len(args) - 1; i >= 0; i-- {
+		env = List(Atom(OperatorsByName["c"].OpcodeBytes()), Cons(Atom(quoteAtom), args[i]), env)
+	}
+	return List(Atom(applyAtom), Cons(Atom(quoteAtom), mod), env)
+}
+
+// Uncurry returns the module and arguments of a program produced by Curry
+func Uncurry(program *Value) (*Value, []*Value, bool) {
+	items, ok := program.ListItems()
+	if !ok || len(items) != 3 || !isOperator(items[0], applyAtom) {
+		return nil, nil, false
+	}
+	mod, ok := quoted(items[1])
+	if !ok {
+		return nil, nil, false
+	}
+	args := []*Value(nil)
+	env := items[2]
+	consAtom := OperatorsByName["c"].OpcodeBytes()
+	for env.IsPair() {
+		items, ok := env.ListItems()
+		if !ok || len(items) != 3 || !isOperator(items[0], consAtom) {
+			return nil, nil, false
+		}
+		arg, ok := quoted(items[1])
+		if !ok {
+			return nil, nil, false
+		}
+		args = append(args, arg)
+		env = items[2]
+	}
+	if !bytes.Equal(env.Atom, []byte{0x01}) {
+		return nil, nil, false
+	}
+	return mod, args, true
+}
+
+func isOperator(v *Value, opcode []byte) bool {
+	return !v.IsPair() && bytes.Equal(v.Atom, opcode)
+}
+
+func quoted(v *Value) (*Value, bool) {
+	if !v.IsPair() || !isOperator(v.First, quoteAtom) {
+		return nil, false
+	}
+	return v.Rest, true
+}
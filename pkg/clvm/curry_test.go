@@ -0,0 +1,27 @@
+package clvm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCurry(t *testing.T) {
+	mod, err := Assemble("(+ 2 5)")
+	require.NoError(t, err)
+	curried := Curry(mod, Int64(40))
+	require.Equal(t, "(a (q 16 2 5) (c (q . 40) 1))", curried.String())
+
+	res, _, err := Run(curried, List(Int64(2)), 0)
+	require.NoError(t, err)
+	require.Equal(t, "42", res.String())
+
+	m, args, ok := Uncurry(curried)
+	require.True(t, ok)
+	require.True(t, mod.Equal(m))
+	require.Len(t, args, 1)
+	require.True(t, Int64(40).Equal(args[0]))
+
+	_, _, ok = Uncurry(mod)
+	require.False(t, ok)
+}
@@ -0,0 +1,31 @@
+package clvm
+
+import (
+	"crypto/sha256"
+)
+
+func hashAtom(b []byte) [32]byte {
+	return sha256.Sum256(append([]byte{1}, b...))
+}
+
+func hashPair(first, rest [32]byte) [32]byte {
+	return sha256.Sum256(append(append([]byte{2}, first[:]...), rest[:]...))
+}
+
+// TreeHash returns the standard sha256tree hash of the value,
+// sha256(1 . atom) for atoms and sha256(2 . hash(first) . hash(rest)) for pairs
+func (v *Value) TreeHash() [32]byte {
+	if !v.IsPair() {
+		return hashAtom(v.Atom)
+	}
+	// hash the list spine iteratively, programs are mostly long lists
+	spine := []*Value(nil)
+	for ; v.IsPair(); v = v.Rest {
+		spine = append(spine, v)
+	}
+	h := hashAtom(v.Atom)
+	for i := len(spine) - 1; i >= 0; i-- {
+		h = hashPair(spine[i].First.TreeHash(), h)
+	}
+	return h
+}
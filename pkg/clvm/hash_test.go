@@ -0,0 +1,23 @@
+package clvm
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTreeHash(t *testing.T) {
+	for text, expected := range map[string]string{
+		"()":            "4bf5122f344554c53bde2ebb8cd2b7e3d1600ad631c385a5d7cce23c7785459a",
+		"1":             "9dcf97a184f32623d11a73124ceb99a5709b083721e878a16d78f596718ba7b2",
+		"(c (q . 1) 2)": "1c77d7d5efde60a7a1d2d27db6d746bc8e568aea1ef8586ca967a0d60b83cc36",
+	} {
+		v, err := Assemble(text)
+		require.NoError(t, err)
+		h := v.TreeHash()
+		require.Equal(t, expected, hex.EncodeToString(h[:]), text)
+		// the compressor hashes every node of the tree on its own
+		require.Equal(t, h, newTreeInfo(v).hashes[v], text)
+	}
+}
@@ -0,0 +1,138 @@
+package clvm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Cost is the formula used to compute the cost of an operator call,
+// the malloc cost of the result (10 per byte) is added on top of it
+type Cost struct {
+	Base    uint64
+	PerArg  uint64
+	PerByte uint64
+	Note    string `json:",omitempty"` // non-linear terms that don't fit the fields above
+}
+
+func (c Cost) String() string {
+	parts := []string{fmt.Sprint(c.Base)}
+	if c.PerArg != 0 {
+		parts = append(parts, fmt.Sprintf("%d per argument", c.PerArg))
+	}
+	if c.PerByte != 0 {
+		parts = append(parts, fmt.Sprintf("%d per argument byte", c.PerByte))
+	}
+	if c.Note != "" {
+		parts = append(parts, c.Note)
+	}
+	return strings.Join(parts, " + ")
+}
+
+// Operator describes a CLVM operator
+type Operator struct {
+	Name    string
+	Opcode  uint32
+	Params  string
+	MinArgs int
+	MaxArgs int // -1 means variadic
+	Cost    Cost
+	Doc     string
+}
+
+// OpcodeBytes returns the atom encoding the operator
+func (op *Operator) OpcodeBytes() []byte {
+	b := []byte(nil)
+	for o := op.Opcode; o != 0; o >>= 8 {
+		b = append([]byte{byte(o)}, b...)
+	}
+	return b
+}
+
+// Operators are the operators of the CLVM. sha256tree1, often taken for one, is not: puzzles define it
+// with a defun (see pkg/examples/p2_puzzle_hash.clvm) and hashing a tree costs that of the operators it runs.
+var Operators = []*Operator{
+	// core
+	{"q", 0x01, "(value)", 1, 1, Cost{Base: 20}, "Returns `value` without evaluating it. Usually written `(q . value)`."},
+	{"a", 0x02, "(program env)", 2, 2, Cost{Base: 90}, "Runs `program` with `env` as its environment and returns the result."},
+	{"i", 0x03, "(cond then else)", 3, 3, Cost{Base: 33}, "Returns `then` if `cond` is non-nil, `else` otherwise. Both branches are evaluated."},
+	{"c", 0x04, "(first rest)", 2, 2, Cost{Base: 50}, "Constructs a new pair (cons box) from `first` and `rest`."},
+	{"f", 0x05, "(pair)", 1, 1, Cost{Base: 30}, "Returns the first element of `pair`. Fails on an atom."},
+	{"r", 0x06, "(pair)", 1, 1, Cost{Base: 30}, "Returns the rest of `pair`. Fails on an atom."},
+	{"l", 0x07, "(value)", 1, 1, Cost{Base: 19}, "Returns 1 if `value` is a pair, nil if it is an atom."},
+	{"x", 0x08, "(values ...)", 0, -1, Cost{}, "Raises an exception, aborting the program with the given values."},
+
+	// atoms as strings
+	{"=", 0x09, "(a b)", 2, 2, Cost{Base: 117, PerByte: 1}, "Returns 1 if the atoms `a` and `b` are equal, nil otherwise."},
+	{">s", 0x0a, "(a b)", 2, 2, Cost{Base: 117, PerByte: 1}, "Returns 1 if the atom `a` is greater than `b` in lexicographic byte order, nil otherwise."},
+	{"sha256", 0x0b, "(atoms ...)", 0, -1, Cost{Base: 87, PerArg: 134, PerByte: 2}, "Returns the SHA-256 hash of the concatenation of the given atoms."},
+	{"substr", 0x0c, "(atom start end)", 2, 3, Cost{Base: 1}, "Returns the bytes of `atom` from `start` to `end` (or to its end when omitted)."},
+	{"strlen", 0x0d, "(atom)", 1, 1, Cost{Base: 173, PerByte: 1}, "Returns the length in bytes of `atom`."},
+	{"concat", 0x0e, "(atoms ...)", 0, -1, Cost{Base: 142, PerArg: 135, PerByte: 3}, "Returns the concatenation of the given atoms."},
+
+	// atoms as integers
+	{"+", 0x10, "(values ...)", 0, -1, Cost{Base: 99, PerArg: 320, PerByte: 3}, "Returns the sum of the given integers."},
+	{"-", 0x11, "(value subtrahends ...)", 0, -1, Cost{Base: 99, PerArg: 320, PerByte: 3}, "Returns the first integer minus all the following ones."},
+	{"*", 0x12, "(values ...)", 0, -1, Cost{Base: 92, PerArg: 885, PerByte: 6, Note: "product of the operands sizes / 128"}, "Returns the product of the given integers."},
+	{"/", 0x13, "(a b)", 2, 2, Cost{Base: 988, PerByte: 4}, "Returns the floored quotient of `a` by `b`. Fails when `b` is zero."},
+	{"divmod", 0x14, "(a b)", 2, 2, Cost{Base: 1116, PerByte: 6}, "Returns the pair `(quotient . remainder)` of the floored division of `a` by `b`."},
+	{">", 0x15, "(a b)", 2, 2, Cost{Base: 498, PerByte: 2}, "Returns 1 if the integer `a` is greater than `b`, nil otherwise."},
+	{"ash", 0x16, "(value shift)", 2, 2, Cost{Base: 596, PerByte: 3}, "Arithmetic shift of `value` by `shift` bits, left when positive and right when negative."},
+	{"lsh", 0x17, "(value shift)", 2, 2, Cost{Base: 277, PerByte: 3}, "Logical shift of the unsigned `value` by `shift` bits, left when positive and right when negative."},
+
+	// atoms as bit vectors
+	{"logand", 0x18, "(values ...)", 0, -1, Cost{Base: 100, PerArg: 264, PerByte: 3}, "Returns the bitwise AND of the given integers."},
+	{"logior", 0x19, "(values ...)", 0, -1, Cost{Base: 100, PerArg: 264, PerByte: 3}, "Returns the bitwise OR of the given integers."},
+	{"logxor", 0x1a, "(values ...)", 0, -1, Cost{Base: 100, PerArg: 264, PerByte: 3}, "Returns the bitwise XOR of the given integers."},
+	{"lognot", 0x1b, "(value)", 1, 1, Cost{Base: 331, PerByte: 3}, "Returns the bitwise NOT of the given integer."},
+
+	// bls12-381
+	{"point_add", 0x1d, "(points ...)", 0, -1, Cost{Base: 101094, PerArg: 1343980}, "Adds the given G1 points together and returns the resulting point. Also known as `g1_add`."},
+	{"g1_add", 0x1d, "(points ...)", 0, -1, Cost{Base: 101094, PerArg: 1343980}, "Adds the given G1 points together and returns the resulting point."},
+	{"pubkey_for_exp", 0x1e, "(exponent)", 1, 1, Cost{Base: 1325730, PerByte: 38}, "Returns the G1 point obtained by multiplying the generator by `exponent` (mod the group order)."},
+
+	// booleans
+	{"not", 0x20, "(value)", 1, 1, Cost{Base: 200}, "Returns 1 if `value` is nil, nil otherwise."},
+	{"any", 0x21, "(values ...)", 0, -1, Cost{Base: 200, PerArg: 300}, "Returns 1 if any of the values is non-nil, nil otherwise. All values are evaluated."},
+	{"all", 0x22, "(values ...)", 0, -1, Cost{Base: 200, PerArg: 300}, "Returns 1 if all the values are non-nil, nil otherwise. All values are evaluated."},
+
+	// misc
+	{"softfork", 0x24, "(cost extension program env)", 1, -1, Cost{Note: "the cost given as first argument"}, "Runs `program` with the operators of `extension` and returns nil. Unknown extensions succeed without running anything."},
+
+	// extended operators
+	{"coinid", 0x30, "(parent_id puzzle_hash amount)", 3, 3, Cost{Base: 800}, "Returns the id of the coin with the given parent id, puzzle hash and amount, validating the arguments."},
+	{"g1_subtract", 0x31, "(point subtrahends ...)", 0, -1, Cost{Base: 101094, PerArg: 1343980}, "Returns the first G1 point minus all the following ones."},
+	{"g1_multiply", 0x32, "(point scalar)", 2, 2, Cost{Base: 705500, PerByte: 10}, "Multiplies the G1 point by the integer `scalar`."},
+	{"g1_negate", 0x33, "(point)", 1, 1, Cost{Base: 1396}, "Returns the negation of the G1 point."},
+	{"g2_add", 0x34, "(points ...)", 0, -1, Cost{Base: 80000, PerArg: 1950000}, "Adds the given G2 points together and returns the resulting point."},
+	{"g2_subtract", 0x35, "(point subtrahends ...)", 0, -1, Cost{Base: 80000, PerArg: 1950000}, "Returns the first G2 point minus all the following ones."},
+	{"g2_multiply", 0x36, "(point scalar)", 2, 2, Cost{Base: 2100000, PerByte: 5}, "Multiplies the G2 point by the integer `scalar`."},
+	{"g2_negate", 0x37, "(point)", 1, 1, Cost{Base: 2164}, "Returns the negation of the G2 point."},
+	{"g1_map", 0x38, "(data dst)", 1, 2, Cost{Base: 195000, PerByte: 4}, "Hashes `data` to a G1 point, using the optional domain separation tag `dst`."},
+	{"g2_map", 0x39, "(data dst)", 1, 2, Cost{Base: 815000, PerByte: 4}, "Hashes `data` to a G2 point, using the optional domain separation tag `dst`."},
+	{"bls_pairing_identity", 0x3a, "(g1 g2 ...)", 0, -1, Cost{Base: 3000000, PerArg: 1200000}, "Fails unless the product of the pairings of the given (G1, G2) points is the identity."},
+	{"bls_verify", 0x3b, "(signature g1 message ...)", 1, -1, Cost{Base: 3000000, PerArg: 1200000}, "Fails unless the G2 `signature` is valid for the given (public key, message) pairs."},
+	{"modpow", 0x3c, "(base exponent modulus)", 3, 3, Cost{Base: 17000, PerByte: 38, Note: "terms quadratic in the exponent and modulus sizes"}, "Returns `base` raised to `exponent`, modulo `modulus`."},
+	{"%", 0x3d, "(a b)", 2, 2, Cost{Base: 988, PerByte: 4}, "Returns the remainder of the floored division of `a` by `b`."},
+	{"keccak256", 0x3e, "(atoms ...)", 0, -1, Cost{Base: 50, PerArg: 160, PerByte: 2}, "Returns the Keccak-256 hash of the concatenation of the given atoms."},
+	{"secp256k1_verify", 0x13d61f00, "(pubkey message_hash signature)", 3, 3, Cost{Base: 1300000}, "Fails unless `signature` is a valid secp256k1 signature of `message_hash` by `pubkey`."},
+	{"secp256r1_verify", 0x1c3a8f00, "(pubkey message_hash signature)", 3, 3, Cost{Base: 1850000}, "Fails unless `signature` is a valid secp256r1 signature of `message_hash` by `pubkey`."},
+}
+
+var OperatorsByName = func() map[string]*Operator {
+	m := map[string]*Operator{}
+	for _, op := range Operators {
+		m[op.Name] = op
+	}
+	return m
+}()
+
+// OperatorsByOpcode maps opcodes to operators, aliases resolve to their first name in Operators
+var OperatorsByOpcode = func() map[uint32]*Operator {
+	m := map[uint32]*Operator{}
+	for _, op := range Operators {
+		if _, ok := m[op.Opcode]; !ok {
+			m[op.Opcode] = op
+		}
+	}
+	return m
+}()
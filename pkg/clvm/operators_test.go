@@ -0,0 +1,57 @@
+package clvm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperators(t *testing.T) {
+	cases := []struct {
+		name             string
+		opcode           uint32
+		minArgs, maxArgs int
+		cost             string
+	}{
+		{"q", 0x01, 1, 1, "20"},
+		{"i", 0x03, 3, 3, "33"},
+		{"sha256", 0x0b, 0, -1, "87 + 134 per argument + 2 per argument byte"},
+		{"substr", 0x0c, 2, 3, "1"},
+		{"*", 0x12, 0, -1, "92 + 885 per argument + 6 per argument byte + product of the operands sizes / 128"},
+		{"softfork", 0x24, 1, -1, "0 + the cost given as first argument"},
+		{"coinid", 0x30, 3, 3, "800"},
+		{"secp256k1_verify", 0x13d61f00, 3, 3, "1300000"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			op, ok := OperatorsByName[c.name]
+			require.True(t, ok)
+			require.Equal(t, c.opcode, op.Opcode)
+			require.Equal(t, c.minArgs, op.MinArgs)
+			require.Equal(t, c.maxArgs, op.MaxArgs)
+			require.Equal(t, c.cost, op.Cost.String())
+			require.NotEmpty(t, op.Doc)
+		})
+	}
+}
+
+func TestNotOperators(t *testing.T) {
+	// defined by the puzzles themselves
+	for _, name := range []string{"sha256tree1", "sha256tree"} {
+		_, ok := OperatorsByName[name]
+		require.False(t, ok, name)
+	}
+}
+
+func TestOperatorsByOpcode(t *testing.T) {
+	// aliases resolve to the first name
+	require.Equal(t, "point_add", OperatorsByOpcode[0x1d].Name)
+	require.Equal(t, "g1_add", OperatorsByName["g1_add"].Name)
+	require.Equal(t, []byte{0x13, 0xd6, 0x1f, 0x00}, OperatorsByName["secp256k1_verify"].OpcodeBytes())
+	require.Equal(t, []byte{0x0b}, OperatorsByName["sha256"].OpcodeBytes())
+
+	for _, op := range Operators {
+		require.Contains(t, OperatorsByOpcode, op.Opcode, op.Name)
+		require.True(t, op.MaxArgs == -1 || op.MinArgs <= op.MaxArgs, op.Name)
+	}
+}
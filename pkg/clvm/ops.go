@@ -0,0 +1,577 @@
+package clvm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math"
+	"math/big"
+
+	"golang.org/x/crypto/sha3"
+)
+
+type operatorFunc func(r *runner, op *Operator, args []*Value) (*Value, uint64, error)
+
+// operatorFuncs maps opcodes to their implementation, q and a are handled by the evaluator
+var operatorFuncs map[uint32]operatorFunc
+
+func init() {
+	operatorFuncs = map[uint32]operatorFunc{
+		0x03: opIf,
+		0x04: opCons,
+		0x05: opFirst,
+		0x06: opRest,
+		0x07: opListp,
+		0x08: opRaise,
+		0x09: opEq,
+		0x0a: opGrBytes,
+		0x0b: opSha256,
+		0x0c: opSubstr,
+		0x0d: opStrlen,
+		0x0e: opConcat,
+		0x10: opAdd,
+		0x11: opSubtract,
+		0x12: opMultiply,
+		0x13: opDiv,
+		0x14: opDivmod,
+		0x15: opGr,
+		0x16: opAsh,
+		0x17: opLsh,
+		0x18: opLogand,
+		0x19: opLogior,
+		0x1a: opLogxor,
+		0x1b: opLognot,
+		0x1d: opPointAdd,
+		0x1e: opPubkeyForExp,
+		0x20: opNot,
+		0x21: opAny,
+		0x22: opAll,
+		0x24: opSoftfork,
+
+		0x30:       opCoinID,
+		0x31:       opG1Subtract,
+		0x32:       opG1Multiply,
+		0x33:       opG1Negate,
+		0x34:       opG2Add,
+		0x35:       opG2Subtract,
+		0x36:       opG2Multiply,
+		0x37:       opG2Negate,
+		0x38:       opG1Map,
+		0x39:       opG2Map,
+		0x3a:       opBLSPairingIdentity,
+		0x3b:       opBLSVerify,
+		0x3c:       opModpow,
+		0x3d:       opMod,
+		0x3e:       opKeccak256,
+		0x13d61f00: opSecp256k1Verify,
+		0x1c3a8f00: opSecp256r1Verify,
+	}
+}
+
+func atomArg(op *Operator, v *Value) ([]byte, error) {
+	if v.IsPair() {
+		return nil, evalError(v, "%s on list", op.Name)
+	}
+	return v.Atom, nil
+}
+
+func intArg(op *Operator, v *Value) (*big.Int, int, error) {
+	if v.IsPair() {
+		return nil, 0, evalError(v, "%s requires int args", op.Name)
+	}
+	return IntFromBytes(v.Atom), len(v.Atom), nil
+}
+
+// smallIntArg decodes an argument that must fit in an int32
+func smallIntArg(op *Operator, v *Value) (int, error) {
+	i, _, err := intArg(op, v)
+	if err != nil {
+		return 0, err
+	}
+	if len(v.Atom) > 4 || !i.IsInt64() {
+		return 0, evalError(v, "%s requires int32 args (with no leading zeros)", op.Name)
+	}
+	return int(i.Int64()), nil
+}
+
+func opIf(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	if args[0].IsNil() {
+		return args[2], op.Cost.Base, nil
+	}
+	return args[1], op.Cost.Base, nil
+}
+
+func opCons(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	return Cons(args[0], args[1]), op.Cost.Base, nil
+}
+
+func opFirst(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	if !args[0].IsPair() {
+		return nil, 0, evalError(args[0], "first of non-cons")
+	}
+	return args[0].First, op.Cost.Base, nil
+}
+
+func opRest(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	if !args[0].IsPair() {
+		return nil, 0, evalError(args[0], "rest of non-cons")
+	}
+	return args[0].Rest, op.Cost.Base, nil
+}
+
+func opListp(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	return Bool(args[0].IsPair()), op.Cost.Base, nil
+}
+
+func opRaise(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	// a single atom argument is raised as is, otherwise the whole list is
+	if len(args) == 1 && !args[0].IsPair() {
+		return nil, 0, evalError(args[0], "clvm raise")
+	}
+	return nil, 0, evalError(List(args...), "clvm raise")
+}
+
+func opEq(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	a0, err := atomArg(op, args[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	a1, err := atomArg(op, args[1])
+	if err != nil {
+		return nil, 0, err
+	}
+	cost := op.Cost.Base + uint64(len(a0)+len(a1))*op.Cost.PerByte
+	return Bool(bytes.Equal(a0, a1)), cost, nil
+}
+
+func opGrBytes(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	a0, err := atomArg(op, args[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	a1, err := atomArg(op, args[1])
+	if err != nil {
+		return nil, 0, err
+	}
+	cost := op.Cost.Base + uint64(len(a0)+len(a1))*op.Cost.PerByte
+	return Bool(bytes.Compare(a0, a1) > 0), cost, nil
+}
+
+func hashArgs(op *Operator, args []*Value, write func([]byte)) (uint64, error) {
+	cost := op.Cost.Base
+	for _, a := range args {
+		b, err := atomArg(op, a)
+		if err != nil {
+			return 0, err
+		}
+		write(b)
+		cost += op.Cost.PerArg + uint64(len(b))*op.Cost.PerByte
+	}
+	return cost, nil
+}
+
+func opSha256(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	h := sha256.New()
+	cost, err := hashArgs(op, args, func(b []byte) { h.Write(b) })
+	if err != nil {
+		return nil, 0, err
+	}
+	return mallocCost(cost, Atom(h.Sum(nil)))
+}
+
+func opKeccak256(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	h := sha3.NewLegacyKeccak256()
+	cost, err := hashArgs(op, args, func(b []byte) { h.Write(b) })
+	if err != nil {
+		return nil, 0, err
+	}
+	return mallocCost(cost, Atom(h.Sum(nil)))
+}
+
+func opSubstr(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	s, err := atomArg(op, args[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	start, err := smallIntArg(op, args[1])
+	if err != nil {
+		return nil, 0, err
+	}
+	end := len(s)
+	if len(args) == 3 {
+		if end, err = smallIntArg(op, args[2]); err != nil {
+			return nil, 0, err
+		}
+	}
+	if end > len(s) || end < start || start < 0 {
+		return nil, 0, evalError(List(args...), "invalid indices for substr")
+	}
+	return Atom(s[start:end]), op.Cost.Base, nil
+}
+
+func opStrlen(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	s, err := atomArg(op, args[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	return mallocCost(op.Cost.Base+uint64(len(s))*op.Cost.PerByte, Int64(int64(len(s))))
+}
+
+func opConcat(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	buf := []byte{}
+	cost, err := hashArgs(op, args, func(b []byte) { buf = append(buf, b...) })
+	if err != nil {
+		return nil, 0, err
+	}
+	return mallocCost(cost, Atom(buf))
+}
+
+// reduceInts folds the integer arguments with f, the cost depends on the arguments count and size
+func reduceInts(op *Operator, args []*Value, init *big.Int, f func(acc, v *big.Int, first bool)) (*Value, uint64, error) {
+	acc := init
+	cost := op.Cost.Base
+	for i, a := range args {
+		v, size, err := intArg(op, a)
+		if err != nil {
+			return nil, 0, err
+		}
+		f(acc, v, i == 0)
+		cost += op.Cost.PerArg + uint64(size)*op.Cost.PerByte
+	}
+	return mallocCost(cost, Int(acc))
+}
+
+func opAdd(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	return reduceInts(op, args, new(big.Int), func(acc, v *big.Int, _ bool) { acc.Add(acc, v) })
+}
+
+func opSubtract(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	return reduceInts(op, args, new(big.Int), func(acc, v *big.Int, first bool) {
+		if first {
+			acc.Set(v)
+		} else {
+			acc.Sub(acc, v)
+		}
+	})
+}
+
+func opLogand(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	return reduceInts(op, args, big.NewInt(-1), func(acc, v *big.Int, _ bool) { acc.And(acc, v) })
+}
+
+func opLogior(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	return reduceInts(op, args, new(big.Int), func(acc, v *big.Int, _ bool) { acc.Or(acc, v) })
+}
+
+func opLogxor(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	return reduceInts(op, args, new(big.Int), func(acc, v *big.Int, _ bool) { acc.Xor(acc, v) })
+}
+
+func opLognot(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	v, size, err := intArg(op, args[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	return mallocCost(op.Cost.Base+uint64(size)*op.Cost.PerByte, Int(new(big.Int).Not(v)))
+}
+
+// mulSquareCostDivider divides the product of the operands sizes in the multiplication cost
+const mulSquareCostDivider = 128
+
+func opMultiply(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	cost := op.Cost.Base
+	if len(args) == 0 {
+		return mallocCost(cost, Int64(1))
+	}
+	acc, accSize, err := intArg(op, args[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, a := range args[1:] {
+		v, size, err := intArg(op, a)
+		if err != nil {
+			return nil, 0, err
+		}
+		cost += op.Cost.PerArg
+		cost += uint64(accSize+size) * op.Cost.PerByte
+		cost += uint64(accSize*size) / mulSquareCostDivider
+		acc = new(big.Int).Mul(acc, v)
+		accSize = (acc.BitLen() + 7) / 8
+	}
+	return mallocCost(cost, Int(acc))
+}
+
+// floorDivMod divides rounding toward negative infinity, the remainder has the sign of the divisor
+func floorDivMod(a, b *big.Int) (*big.Int, *big.Int) {
+	q, m := new(big.Int).QuoRem(a, b, new(big.Int))
+	if m.Sign() != 0 && m.Sign() != b.Sign() {
+		q.Sub(q, big.NewInt(1))
+		m.Add(m, b)
+	}
+	return q, m
+}
+
+func twoInts(op *Operator, args []*Value) (*big.Int, *big.Int, uint64, error) {
+	a, sa, err := intArg(op, args[0])
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	b, sb, err := intArg(op, args[1])
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return a, b, op.Cost.Base + uint64(sa+sb)*op.Cost.PerByte, nil
+}
+
+func opDiv(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	a, b, cost, err := twoInts(op, args)
+	if err != nil {
+		return nil, 0, err
+	}
+	if b.Sign() == 0 {
+		return nil, 0, evalError(List(args...), "div with 0")
+	}
+	q, _ := floorDivMod(a, b)
+	return mallocCost(cost, Int(q))
+}
+
+func opMod(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	a, b, cost, err := twoInts(op, args)
+	if err != nil {
+		return nil, 0, err
+	}
+	if b.Sign() == 0 {
+		return nil, 0, evalError(List(args...), "mod with 0")
+	}
+	_, m := floorDivMod(a, b)
+	return mallocCost(cost, Int(m))
+}
+
+func opDivmod(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	a, b, cost, err := twoInts(op, args)
+	if err != nil {
+		return nil, 0, err
+	}
+	if b.Sign() == 0 {
+		return nil, 0, evalError(List(args...), "divmod with 0")
+	}
+	q, m := floorDivMod(a, b)
+	qv, mv := Int(q), Int(m)
+	cost += uint64(len(qv.Atom)+len(mv.Atom)) * mallocCostPerByte
+	return Cons(qv, mv), cost, nil
+}
+
+func opGr(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	a, b, cost, err := twoInts(op, args)
+	if err != nil {
+		return nil, 0, err
+	}
+	return Bool(a.Cmp(b) > 0), cost, nil
+}
+
+const maxShift = 65535
+
+func shift(op *Operator, args []*Value, value *big.Int, size int) (*Value, uint64, error) {
+	n, err := smallIntArg(op, args[1])
+	if err != nil {
+		return nil, 0, err
+	}
+	if n > maxShift || n < -maxShift {
+		return nil, 0, evalError(args[1], "shift too large")
+	}
+	res := new(big.Int)
+	if n >= 0 {
+		res.Lsh(value, uint(n))
+	} else {
+		res.Rsh(value, uint(-n))
+	}
+	v := Int(res)
+	return mallocCost(op.Cost.Base+uint64(size+len(v.Atom))*op.Cost.PerByte, v)
+}
+
+func opAsh(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	v, size, err := intArg(op, args[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	return shift(op, args, v, size)
+}
+
+func opLsh(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	b, err := atomArg(op, args[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	return shift(op, args, new(big.Int).SetBytes(b), len(b))
+}
+
+func opNot(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	return Bool(args[0].IsNil()), op.Cost.Base, nil
+}
+
+func opAny(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	res := false
+	for _, a := range args {
+		res = res || !a.IsNil()
+	}
+	return Bool(res), op.Cost.Base + uint64(len(args))*op.Cost.PerArg, nil
+}
+
+func opAll(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	res := true
+	for _, a := range args {
+		res = res && !a.IsNil()
+	}
+	return Bool(res), op.Cost.Base + uint64(len(args))*op.Cost.PerArg, nil
+}
+
+// opSoftfork charges the declared cost, extension 0 runs the program with the current operators
+// and fails if it costs more than declared, unknown extensions succeed
+func opSoftfork(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	cost, _, err := intArg(op, args[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	if cost.Sign() < 1 {
+		return nil, 0, evalError(args[0], "cost must be > 0")
+	}
+	if !cost.IsUint64() {
+		return nil, 0, evalError(args[0], "cost exceeded")
+	}
+	if len(args) >= 4 {
+		ext, _, err := intArg(op, args[1])
+		if err != nil {
+			return nil, 0, err
+		}
+		if ext.Sign() == 0 {
+			sub := &runner{maxCost: cost.Uint64()}
+			if _, err := sub.eval(args[2], args[3]); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+	return Nil, cost.Uint64(), nil
+}
+
+func opCoinID(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	parent, err := atomArg(op, args[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(parent) != 32 {
+		return nil, 0, evalError(args[0], "coinid: invalid parent coin id (must be 32 bytes)")
+	}
+	puzzleHash, err := atomArg(op, args[1])
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(puzzleHash) != 32 {
+		return nil, 0, evalError(args[1], "coinid: invalid puzzle hash (must be 32 bytes)")
+	}
+	amount, err := atomArg(op, args[2])
+	if err != nil {
+		return nil, 0, err
+	}
+	if !isCanonicalInt(amount) || IntFromBytes(amount).Sign() < 0 {
+		return nil, 0, evalError(args[2], "coinid: invalid amount (must be a canonical positive integer)")
+	}
+	if len(amount) > 9 || (len(amount) == 9 && amount[0] != 0) {
+		return nil, 0, evalError(args[2], "coinid: invalid amount (may not exceed max coin amount)")
+	}
+	h := sha256.New()
+	h.Write(parent)
+	h.Write(puzzleHash)
+	h.Write(amount)
+	return mallocCost(op.Cost.Base, Atom(h.Sum(nil)))
+}
+
+// modpow cost terms quadratic in the exponent and modulus sizes
+const (
+	modpowCostPerExponentByte = 3
+	modpowCostPerModulusByte  = 21
+)
+
+func opModpow(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	base, baseSize, err := intArg(op, args[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	exp, expSize, err := intArg(op, args[1])
+	if err != nil {
+		return nil, 0, err
+	}
+	mod, modSize, err := intArg(op, args[2])
+	if err != nil {
+		return nil, 0, err
+	}
+	cost := op.Cost.Base + uint64(baseSize)*op.Cost.PerByte
+	cost += uint64(expSize*expSize) * modpowCostPerExponentByte
+	cost += uint64(modSize*modSize) * modpowCostPerModulusByte
+	if exp.Sign() < 0 {
+		return nil, 0, evalError(args[1], "modpow with negative exponent")
+	}
+	if mod.Sign() == 0 {
+		return nil, 0, evalError(args[2], "modpow with 0 modulus")
+	}
+	res := new(big.Int).Exp(base, exp, new(big.Int).Abs(mod))
+	if res.Sign() != 0 && mod.Sign() < 0 {
+		res.Add(res, mod)
+	}
+	return mallocCost(cost, Int(res))
+}
+
+// opUnknown runs an unknown operator outside of strict mode: a no-op returning nil whose cost is computed from
+// the opcode. The two high bits of its last byte select a cost like that of +, * or concat or a constant cost
+// of 1, which is multiplied by 1 + the integer made of the other bytes. Opcodes starting with 0xffff are reserved.
+func opUnknown(opcode []byte, args *Value) (*Value, uint64, error) {
+	if len(opcode) == 0 || (len(opcode) >= 2 && opcode[0] == 0xff && opcode[1] == 0xff) {
+		return nil, 0, evalError(Atom(opcode), "reserved operator")
+	}
+	if len(opcode) > 5 {
+		return nil, 0, evalError(Atom(opcode), "invalid operator")
+	}
+	multiplier := uint64(1)
+	if len(opcode) > 1 {
+		multiplier += IntFromBytes(append([]byte{0}, opcode[:len(opcode)-1]...)).Uint64()
+	}
+
+	costFunction := opcode[len(opcode)-1] >> 6
+	items, _ := args.ListItems()
+	sizes := make([]uint64, len(items))
+	for i, a := range items {
+		if a.IsPair() && costFunction != 0 {
+			return nil, 0, evalError(a, "unknown op on list")
+		}
+		sizes[i] = uint64(len(a.Atom))
+	}
+	cost := uint64(1)
+	switch costFunction {
+	case 1:
+		c := OperatorsByName["+"].Cost
+		cost = c.Base
+		for _, size := range sizes {
+			cost += c.PerArg + size*c.PerByte
+		}
+	case 2:
+		c := OperatorsByName["*"].Cost
+		cost = c.Base
+		// the size of the product so far is approximated by the sum of the sizes
+		acc := uint64(0)
+		for i, size := range sizes {
+			if i > 0 {
+				cost += c.PerArg + (acc+size)*c.PerByte + acc*size/mulSquareCostDivider
+			}
+			acc += size
+		}
+	case 3:
+		c := OperatorsByName["concat"].Cost
+		cost = c.Base
+		for _, size := range sizes {
+			cost += c.PerArg + size*c.PerByte
+		}
+	}
+	cost *= multiplier
+	if cost > math.MaxUint32 {
+		return nil, 0, evalError(Atom(opcode), "invalid operator")
+	}
+	return Nil, cost, nil
+}
@@ -0,0 +1,240 @@
+package clvm
+
+import (
+	"bytes"
+	"fmt"
+)
+
+const (
+	mallocCostPerByte         = 10
+	pathLookupBaseCost        = 40
+	pathLookupCostPerLeg      = 4
+	pathLookupCostPerZeroByte = 4
+)
+
+// EvalError is returned when a program fails, Value is the offending value or the arguments given to x
+type EvalError struct {
+	Message string
+	Value   *Value
+}
+
+func (e *EvalError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Message, e.Value)
+}
+
+func evalError(v *Value, format string, args ...interface{}) error {
+	return &EvalError{Message: fmt.Sprintf(format, args...), Value: v}
+}
+
+// Tracer is called before each evaluation step with the evaluated program, its environment and the nesting
+// depth of the evaluation, returning an error aborts the run
+type Tracer func(program, env *Value, depth int) error
+
+type runner struct {
+	cost    uint64
+	maxCost uint64
+	tracer  Tracer
+	depth   int
+	strict  bool
+}
+
+func (r *runner) charge(c uint64, v *Value) error {
+	r.cost += c
+	if r.maxCost != 0 && r.cost > r.maxCost {
+		return evalError(v, "cost exceeded")
+	}
+	return nil
+}
+
+// RunFlags change the rules of a run
+type RunFlags uint
+
+const (
+	// StrictMode fails on unknown operators as the mempool does. Without it the run follows the consensus rules
+	// for blocks, unknown operators are no-ops returning nil with a cost computed from their opcode.
+	StrictMode RunFlags = 1 << iota
+)
+
+// Run evaluates program with env as its environment and returns the result and the cost of the evaluation,
+// maxCost is the maximum cost allowed, 0 means unlimited. The run is in strict mode.
+func Run(program, env *Value, maxCost uint64) (*Value, uint64, error) {
+	return RunWithFlags(program, env, maxCost, StrictMode)
+}
+
+// RunWithFlags is Run following the rules selected by flags
+func RunWithFlags(program, env *Value, maxCost uint64, flags RunFlags) (*Value, uint64, error) {
+	r := &runner{maxCost: maxCost, strict: flags&StrictMode != 0}
+	v, err := r.eval(program, env)
+	return v, r.cost, err
+}
+
+// RunTraced is Run calling tracer before each evaluation step
+func RunTraced(program, env *Value, maxCost uint64, tracer Tracer) (*Value, uint64, error) {
+	r := &runner{maxCost: maxCost, tracer: tracer, strict: true}
+	v, err := r.eval(program, env)
+	return v, r.cost, err
+}
+
+// TraversePath returns the value at path in env like a program made of the path atom would
+func TraversePath(path []byte, env *Value) (*Value, error) {
+	return (&runner{}).traversePath(path, env)
+}
+
+// traversePath follows the path encoded in the atom bits from the least significant one,
+// 0 means first and 1 means rest, the most significant set bit marks the end of the path
+func (r *runner) traversePath(path []byte, env *Value) (*Value, error) {
+	cost := uint64(pathLookupBaseCost + pathLookupCostPerLeg)
+	if len(path) == 0 {
+		return Nil, r.charge(cost, env)
+	}
+	end := 0
+	for end < len(path) && path[end] == 0 {
+		end++
+	}
+	cost += uint64(end) * pathLookupCostPerZeroByte
+	if end == len(path) {
+		return Nil, r.charge(cost, env)
+	}
+	endMask := byte(0x80)
+	for endMask&path[end] == 0 {
+		endMask >>= 1
+	}
+	cursor := len(path) - 1
+	mask := byte(0x01)
+	for cursor > end || mask < endMask {
+		if !env.IsPair() {
+			return nil, evalError(env, "path into atom")
+		}
+		if path[cursor]&mask != 0 {
+			env = env.Rest
+		} else {
+			env = env.First
+		}
+		cost += pathLookupCostPerLeg
+		mask <<= 1
+		if mask == 0 {
+			cursor--
+			mask = 0x01
+		}
+	}
+	return env, r.charge(cost, env)
+}
+
+var (
+	quoteAtom = []byte{0x01}
+	applyAtom = []byte{0x02}
+)
+
+func (r *runner) eval(program, env *Value) (*Value, error) {
+	if r.tracer != nil {
+		if err := r.tracer(program, env, r.depth); err != nil {
+			return nil, err
+		}
+		r.depth++
+		defer func() { r.depth-- }()
+	}
+
+	if !program.IsPair() {
+		return r.traversePath(program.Atom, env)
+	}
+
+	operator, operands := program.First, program.Rest
+	if operator.IsPair() {
+		// ((X) . args) applies the operator X to the unevaluated args
+		if operator.First.IsPair() || !operator.Rest.IsNil() {
+			return nil, evalError(program, "in ((X)...) syntax X must be lone atom")
+		}
+		return r.applyOperator(operator.First.Atom, operands, program)
+	}
+
+	if bytes.Equal(operator.Atom, quoteAtom) {
+		return operands, r.charge(OperatorsByName["q"].Cost.Base, program)
+	}
+
+	args := []*Value(nil)
+	for o := operands; !o.IsNil(); o = o.Rest {
+		if !o.IsPair() {
+			return nil, evalError(program, "bad operand list")
+		}
+		v, err := r.eval(o.First, env)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+	return r.applyOperator(operator.Atom, List(args...), program)
+}
+
+func (r *runner) applyOperator(opcode []byte, args *Value, program *Value) (*Value, error) {
+	if bytes.Equal(opcode, applyAtom) {
+		items, ok := args.ListItems()
+		if !ok || len(items) != 2 {
+			return nil, evalError(args, "apply requires exactly 2 parameters")
+		}
+		if err := r.charge(OperatorsByName["a"].Cost.Base, program); err != nil {
+			return nil, err
+		}
+		return r.eval(items[0], items[1])
+	}
+
+	op, ok := operatorForAtom(opcode)
+	var f operatorFunc
+	if ok {
+		f = operatorFuncs[op.Opcode]
+	}
+	if f == nil {
+		if r.strict {
+			return nil, evalError(Atom(opcode), "unimplemented operator")
+		}
+		v, cost, err := opUnknown(opcode, args)
+		if err != nil {
+			return nil, err
+		}
+		return v, r.charge(cost, program)
+	}
+	items, ok := args.ListItems()
+	if !ok {
+		return nil, evalError(args, "%s takes a list of arguments", op.Name)
+	}
+	if len(items) < op.MinArgs || (op.MaxArgs != -1 && len(items) > op.MaxArgs) {
+		return nil, evalError(args, "%s takes %s", op.Name, arityDescription(op.MinArgs, op.MaxArgs))
+	}
+	v, cost, err := f(r, op, items)
+	if err != nil {
+		return nil, err
+	}
+	return v, r.charge(cost, program)
+}
+
+func operatorForAtom(b []byte) (*Operator, bool) {
+	if len(b) == 0 || len(b) > 4 || b[0] == 0 {
+		return nil, false
+	}
+	opcode := uint32(0)
+	for _, c := range b {
+		opcode = opcode<<8 | uint32(c)
+	}
+	op, ok := OperatorsByOpcode[opcode]
+	return op, ok
+}
+
+func arityDescription(min, max int) string {
+	plural := func(n int) string {
+		if n == 1 {
+			return "1 argument"
+		}
+		return fmt.Sprintf("%d arguments", n)
+	}
+	switch {
+	case min == max:
+		return "exactly " + plural(min)
+	case max == -1:
+		return "at least " + plural(min)
+	}
+	return fmt.Sprintf("%d to %d arguments", min, max)
+}
+
+// mallocCost returns the cost of allocating the atoms of a result
+func mallocCost(cost uint64, v *Value) (*Value, uint64, error) {
+	return v, cost + uint64(len(v.Atom))*mallocCostPerByte, nil
+}
@@ -0,0 +1,259 @@
+package clvm
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	tcs := []struct {
+		name    string
+		program string
+		env     string
+		result  string
+	}{
+		{"path", "5", "(1 2 3)", "2"},
+		{"quote", "(q . (1 2))", "()", "(q 2)"},
+		{"arithmetic", "(+ (q . 2) (* (q . 3) 2) (- (q . 1)))", "(7)", "24"},
+		{"floor division", "(c (/ (q . -7) (q . 2)) (divmod (q . -7) (q . 2)))", "()", "(-4 -4 . 1)"},
+		{"mod", "(% (q . -7) (q . 2))", "()", "1"},
+		{"shifts", "(c (ash (q . -1) (q . 3)) (c (ash (q . -8) (q . -1)) (lsh (q . -1) (q . 1))))", "()", "(-8 -4 . 510)"},
+		{"bitwise", "(c (logand (q . 12) (q . 10)) (c (logior (q . 12) (q . 10)) (c (logxor (q . 12) (q . 10)) (lognot (q . 0)))))", "()", "(8 14 6 . -1)"},
+		{"strings", `(c (concat (q . "foo") (q . "bar")) (c (substr (q . "foobar") (q . 1) (q . 3)) (strlen (q . "foobar"))))`, "()", `("foobar" "oo" . 6)`},
+		{"comparisons", "(c (= (q . 1) (q . 1)) (c (> (q . -1) (q . 1)) (>s (q . -1) (q . 1))))", "()", "(1 () . 1)"},
+		{"booleans", "(c (not ()) (c (any () (q . 2)) (all 2 ())))", "(1)", "(1 1)"},
+		{"if", "(a (i 2 (q . (q . yes)) (q . (q . no))) 1)", "(())", `"no"`},
+		{"sha256", `(sha256 (q . "hello"))`, "()", "0x2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{"keccak256", `(keccak256 (q . "hello"))`, "()", "0x1c8aff950685c2ed4bc3174f3472287b56d9517b9c948127319a09a7a36deac8"},
+		{"modpow", "(modpow (q . 2) (q . 10) (q . 1000))", "()", "24"},
+		{"coinid", "(coinid (q . 0x0000000000000000000000000000000000000000000000000000000000000000) (q . 0x0000000000000000000000000000000000000000000000000000000000000000) (q . 1))", "()", "0x2ccc1ceb1041efbf582b4decc50878234c2d2adb7829ffa23c92ed64105c8a38"},
+		{"pubkey_for_exp", "(pubkey_for_exp (q . 1))", "()", "0x97f1d3a73197d7942695638c4fa9ac0fc3688c4f9774b905a14e3a3f171bac586c55e83ff97a1aeffb3af00adb22c6bb"},
+		{"point_add identity", "(point_add)", "()", "0xc00000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000"},
+		{"point_add", "(= (point_add (pubkey_for_exp (q . 1)) (pubkey_for_exp (q . 2))) (pubkey_for_exp (q . 3)))", "()", "1"},
+		{"g1 arithmetic", "(= (g1_subtract (g1_multiply (pubkey_for_exp (q . 1)) (q . 5)) (pubkey_for_exp (q . 2))) (g1_negate (pubkey_for_exp (q . -3))))", "()", "1"},
+		{"bls_verify", "(bls_verify (g2_map (concat 2 5)) 2 5)", `(0x97f1d3a73197d7942695638c4fa9ac0fc3688c4f9774b905a14e3a3f171bac586c55e83ff97a1aeffb3af00adb22c6bb "message")`, "()"},
+		{"softfork", "(softfork (q . 1000) (q . 0) (q . (+ 2 5)) (q . (1 2)))", "()", "()"},
+
+		// the body of calculate_synthetic_public_key checked against its expected key, the generator times 1 + the hash
+		{"calculate_synthetic_public_key", "(= (point_add 2 (pubkey_for_exp (sha256 2 5))) (pubkey_for_exp (+ (q . 1) (sha256 2 5))))",
+			"(0x97f1d3a73197d7942695638c4fa9ac0fc3688c4f9774b905a14e3a3f171bac586c55e83ff97a1aeffb3af00adb22c6bb 0xcafef00d)", "1"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			program, err := Assemble(tc.program)
+			require.NoError(t, err)
+			env, err := Assemble(tc.env)
+			require.NoError(t, err)
+			res, _, err := Run(program, env, 0)
+			require.NoError(t, err)
+			// compare disassemblies, the expected result may be written with numbers in operator position
+			expected, err := Assemble(tc.result)
+			require.NoError(t, err)
+			require.Equal(t, expected.String(), res.String())
+		})
+	}
+}
+
+// serialized example puzzles as output by the reference compiler, see TestCompileReferenceOutput in pkg/clls
+const (
+	sha256treeModuleHex     = "ff02ffff01ff02ff02ffff04ff02ffff04ff05ff80808080ffff04ffff01ff02ffff03ffff07ff0580ffff01ff0bffff0102ffff02ff02ffff04ff02ffff04ff09ff80808080ffff02ff02ffff04ff02ffff04ff0dff8080808080ffff01ff0bffff0101ff058080ff0180ff018080"
+	p2DelegatedOrHiddenHex  = "ff02ffff01ff02ffff03ff0bffff01ff02ffff03ffff09ff05ffff1dff0bffff1effff0bff0bffff02ff06ffff04ff02ffff04ff17ff8080808080808080ffff01ff02ff17ff2f80ffff01ff088080ff0180ffff01ff04ffff04ff04ffff04ff05ffff04ffff02ff06ffff04ff02ffff04ff17ff80808080ff80808080ffff02ff17ff2f808080ff0180ffff04ffff01ff32ff02ffff03ffff07ff0580ffff01ff0bffff0102ffff02ff06ffff04ff02ffff04ff09ff80808080ffff02ff06ffff04ff02ffff04ff0dff8080808080ffff01ff0bffff0101ff058080ff0180ff018080"
+	p2DelegatedOrHiddenHash = "0xe9aaa49f45bad5c889b86ee3341550c155cfdd10c3a6757de618d20612fffd52"
+	delegatedConditionsHash = "0xcae6aceb818b41b9c5c2bafc6321c29435d0737082d2d67df3d619ba4a61cba6" // tree hash of (q (51 0xcafef00d 100))
+	testPublicKey           = "0x97f1d3a73197d7942695638c4fa9ac0fc3688c4f9774b905a14e3a3f171bac586c55e83ff97a1aeffb3af00adb22c6bb"
+)
+
+// runs of example puzzles with the solutions they are spent with, the costs are worked out by hand from the
+// cost table of the consensus interpreter, 0 leaves the cost unchecked
+func TestRunExamples(t *testing.T) {
+	tcs := []struct {
+		name     string
+		program  string // serialized or assembled
+		solution string // serialized or assembled
+		result   string
+		cost     uint64
+	}{
+		// q 20, path 2 48 and c 50
+		{"p2_conditions", "(c (q . 1) 2)", "(((51 0xcafef00d 100)))", "(q (51 0xcafef00d 100))", 118},
+		// the tree hash of an atom, sha256 of 1 and the atom
+		{"sha256tree_module atom", sha256treeModuleHex, "(5)", "0xbc5959f43bc6e47175374b6716e53c9a7d72c59424c821336995bad760d9aeb3", 1635},
+		// the puzzle hash of p2_delegated_puzzle_or_hidden_puzzle
+		{"sha256tree_module puzzle", sha256treeModuleHex, "ff" + p2DelegatedOrHiddenHex + "80", p2DelegatedOrHiddenHash, 0},
+		// spent with a delegated puzzle: the signature condition comes before the delegated conditions
+		{"p2_delegated_puzzle_or_hidden_puzzle", p2DelegatedOrHiddenHex, "(" + testPublicKey + " () (q (51 0xcafef00d 100)) ())",
+			"((50 " + testPublicKey + " " + delegatedConditionsHash + ") (51 0xcafef00d 100))", 0},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			program, err := readValue(tc.program)
+			require.NoError(t, err)
+			solution, err := readValue(tc.solution)
+			require.NoError(t, err)
+			res, cost, err := Run(program, solution, 0)
+			require.NoError(t, err)
+			expected, err := Assemble(tc.result)
+			require.NoError(t, err)
+			require.Equal(t, expected.String(), res.String())
+			if tc.cost != 0 {
+				require.Equal(t, tc.cost, cost)
+			}
+		})
+	}
+}
+
+// readValue deserializes hex or assembles the text otherwise
+func readValue(s string) (*Value, error) {
+	if v, err := FromHex(s); err == nil {
+		return v, nil
+	}
+	return Assemble(s)
+}
+
+func TestRunErrors(t *testing.T) {
+	tcs := []struct {
+		name    string
+		program string
+		maxCost uint64
+		message string
+	}{
+		{"raise", `(x (q . "boom"))`, 0, `clvm raise: "boom"`},
+		{"raise list", "(x (q . 1) (q . 2))", 0, "clvm raise: (q 2)"},
+		{"first of atom", "(f (q . 1))", 0, "first of non-cons: 1"},
+		{"path into atom", "(f 5)", 0, "path into atom: ()"},
+		{"unknown operator", "(0x7f)", 0, "unimplemented operator: 127"},
+		{"arity", "(c (q . 1))", 0, "c takes exactly 2 arguments: (q)"},
+		{"division by zero", "(/ (q . 1) (q . 0))", 0, "div with 0: (q ())"},
+		{"cost", "(+ (q . 1) (q . 2))", 100, "cost exceeded: (+ (q . 1) (q . 2))"},
+		{"bls_verify", "(bls_verify (g2_map (q . 1)) (pubkey_for_exp (q . 1)) (q . 1))", 0, ""},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			program, err := Assemble(tc.program)
+			require.NoError(t, err)
+			_, _, err = Run(program, Nil, tc.maxCost)
+			require.Error(t, err)
+			require.IsType(t, &EvalError{}, err)
+			if tc.message != "" {
+				require.Equal(t, tc.message, err.Error())
+			}
+		})
+	}
+}
+
+func TestRunCost(t *testing.T) {
+	program, err := Assemble("(+ (q . 2) (q . 3))")
+	require.NoError(t, err)
+	_, cost, err := Run(program, Nil, 0)
+	require.NoError(t, err)
+	// two quotes, + with two one-byte arguments and a one-byte result
+	require.Equal(t, uint64(2*20+99+2*320+2*3+10), cost)
+}
+
+func TestRunUnknownOperators(t *testing.T) {
+	tcs := []struct {
+		name    string
+		program string
+		cost    uint64
+		message string
+	}{
+		{"constant", "(0x3f (q . (1 2)))", 20 + 1, ""},
+		{"multiplied constant", "(0x00023f)", 3, ""},
+		{"like +", "(0x7f (q . 1) (q . 0x0102))", 2*20 + 99 + 2*320 + 3*3, ""},
+		{"like *", "(0x01bf (q . 1) (q . 2) (q . 3))", 3*20 + 2*(92+885+2*6+885+3*6), ""},
+		{"like concat", `(0xff (q . "ab"))`, 20 + 142 + 135 + 2*3, ""},
+		{"list argument", "(0xff (q . (1 2)))", 0, "unknown op on list: (q 2)"},
+		{"reserved", "(0xffff3f)", 0, "reserved operator: 0xffff3f"},
+		{"large multiplier", "(0x010000003f)", 0x01000001, ""},
+		{"invalid", "(0x01000000003f)", 0, "invalid operator: 0x01000000003f"},
+		{"cost overflow", "(0xfe0000007f)", 0, "invalid operator: 0xfe0000007f"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			program, err := Assemble(tc.program)
+			require.NoError(t, err)
+			_, _, err = Run(program, Nil, 0)
+			require.EqualError(t, err, "unimplemented operator: "+program.First.String(), "strict mode")
+
+			res, cost, err := RunWithFlags(program, Nil, 0, 0)
+			if tc.message != "" {
+				require.EqualError(t, err, tc.message)
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, res.IsNil())
+			require.Equal(t, tc.cost, cost)
+		})
+	}
+}
+
+func TestIntBytes(t *testing.T) {
+	for _, i := range []int64{0, 1, -1, 127, 128, -128, -129, 255, 256, -256, 1 << 40, -(1 << 40)} {
+		b := IntBytes(Int64(i).AsInt())
+		require.Equal(t, i, IntFromBytes(b).Int64())
+		require.True(t, isCanonicalInt(b))
+	}
+	require.Equal(t, []byte{0x00, 0x80}, IntBytes(Int64(128).AsInt()))
+	require.Equal(t, []byte{0xff, 0x7f}, IntBytes(Int64(-129).AsInt()))
+}
+
+func TestSecpVerify(t *testing.T) {
+	msg := make([]byte, 32)
+	msg[31] = 42
+
+	// secp256k1 signature with the private key 2 and the nonce 3
+	d, k := big.NewInt(2), big.NewInt(3)
+	g := &k1Point{secp256k1Gx, secp256k1Gy}
+	pub := k1Mul(g, d)
+	r := new(big.Int).Mod(k1Mul(g, k).x, secp256k1N)
+	s := new(big.Int).Mul(r, d)
+	s.Add(s, new(big.Int).SetBytes(msg))
+	s.Mul(s, new(big.Int).ModInverse(k, secp256k1N))
+	s.Mod(s, secp256k1N)
+	k1Pub := append([]byte{byte(2 + pub.y.Bit(0))}, pub.x.FillBytes(make([]byte, 32))...)
+	k1Sig := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	r1R, r1S, err := ecdsa.Sign(rand.Reader, key, msg)
+	require.NoError(t, err)
+	r1Pub := elliptic.MarshalCompressed(elliptic.P256(), key.X, key.Y)
+	r1Sig := append(r1R.FillBytes(make([]byte, 32)), r1S.FillBytes(make([]byte, 32))...)
+
+	for _, tc := range []struct {
+		op       string
+		pub, sig []byte
+	}{{"secp256k1_verify", k1Pub, k1Sig}, {"secp256r1_verify", r1Pub, r1Sig}} {
+		program := List(Atom(OperatorsByName[tc.op].OpcodeBytes()), Cons(True, Atom(tc.pub)), Cons(True, Atom(msg)), Cons(True, Atom(tc.sig)))
+		_, _, err := Run(program, Nil, 0)
+		require.NoError(t, err, tc.op)
+
+		msg[0] = 1
+		_, _, err = Run(program, Nil, 0)
+		require.Error(t, err, tc.op)
+		msg[0] = 0
+	}
+}
+
+func TestRunTraced(t *testing.T) {
+	program, err := Assemble("(+ (q . 2) 2)")
+	require.NoError(t, err)
+	steps := []string(nil)
+	res, _, err := RunTraced(program, List(Int64(3)), 0, func(program, env *Value, depth int) error {
+		steps = append(steps, fmt.Sprintf("%d %s", depth, program))
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "5", res.String())
+	require.Equal(t, []string{"0 (+ (q . 2) 2)", "1 (q . 2)", "1 2"}, steps)
+
+	abort := errors.New("abort")
+	_, _, err = RunTraced(program, List(Int64(3)), 0, func(*Value, *Value, int) error { return abort })
+	require.Equal(t, abort, err)
+}
@@ -0,0 +1,159 @@
+package clvm
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"math/big"
+)
+
+// secp256k1 parameters, the curve is y² = x³ + 7, crypto/elliptic only supports a = -3 curves
+var (
+	secp256k1P  = hexInt("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f")
+	secp256k1N  = hexInt("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141")
+	secp256k1Gx = hexInt("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+	secp256k1Gy = hexInt("483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8")
+)
+
+func hexInt(s string) *big.Int {
+	i, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("invalid hex constant " + s)
+	}
+	return i
+}
+
+// k1Point is an affine point on secp256k1, nil is the point at infinity
+type k1Point struct {
+	x, y *big.Int
+}
+
+func k1Add(a, b *k1Point) *k1Point {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	p := secp256k1P
+	lambda := new(big.Int)
+	if a.x.Cmp(b.x) == 0 {
+		if a.y.Cmp(b.y) != 0 || a.y.Sign() == 0 {
+			return nil
+		}
+		// tangent: 3x² / 2y
+		lambda.Mul(a.x, a.x)
+		lambda.Mul(lambda, big.NewInt(3))
+		lambda.Mul(lambda, new(big.Int).ModInverse(new(big.Int).Lsh(a.y, 1), p))
+	} else {
+		lambda.Sub(b.y, a.y)
+		lambda.Mul(lambda, new(big.Int).ModInverse(new(big.Int).Mod(new(big.Int).Sub(b.x, a.x), p), p))
+	}
+	lambda.Mod(lambda, p)
+	x := new(big.Int).Mul(lambda, lambda)
+	x.Sub(x, a.x)
+	x.Sub(x, b.x)
+	x.Mod(x, p)
+	y := new(big.Int).Sub(a.x, x)
+	y.Mul(y, lambda)
+	y.Sub(y, a.y)
+	y.Mod(y, p)
+	return &k1Point{x, y}
+}
+
+func k1Mul(pt *k1Point, k *big.Int) *k1Point {
+	res := (*k1Point)(nil)
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		res = k1Add(res, res)
+		if k.Bit(i) == 1 {
+			res = k1Add(res, pt)
+		}
+	}
+	return res
+}
+
+func k1Decompress(b []byte) (*k1Point, bool) {
+	if len(b) != 33 || (b[0] != 2 && b[0] != 3) {
+		return nil, false
+	}
+	p := secp256k1P
+	x := new(big.Int).SetBytes(b[1:])
+	if x.Cmp(p) >= 0 {
+		return nil, false
+	}
+	y2 := new(big.Int).Exp(x, big.NewInt(3), p)
+	y2.Add(y2, big.NewInt(7))
+	y2.Mod(y2, p)
+	y := new(big.Int).ModSqrt(y2, p)
+	if y == nil {
+		return nil, false
+	}
+	if y.Bit(0) != uint(b[0]&1) {
+		y.Sub(p, y)
+	}
+	return &k1Point{x, y}, true
+}
+
+// secpArgs validates the public key, message hash and signature atoms of the secp operators
+func secpArgs(op *Operator, args []*Value) (pubkey, msg []byte, r, s *big.Int, err error) {
+	if pubkey, err = atomArg(op, args[0]); err != nil {
+		return
+	}
+	if len(pubkey) != 33 {
+		return nil, nil, nil, nil, evalError(args[0], "%s: pubkey is not valid", op.Name)
+	}
+	if msg, err = atomArg(op, args[1]); err != nil {
+		return
+	}
+	if len(msg) != 32 {
+		return nil, nil, nil, nil, evalError(args[1], "%s: message digest is not 32 bytes", op.Name)
+	}
+	sig, err := atomArg(op, args[2])
+	if err != nil {
+		return
+	}
+	if len(sig) != 64 {
+		return nil, nil, nil, nil, evalError(args[2], "%s: signature is not valid", op.Name)
+	}
+	return pubkey, msg, new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:]), nil
+}
+
+func opSecp256k1Verify(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	pubkey, msg, sr, ss, err := secpArgs(op, args)
+	if err != nil {
+		return nil, 0, err
+	}
+	q, ok := k1Decompress(pubkey)
+	if !ok {
+		return nil, 0, evalError(args[0], "%s: pubkey is not valid", op.Name)
+	}
+	n := secp256k1N
+	if sr.Sign() == 0 || sr.Cmp(n) >= 0 || ss.Sign() == 0 || ss.Cmp(n) >= 0 {
+		return nil, 0, evalError(args[2], "%s: signature is not valid", op.Name)
+	}
+	w := new(big.Int).ModInverse(ss, n)
+	u1 := new(big.Int).Mul(new(big.Int).SetBytes(msg), w)
+	u1.Mod(u1, n)
+	u2 := new(big.Int).Mul(sr, w)
+	u2.Mod(u2, n)
+	pt := k1Add(k1Mul(&k1Point{secp256k1Gx, secp256k1Gy}, u1), k1Mul(q, u2))
+	if pt == nil || new(big.Int).Mod(pt.x, n).Cmp(sr) != 0 {
+		return nil, 0, evalError(List(args...), "%s failed", op.Name)
+	}
+	return Nil, op.Cost.Base, nil
+}
+
+func opSecp256r1Verify(r *runner, op *Operator, args []*Value) (*Value, uint64, error) {
+	pubkey, msg, sr, ss, err := secpArgs(op, args)
+	if err != nil {
+		return nil, 0, err
+	}
+	curve := elliptic.P256()
+	x, y := elliptic.UnmarshalCompressed(curve, pubkey)
+	if x == nil {
+		return nil, 0, evalError(args[0], "%s: pubkey is not valid", op.Name)
+	}
+	if !ecdsa.Verify(&ecdsa.PublicKey{Curve: curve, X: x, Y: y}, msg, sr, ss) {
+		return nil, 0, evalError(List(args...), "%s failed", op.Name)
+	}
+	return Nil, op.Cost.Base, nil
+}
@@ -0,0 +1,332 @@
+package clvm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	nilMarker       = 0x80
+	backrefMarker   = 0xfe
+	consMarker      = 0xff
+	maxSingleByte   = 0x7f
+	maxAtomSize     = 0x400000000
+	maxBackrefNodes = 100000 // nodes visited when looking for a backreference
+)
+
+// atomPrefix returns the size prefix of an atom, single bytes below 0x80 are their own encoding
+func atomPrefix(b []byte) ([]byte, error) {
+	size := len(b)
+	switch {
+	case size == 0:
+		return []byte{nilMarker}, nil
+	case size == 1 && b[0] <= maxSingleByte:
+		return nil, nil
+	case size < 0x40:
+		return []byte{0x80 | byte(size)}, nil
+	case size < 0x2000:
+		return []byte{0xc0 | byte(size>>8), byte(size)}, nil
+	case size < 0x100000:
+		return []byte{0xe0 | byte(size>>16), byte(size >> 8), byte(size)}, nil
+	case size < 0x8000000:
+		return []byte{0xf0 | byte(size>>24), byte(size >> 16), byte(size >> 8), byte(size)}, nil
+	case uint64(size) < maxAtomSize:
+		return []byte{0xf8 | byte(uint64(size)>>32), byte(size >> 24), byte(size >> 16), byte(size >> 8), byte(size)}, nil
+	}
+	return nil, errors.New("atom too large")
+}
+
+func writeAtom(buf *bytes.Buffer, b []byte) error {
+	prefix, err := atomPrefix(b)
+	if err != nil {
+		return err
+	}
+	buf.Write(prefix)
+	if len(b) > 0 {
+		buf.Write(b)
+	}
+	return nil
+}
+
+func atomSize(b []byte) int {
+	prefix, _ := atomPrefix(b)
+	if len(b) == 0 {
+		return 1
+	}
+	return len(prefix) + len(b)
+}
+
+// Serialize encodes the value: 0xff followed by both sides for pairs, size-prefixed bytes for atoms
+func Serialize(v *Value) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	var write func(v *Value) error
+	write = func(v *Value) error {
+		for v.IsPair() {
+			buf.WriteByte(consMarker)
+			if err := write(v.First); err != nil {
+				return err
+			}
+			v = v.Rest
+		}
+		return writeAtom(buf, v.Atom)
+	}
+	if err := write(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// treeInfo holds the hash and serialized size of each node of a tree
+type treeInfo struct {
+	hashes map[*Value][32]byte
+	sizes  map[*Value]int
+	counts map[[32]byte]int
+}
+
+func newTreeInfo(v *Value) *treeInfo {
+	ti := &treeInfo{hashes: map[*Value][32]byte{}, sizes: map[*Value]int{}, counts: map[[32]byte]int{}}
+	ti.walk(v)
+	return ti
+}
+
+func (ti *treeInfo) walk(v *Value) [32]byte {
+	if h, ok := ti.hashes[v]; ok {
+		ti.counts[h]++
+		return h
+	}
+	var h [32]byte
+	if v.IsPair() {
+		first, rest := ti.walk(v.First), ti.walk(v.Rest)
+		h = hashPair(first, rest)
+		ti.sizes[v] = 1 + ti.sizes[v.First] + ti.sizes[v.Rest]
+	} else {
+		h = hashAtom(v.Atom)
+		ti.sizes[v] = atomSize(v.Atom)
+	}
+	ti.hashes[v] = h
+	ti.counts[h]++
+	return h
+}
+
+// compressor serializes a value replacing repeated subtrees by backreferences,
+// it mirrors the stack of values that the deserializer builds to compute their paths
+type compressor struct {
+	*treeInfo
+	buf   *bytes.Buffer
+	stack []*Value
+}
+
+type pathNode struct {
+	v     *Value
+	spine int // index from the top of the stack when v is nil
+	bits  *big.Int
+	depth uint
+}
+
+// findPath looks for the shortest path to a value with the given hash in the stack,
+// paths longer than maxDepth are not considered
+func (c *compressor) findPath(h [32]byte, maxDepth uint) (*big.Int, bool) {
+	if len(c.stack) == 0 {
+		return nil, false
+	}
+	queue := []pathNode{{spine: 0, bits: new(big.Int)}}
+	for visited := 0; len(queue) > 0 && visited < maxBackrefNodes; visited++ {
+		n := queue[0]
+		queue = queue[1:]
+		if n.v != nil && c.hashes[n.v] == h {
+			return new(big.Int).SetBit(n.bits, int(n.depth), 1), true
+		}
+		if n.depth >= maxDepth {
+			continue
+		}
+		var first, rest pathNode
+		switch {
+		case n.v == nil:
+			first = pathNode{v: c.stack[len(c.stack)-1-n.spine]}
+			if n.spine+1 < len(c.stack) {
+				rest = pathNode{spine: n.spine + 1}
+			}
+		case n.v.IsPair():
+			first = pathNode{v: n.v.First}
+			rest = pathNode{v: n.v.Rest}
+		default:
+			continue
+		}
+		first.bits, first.depth = n.bits, n.depth+1
+		queue = append(queue, first)
+		if rest.v != nil || rest.spine != 0 {
+			rest.bits, rest.depth = new(big.Int).SetBit(n.bits, int(n.depth), 1), n.depth+1
+			queue = append(queue, rest)
+		}
+	}
+	return nil, false
+}
+
+func (c *compressor) write(v *Value) error {
+	h := c.hashes[v]
+	// a backreference is 0xfe followed by the path atom, which needs at least one byte
+	if size := c.sizes[v]; c.counts[h] > 1 && size > 2 {
+		maxDepth := uint((size-3)*8 + 6)
+		if path, ok := c.findPath(h, maxDepth); ok {
+			if pathSize := atomSize(path.Bytes()); 1+pathSize < size {
+				c.buf.WriteByte(backrefMarker)
+				if err := writeAtom(c.buf, path.Bytes()); err != nil {
+					return err
+				}
+				c.stack = append(c.stack, v)
+				return nil
+			}
+		}
+	}
+	if v.IsPair() {
+		c.buf.WriteByte(consMarker)
+		if err := c.write(v.First); err != nil {
+			return err
+		}
+		if err := c.write(v.Rest); err != nil {
+			return err
+		}
+		c.stack = append(c.stack[:len(c.stack)-2], v)
+		return nil
+	}
+	c.stack = append(c.stack, v)
+	return writeAtom(c.buf, v.Atom)
+}
+
+// SerializeCompressed encodes the value like Serialize, repeated subtrees are replaced by
+// 0xfe followed by the path to an identical value already read by the deserializer
+func SerializeCompressed(v *Value) ([]byte, error) {
+	c := &compressor{treeInfo: newTreeInfo(v), buf: &bytes.Buffer{}}
+	if err := c.write(v); err != nil {
+		return nil, err
+	}
+	return c.buf.Bytes(), nil
+}
+
+type decoder struct {
+	b   []byte
+	pos int
+}
+
+func (d *decoder) readByte() (byte, error) {
+	if d.pos >= len(d.b) {
+		return 0, errors.New("unexpected end of input")
+	}
+	d.pos++
+	return d.b[d.pos-1], nil
+}
+
+func (d *decoder) readAtom(b byte) (*Value, error) {
+	if b == nilMarker {
+		return Atom([]byte{}), nil
+	}
+	if b <= maxSingleByte {
+		return Atom([]byte{b}), nil
+	}
+	bitCount := 0
+	for mask := byte(0x80); b&mask != 0; mask >>= 1 {
+		bitCount++
+		b &^= mask
+	}
+	size := uint64(b)
+	for i := 1; i < bitCount; i++ {
+		c, err := d.readByte()
+		if err != nil {
+			return nil, err
+		}
+		size = size<<8 | uint64(c)
+	}
+	if size >= maxAtomSize {
+		return nil, errors.New("atom too large")
+	}
+	if uint64(len(d.b)-d.pos) < size {
+		return nil, errors.New("unexpected end of input")
+	}
+	a := append([]byte{}, d.b[d.pos:d.pos+int(size)]...)
+	d.pos += int(size)
+	return Atom(a), nil
+}
+
+// stackPath follows a backreference path into the stack of values read so far, the top of the stack being first
+func stackPath(stack []*Value, path []byte) (*Value, error) {
+	// the stack is walked as a list, rebuilding it is simpler than special casing its spine
+	list := Nil
+	for _, v := range stack {
+		list = Cons(v, list)
+	}
+	return TraversePath(path, list)
+}
+
+// Deserialize decodes a serialized value, backreferences are supported
+func Deserialize(b []byte) (*Value, error) {
+	d := &decoder{b: b}
+	stack := []*Value(nil)
+	pending := []int{1} // values to read before each pending cons, innermost last
+	for len(pending) > 0 {
+		if pending[len(pending)-1] == 0 {
+			pending = pending[:len(pending)-1]
+			if len(pending) > 0 {
+				n := len(stack)
+				stack = append(stack[:n-2], Cons(stack[n-2], stack[n-1]))
+			}
+			continue
+		}
+		pending[len(pending)-1]--
+		c, err := d.readByte()
+		if err != nil {
+			return nil, err
+		}
+		switch c {
+		case consMarker:
+			pending = append(pending, 2)
+		case backrefMarker:
+			c, err := d.readByte()
+			if err != nil {
+				return nil, err
+			}
+			path, err := d.readAtom(c)
+			if err != nil {
+				return nil, errors.Wrap(err, "read backreference path")
+			}
+			v, err := stackPath(stack, path.Atom)
+			if err != nil {
+				return nil, errors.Wrap(err, "follow backreference")
+			}
+			stack = append(stack, v)
+		default:
+			v, err := d.readAtom(c)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, v)
+		}
+	}
+	if d.pos != len(d.b) {
+		return nil, errors.Errorf("%d unexpected bytes after the value", len(d.b)-d.pos)
+	}
+	return stack[0], nil
+}
+
+// FromHex deserializes an hex string, an optional 0x prefix and spaces are ignored
+func FromHex(s string) (*Value, error) {
+	s = strings.Join(strings.Fields(s), "")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode hex")
+	}
+	return Deserialize(b)
+}
+
+// Hex returns the hex encoding of the serialized value
+func (v *Value) Hex() (string, error) {
+	b, err := Serialize(v)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
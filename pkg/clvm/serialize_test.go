@@ -0,0 +1,63 @@
+package clvm
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSerialize(t *testing.T) {
+	tcs := []struct {
+		text string
+		hex  string
+	}{
+		{"()", "80"},
+		{"1", "01"},
+		{"0x80", "8180"},
+		{"(c (q . 1) 2)", "ff04ffff0101ff0280"},
+		{`"hello"`, "8568656c6c6f"},
+	}
+	for _, tc := range tcs {
+		v, err := Assemble(tc.text)
+		require.NoError(t, err)
+		h, err := v.Hex()
+		require.NoError(t, err)
+		require.Equal(t, tc.hex, h)
+		d, err := FromHex(tc.hex)
+		require.NoError(t, err)
+		require.True(t, v.Equal(d), tc.text)
+	}
+
+	long := Atom([]byte(strings.Repeat("a", 0x40)))
+	b, err := Serialize(long)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0xc0, 0x40}, b[:2])
+	d, err := Deserialize(b)
+	require.NoError(t, err)
+	require.True(t, long.Equal(d))
+}
+
+func TestSerializeCompressed(t *testing.T) {
+	hash := "0x4bf5122f344554c53bde2ebb8cd2b7e3d1600ad631c385a5d7cce23c7785459a"
+	v, err := Assemble("((" + hash + " " + hash + ") (" + hash + " 1 2) " + hash + ")")
+	require.NoError(t, err)
+	plain, err := Serialize(v)
+	require.NoError(t, err)
+	compressed, err := SerializeCompressed(v)
+	require.NoError(t, err)
+	require.Less(t, len(compressed), len(plain)-3*30)
+	d, err := Deserialize(compressed)
+	require.NoError(t, err)
+	require.True(t, v.Equal(d))
+}
+
+func TestDeserializeErrors(t *testing.T) {
+	for _, h := range []string{"", "ff01", "85aa", "0101", "fe02", "ff01fe05"} {
+		b, err := hex.DecodeString(h)
+		require.NoError(t, err)
+		_, err = Deserialize(b)
+		require.Error(t, err, h)
+	}
+}
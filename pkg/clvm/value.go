@@ -0,0 +1,179 @@
+package clvm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+)
+
+// Value is a CLVM value, either an atom or a pair
+type Value struct {
+	Atom  []byte
+	First *Value
+	Rest  *Value
+}
+
+var (
+	Nil  = &Value{}
+	True = &Value{Atom: []byte{1}}
+)
+
+func Atom(b []byte) *Value {
+	return &Value{Atom: b}
+}
+
+func Cons(first, rest *Value) *Value {
+	return &Value{First: first, Rest: rest}
+}
+
+func Int(i *big.Int) *Value {
+	return Atom(IntBytes(i))
+}
+
+func Int64(i int64) *Value {
+	return Int(big.NewInt(i))
+}
+
+func Bool(b bool) *Value {
+	if b {
+		return True
+	}
+	return Nil
+}
+
+// List builds a nil-terminated list
+func List(items ...*Value) *Value {
+	l := Nil
+	for i := len(items) - 1; i >= 0; i-- {
+		l = Cons(items[i], l)
+	}
+	return l
+}
+
+func (v *Value) IsPair() bool {
+	return v.First != nil
+}
+
+func (v *Value) IsNil() bool {
+	return !v.IsPair() && len(v.Atom) == 0
+}
+
+// AsInt decodes the atom as a big-endian two's complement integer
+func (v *Value) AsInt() *big.Int {
+	return IntFromBytes(v.Atom)
+}
+
+// ListItems returns the items of a list, ok is false if the value is not nil-terminated
+func (v *Value) ListItems() (items []*Value, ok bool) {
+	for v.IsPair() {
+		items = append(items, v.First)
+		v = v.Rest
+	}
+	return items, v.IsNil()
+}
+
+func (v *Value) Equal(o *Value) bool {
+	if v.IsPair() != o.IsPair() {
+		return false
+	}
+	if v.IsPair() {
+		return v.First.Equal(o.First) && v.Rest.Equal(o.Rest)
+	}
+	return bytes.Equal(v.Atom, o.Atom)
+}
+
+// IntFromBytes decodes a big-endian two's complement integer, the empty atom is zero
+func IntFromBytes(b []byte) *big.Int {
+	i := new(big.Int).SetBytes(b)
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		i.Sub(i, new(big.Int).Lsh(big.NewInt(1), uint(len(b)*8)))
+	}
+	return i
+}
+
+// IntBytes encodes an integer in the minimal big-endian two's complement form, zero is the empty atom
+func IntBytes(i *big.Int) []byte {
+	switch i.Sign() {
+	case 0:
+		return []byte{}
+	case 1:
+		b := i.Bytes()
+		if b[0]&0x80 != 0 {
+			b = append([]byte{0}, b...)
+		}
+		return b
+	}
+	// two's complement of a negative number on enough bytes
+	n := (i.BitLen() + 8) / 8
+	b := new(big.Int).Add(i, new(big.Int).Lsh(big.NewInt(1), uint(n*8))).Bytes()
+	for len(b) < n {
+		b = append([]byte{0xff}, b...)
+	}
+	for len(b) > 1 && b[0] == 0xff && b[1]&0x80 != 0 {
+		b = b[1:]
+	}
+	return b
+}
+
+func isCanonicalInt(b []byte) bool {
+	return bytes.Equal(IntBytes(IntFromBytes(b)), b)
+}
+
+func isPrintable(b []byte) bool {
+	for _, r := range string(b) {
+		if r == unicode.ReplacementChar || r == '"' || !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func atomString(b []byte, operator bool) string {
+	if len(b) == 0 {
+		return "()"
+	}
+	if operator && len(b) <= 4 {
+		if op, ok := OperatorsByOpcode[uint32(new(big.Int).SetBytes(b).Uint64())]; ok {
+			return op.Name
+		}
+	}
+	if len(b) > 2 && isPrintable(b) {
+		return `"` + string(b) + `"`
+	}
+	if len(b) <= 2 && isCanonicalInt(b) {
+		return IntFromBytes(b).String()
+	}
+	return "0x" + hex.EncodeToString(b)
+}
+
+func (v *Value) write(sb *strings.Builder, operator bool) {
+	if !v.IsPair() {
+		sb.WriteString(atomString(v.Atom, operator))
+		return
+	}
+	sb.WriteByte('(')
+	v.First.write(sb, true)
+	for v = v.Rest; v.IsPair(); v = v.Rest {
+		sb.WriteByte(' ')
+		v.First.write(sb, false)
+	}
+	if !v.IsNil() {
+		sb.WriteString(" . ")
+		v.write(sb, false)
+	}
+	sb.WriteByte(')')
+}
+
+// String disassembles the value, atoms in operator position are written with the operator names
+func (v *Value) String() string {
+	sb := strings.Builder{}
+	v.write(&sb, false)
+	return sb.String()
+}
+
+func (v *Value) Format(f fmt.State, c rune) {
+	fmt.Fprint(f, v.String())
+}
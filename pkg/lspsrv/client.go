@@ -0,0 +1,127 @@
+package lspsrv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+	lsp "go.lsp.dev/protocol"
+	"go.uber.org/zap"
+)
+
+var ErrClientClosed = errors.New("client closed")
+
+// Client sends notifications and requests to the client, the reading loop passes the responses
+// to HandleResponse which hands them to the calls waiting for them by id
+type Client struct {
+	l   *zap.Logger
+	out io.Writer
+
+	mu      sync.Mutex
+	lastID  int
+	pending map[string]chan *RawRequestMessage
+	closed  bool
+}
+
+func NewClient(l *zap.Logger, out io.Writer) *Client {
+	return &Client{
+		l:       l,
+		out:     out,
+		pending: map[string]chan *RawRequestMessage{},
+	}
+}
+
+func responseKey(id interface{}) string {
+	return fmt.Sprint(id)
+}
+
+func (c *Client) Notify(method string, params interface{}) error {
+	return Notify(c.l, c.out, method, params)
+}
+
+// LogMessage adds a message to the client log, usually an output panel
+func (c *Client) LogMessage(typ lsp.MessageType, message string) error {
+	return c.Notify(lsp.MethodWindowLogMessage, &lsp.LogMessageParams{Type: typ, Message: message})
+}
+
+// ShowMessage shows a message to the user
+func (c *Client) ShowMessage(typ lsp.MessageType, message string) error {
+	return c.Notify(lsp.MethodWindowShowMessage, &lsp.ShowMessageParams{Type: typ, Message: message})
+}
+
+// Progress reports the progress of the work identified by the token
+func (c *Client) Progress(token lsp.ProgressToken, value interface{}) error {
+	return c.Notify(lsp.MethodProgress, &lsp.ProgressParams{Token: token, Value: value})
+}
+
+// Call sends a request and waits for its response, the result is unmarshaled into result when not nil.
+// It must not be called from the reading loop which would never get the response
+func (c *Client) Call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClientClosed
+	}
+	c.lastID++
+	id := fmt.Sprintf("clls-%d", c.lastID)
+	ch := make(chan *RawRequestMessage, 1)
+	c.pending[responseKey(id)] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, responseKey(id))
+		c.mu.Unlock()
+	}()
+
+	if err := Call(c.l, c.out, id, method, params); err != nil {
+		return errors.Wrap(err, "send request")
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case res, ok := <-ch:
+		if !ok {
+			return ErrClientClosed
+		}
+		if res.Error != nil {
+			return res.Error
+		}
+		if result == nil || len(res.Result) == 0 {
+			return nil
+		}
+		return errors.Wrap(json.Unmarshal(res.Result, result), "unmarshal result")
+	}
+}
+
+// HandleResponse hands the response to the call waiting for it and tells whether there was one
+func (c *Client) HandleResponse(res *RawRequestMessage) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := responseKey(res.ID)
+	ch, ok := c.pending[key]
+	if !ok {
+		return false
+	}
+	delete(c.pending, key)
+	ch <- res
+	return true
+}
+
+// Close fails the pending and next calls, responses are not read anymore
+func (c *Client) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	for key, ch := range c.pending {
+		close(ch)
+		delete(c.pending, key)
+	}
+}
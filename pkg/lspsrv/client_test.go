@@ -0,0 +1,94 @@
+package lspsrv
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// readRequest returns the next request sent by the client
+func readRequest(t *testing.T, r io.Reader) *RawRequestMessage {
+	b, err := ReadMessage(zap.NewNop(), r)
+	require.NoError(t, err)
+	req := &RawRequestMessage{}
+	require.NoError(t, json.Unmarshal(b, req))
+	return req
+}
+
+type callResult struct {
+	result string
+	err    error
+}
+
+func call(c *Client, ctx context.Context, method string) chan callResult {
+	ch := make(chan callResult, 1)
+	go func() {
+		r := ""
+		err := c.Call(ctx, method, nil, &r)
+		ch <- callResult{r, err}
+	}()
+	return ch
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestClientCall(t *testing.T) {
+	r, w := io.Pipe()
+	c := NewClient(zap.NewNop(), w)
+	ctx := testContext(t)
+
+	first := call(c, ctx, "first")
+	firstReq := readRequest(t, r)
+	require.Equal(t, "first", firstReq.Method)
+	second := call(c, ctx, "second")
+	secondReq := readRequest(t, r)
+	require.Equal(t, "second", secondReq.Method)
+	require.NotEqual(t, firstReq.ID, secondReq.ID)
+
+	// responses are handed to the calls by id, whatever their order
+	require.True(t, c.HandleResponse(&RawRequestMessage{ID: secondReq.ID, Result: json.RawMessage(`"two"`)}))
+	require.Equal(t, callResult{result: "two"}, <-second)
+	require.False(t, c.HandleResponse(&RawRequestMessage{ID: secondReq.ID, Result: json.RawMessage(`"again"`)}), "answered already")
+	require.False(t, c.HandleResponse(&RawRequestMessage{ID: "unknown"}))
+
+	require.True(t, c.HandleResponse(&RawRequestMessage{ID: firstReq.ID, Error: &ResponseError{Code: InvalidParams, Message: "bad params"}}))
+	res := <-first
+	require.Equal(t, &ResponseError{Code: InvalidParams, Message: "bad params"}, res.err)
+	require.EqualError(t, res.err, "bad params (code -32602)")
+}
+
+func TestClientCallContext(t *testing.T) {
+	r, w := io.Pipe()
+	c := NewClient(zap.NewNop(), w)
+
+	ctx, cancel := context.WithCancel(testContext(t))
+	pending := call(c, ctx, "method")
+	req := readRequest(t, r)
+	cancel()
+	require.Equal(t, context.Canceled, (<-pending).err)
+	require.False(t, c.HandleResponse(&RawRequestMessage{ID: req.ID}), "the call stopped waiting")
+}
+
+func TestClientClose(t *testing.T) {
+	r, w := io.Pipe()
+	c := NewClient(zap.NewNop(), w)
+	ctx := testContext(t)
+
+	pending := call(c, ctx, "method")
+	req := readRequest(t, r)
+	c.Close()
+	require.Equal(t, ErrClientClosed, (<-pending).err)
+	require.False(t, c.HandleResponse(&RawRequestMessage{ID: req.ID}))
+
+	require.Equal(t, ErrClientClosed, c.Call(ctx, "method", nil, nil))
+	c.Close()
+}
@@ -1,23 +1,35 @@
 package lspsrv
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
+	"sync"
 
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
-type FileTransport struct {
-	in  *os.File
-	out *os.File
+// Transport reads the client messages from in and writes the replies to out, the input is buffered
+// since headers are read a byte at a time
+type Transport struct {
+	in  io.Reader
+	out io.Writer
 	l   *zap.Logger
 }
 
+func NewTransport(l *zap.Logger, in io.Reader, out io.Writer) *Transport {
+	return &Transport{bufio.NewReader(in), out, l}
+}
+
+// FileTransport is a transport over files such as stdin and stdout
+type FileTransport = Transport
+
 func NewFileTransport(l *zap.Logger, in *os.File, out *os.File) *FileTransport {
-	ft := FileTransport{in, out, l}
-	return &ft
+	return NewTransport(l, in, out)
 }
 
 type RawRequestMessage struct {
@@ -25,6 +37,10 @@ type RawRequestMessage struct {
 	ID      interface{}     `json:"id"`
 	Method  string          `json:"method"`
 	Params  json.RawMessage `json:"params"`
+
+	// set on the responses to the server requests, which have no method
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *ResponseError  `json:"error,omitempty"`
 }
 
 type ResponseError struct {
@@ -33,6 +49,23 @@ type ResponseError struct {
 	Data    interface{} `json:"data"`
 }
 
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+type RequestMessage struct {
+	Version string      `json:"jsonrpc"`
+	ID      interface{} `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+type NotificationMessage struct {
+	Version string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
 type ResponseMessage struct {
 	Version string         `json:"jsonrpc"`
 	ID      interface{}    `json:"id,omitempty"`
@@ -40,21 +73,11 @@ type ResponseMessage struct {
 	Error   *ResponseError `json:"error,omitempty"`
 }
 
-func (ft *FileTransport) Recv() (*RawRequestMessage, error) {
-	// Read header
-	h, err := ReadHeader(ft.l, ft.in)
+func (ft *Transport) Recv() (*RawRequestMessage, error) {
+	b, err := ReadMessage(ft.l, ft.in)
 	if err != nil {
 		return nil, err
 	}
-	if h.ContentLength == nil {
-		return nil, errors.New("no Content-Length")
-	}
-
-	// Read message
-	b := make([]byte, *h.ContentLength)
-	if _, err := io.ReadFull(ft.in, b); err != nil {
-		return nil, err
-	}
 
 	// Unmarshal request
 	var req RawRequestMessage
@@ -65,7 +88,7 @@ func (ft *FileTransport) Recv() (*RawRequestMessage, error) {
 	return &req, nil
 }
 
-func (ft *FileTransport) Send(res *ResponseMessage) error {
+func (ft *Transport) Send(res *ResponseMessage) error {
 	return Reply(ft.l, ft.out, res)
 }
 
@@ -73,20 +96,79 @@ func Reply(l *zap.Logger, w io.Writer, res *ResponseMessage) error {
 	if res.Version == "" {
 		res.Version = "2.0"
 	}
-	replyBytes, err := json.Marshal(res)
+	return WriteMessage(l, w, res)
+}
+
+func Notify(l *zap.Logger, w io.Writer, method string, params interface{}) error {
+	return WriteMessage(l, w, &NotificationMessage{
+		Version: "2.0",
+		Method:  method,
+		Params:  params,
+	})
+}
+
+// Call sends a request to the client, its response is received like the client messages
+func Call(l *zap.Logger, w io.Writer, id interface{}, method string, params interface{}) error {
+	return WriteMessage(l, w, &RequestMessage{
+		Version: "2.0",
+		ID:      id,
+		Method:  method,
+		Params:  params,
+	})
+}
+
+// ReadMessage reads the content of a message framed by a Content-Length header
+func ReadMessage(l *zap.Logger, r io.Reader) ([]byte, error) {
+	h, err := ReadHeader(l, r)
 	if err != nil {
-		return errors.Wrap(err, "marshal reply")
+		return nil, err
+	}
+	if h.ContentLength == nil {
+		return nil, errors.New("no Content-Length")
+	}
+
+	b := make([]byte, *h.ContentLength)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
 	}
-	cl := len(replyBytes)
-	if err := (&Header{ContentLength: &cl}).Write(l, w); err != nil {
+	return b, nil
+}
+
+// WriteMessage writes msg as JSON framed by a Content-Length header, in a single write
+// so that messages written concurrently to a synchronized writer don't interleave
+func WriteMessage(l *zap.Logger, w io.Writer, msg interface{}) error {
+	msgBytes, err := json.Marshal(msg)
+	if err != nil {
+		return errors.Wrap(err, "marshal message")
+	}
+	cl := len(msgBytes)
+	buf := bytes.Buffer{}
+	if err := (&Header{ContentLength: &cl}).Write(l, &buf); err != nil {
 		return errors.Wrap(err, "write header")
 	}
-	if _, err := w.Write(replyBytes); err != nil {
+	buf.Write(msgBytes)
+	if _, err := w.Write(buf.Bytes()); err != nil {
 		return errors.Wrap(err, "write message")
 	}
 	return nil
 }
 
+// SyncWriter serializes the writes to the underlying writer
+type SyncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewSyncWriter(w io.Writer) *SyncWriter {
+	return &SyncWriter{w: w}
+}
+
+func (sw *SyncWriter) Write(p []byte) (int, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.w.Write(p)
+}
+
 func ReplyWithError(l *zap.Logger, w io.Writer, id interface{}, err error) error {
 	return ReplyWithErrorCode(l, w, id, err, UnknownErrorCode)
 }
@@ -138,11 +138,19 @@ func Unmarshal(method string, payloadBytes []byte) (interface{}, error) {
 }
 
 var specialMethodIDs = map[string]string{
-	"Initialize":         "initialize",
-	"Initialized":        "initialized",
-	"Shutdown":           "shutdown",
-	"Exit":               "exit",
-	"SemanticTokensFull": "textDocument/semanticTokens/full",
+	"Initialize":             "initialize",
+	"Initialized":            "initialized",
+	"Shutdown":               "shutdown",
+	"Exit":                   "exit",
+	"SemanticTokensFull":     "textDocument/semanticTokens/full",
+	"CompletionResolve":      "completionItem/resolve",
+	"FoldingRanges":          "textDocument/foldingRange",
+	"IncomingCalls":          "callHierarchy/incomingCalls",
+	"OutgoingCalls":          "callHierarchy/outgoingCalls",
+	"DidChangeConfiguration": "workspace/didChangeConfiguration",
+	"Symbols":                "workspace/symbol",
+	"DidChangeWatchedFiles":  "workspace/didChangeWatchedFiles",
+	"SetTrace":               "$/setTrace",
 }
 
 func uncap(s string) string {
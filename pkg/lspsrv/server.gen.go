@@ -275,7 +275,7 @@ func Unmarshal(method string, payloadBytes []byte) (interface{}, error) {
 		var payload lsp.CompletionParams
 		return &payload, json.Unmarshal(payloadBytes, &payload)
 
-	case "textDocument/completionResolve":
+	case "completionItem/resolve":
 		var payload lsp.CompletionItem
 		return &payload, json.Unmarshal(payloadBytes, &payload)
 
@@ -291,11 +291,11 @@ func Unmarshal(method string, payloadBytes []byte) (interface{}, error) {
 		var payload lsp.DidChangeTextDocumentParams
 		return &payload, json.Unmarshal(payloadBytes, &payload)
 
-	case "textDocument/didChangeConfiguration":
+	case "workspace/didChangeConfiguration":
 		var payload lsp.DidChangeConfigurationParams
 		return &payload, json.Unmarshal(payloadBytes, &payload)
 
-	case "textDocument/didChangeWatchedFiles":
+	case "workspace/didChangeWatchedFiles":
 		var payload lsp.DidChangeWatchedFilesParams
 		return &payload, json.Unmarshal(payloadBytes, &payload)
 
@@ -354,7 +354,7 @@ func Unmarshal(method string, payloadBytes []byte) (interface{}, error) {
 	case "exit":
 		return nil, nil
 
-	case "textDocument/foldingRanges":
+	case "textDocument/foldingRange":
 		var payload lsp.FoldingRangeParams
 		return &payload, json.Unmarshal(payloadBytes, &payload)
 
@@ -370,7 +370,7 @@ func Unmarshal(method string, payloadBytes []byte) (interface{}, error) {
 		var payload lsp.ImplementationParams
 		return &payload, json.Unmarshal(payloadBytes, &payload)
 
-	case "textDocument/incomingCalls":
+	case "callHierarchy/incomingCalls":
 		var payload lsp.CallHierarchyIncomingCallsParams
 		return &payload, json.Unmarshal(payloadBytes, &payload)
 
@@ -398,7 +398,7 @@ func Unmarshal(method string, payloadBytes []byte) (interface{}, error) {
 		var payload lsp.DocumentOnTypeFormattingParams
 		return &payload, json.Unmarshal(payloadBytes, &payload)
 
-	case "textDocument/outgoingCalls":
+	case "callHierarchy/outgoingCalls":
 		var payload lsp.CallHierarchyOutgoingCallsParams
 		return &payload, json.Unmarshal(payloadBytes, &payload)
 
@@ -437,7 +437,7 @@ func Unmarshal(method string, payloadBytes []byte) (interface{}, error) {
 	case "textDocument/semanticTokensRefresh":
 		return nil, nil
 
-	case "textDocument/setTrace":
+	case "$/setTrace":
 		var payload lsp.SetTraceParams
 		return &payload, json.Unmarshal(payloadBytes, &payload)
 
@@ -452,7 +452,7 @@ func Unmarshal(method string, payloadBytes []byte) (interface{}, error) {
 		var payload lsp.SignatureHelpParams
 		return &payload, json.Unmarshal(payloadBytes, &payload)
 
-	case "textDocument/symbols":
+	case "workspace/symbol":
 		var payload lsp.WorkspaceSymbolParams
 		return &payload, json.Unmarshal(payloadBytes, &payload)
 
@@ -528,7 +528,7 @@ func Request(ctx context.Context, s lsp.Server, method string, payload interface
 		}
 		return s.Completion(ctx, castedPayload)
 
-	case "textDocument/completionResolve":
+	case "completionItem/resolve":
 		castedPayload, ok := payload.(*lsp.CompletionItem)
 		if !ok {
 			return nil, ErrBadPayloadType
@@ -556,14 +556,14 @@ func Request(ctx context.Context, s lsp.Server, method string, payload interface
 		}
 		return nil, s.DidChange(ctx, castedPayload)
 
-	case "textDocument/didChangeConfiguration":
+	case "workspace/didChangeConfiguration":
 		castedPayload, ok := payload.(*lsp.DidChangeConfigurationParams)
 		if !ok {
 			return nil, ErrBadPayloadType
 		}
 		return nil, s.DidChangeConfiguration(ctx, castedPayload)
 
-	case "textDocument/didChangeWatchedFiles":
+	case "workspace/didChangeWatchedFiles":
 		castedPayload, ok := payload.(*lsp.DidChangeWatchedFilesParams)
 		if !ok {
 			return nil, ErrBadPayloadType
@@ -664,7 +664,7 @@ func Request(ctx context.Context, s lsp.Server, method string, payload interface
 	case "exit":
 		return nil, s.Exit(ctx)
 
-	case "textDocument/foldingRanges":
+	case "textDocument/foldingRange":
 		castedPayload, ok := payload.(*lsp.FoldingRangeParams)
 		if !ok {
 			return nil, ErrBadPayloadType
@@ -692,7 +692,7 @@ func Request(ctx context.Context, s lsp.Server, method string, payload interface
 		}
 		return s.Implementation(ctx, castedPayload)
 
-	case "textDocument/incomingCalls":
+	case "callHierarchy/incomingCalls":
 		castedPayload, ok := payload.(*lsp.CallHierarchyIncomingCallsParams)
 		if !ok {
 			return nil, ErrBadPayloadType
@@ -741,7 +741,7 @@ func Request(ctx context.Context, s lsp.Server, method string, payload interface
 		}
 		return s.OnTypeFormatting(ctx, castedPayload)
 
-	case "textDocument/outgoingCalls":
+	case "callHierarchy/outgoingCalls":
 		castedPayload, ok := payload.(*lsp.CallHierarchyOutgoingCallsParams)
 		if !ok {
 			return nil, ErrBadPayloadType
@@ -807,7 +807,7 @@ func Request(ctx context.Context, s lsp.Server, method string, payload interface
 	case "textDocument/semanticTokensRefresh":
 		return nil, s.SemanticTokensRefresh(ctx)
 
-	case "textDocument/setTrace":
+	case "$/setTrace":
 		castedPayload, ok := payload.(*lsp.SetTraceParams)
 		if !ok {
 			return nil, ErrBadPayloadType
@@ -831,7 +831,7 @@ func Request(ctx context.Context, s lsp.Server, method string, payload interface
 		}
 		return s.SignatureHelp(ctx, castedPayload)
 
-	case "textDocument/symbols":
+	case "workspace/symbol":
 		castedPayload, ok := payload.(*lsp.WorkspaceSymbolParams)
 		if !ok {
 			return nil, ErrBadPayloadType